@@ -0,0 +1,70 @@
+// fakerf2 serves the endpoints of an rFactor2 dedicated server used by the bot
+// with simulated cars lapping a synthetic track, so the bot can be run
+// without a real server.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/fakerf2"
+)
+
+func main() {
+	addr := flag.String("addr", ":5397", "address to listen on")
+	name := flag.String("name", "Fake rFactor2 server", "server name")
+	cars := flag.Int("cars", 12, "number of cars")
+	classes := flag.Int("classes", 2, "number of car classes (1 to 3)")
+	trackLength := flag.Float64("track-length", 3000.0, "track length in meters")
+	lapTime := flag.Duration("lap-time", 90*time.Second, "lap time of the fastest class")
+	sessionLength := flag.Duration("session-length", 10*time.Minute, "length of the practice, qualifying and warmup sessions")
+	raceLaps := flag.Int("race-laps", 10, "laps of the race")
+	pitEvery := flag.Int("pit-every", 5, "laps between pit stops (0 disables them)")
+	pitStopTime := flag.Duration("pit-stop-time", 20*time.Second, "time the cars are stopped in the pits")
+	loadingTime := flag.Duration("loading-time", 10*time.Second, "time no data is sent between sessions")
+	interval := flag.Duration("interval", 500*time.Millisecond, "time between messages")
+	timeScale := flag.Float64("time-scale", 1.0, "how many times faster than real time the simulation runs")
+	seed := flag.Int64("seed", time.Now().UnixNano(), "random seed")
+	flag.Parse()
+
+	track := fakerf2.NewTrack(*trackLength)
+	sim := fakerf2.NewSimulation(fakerf2.Options{
+		Cars:          *cars,
+		Classes:       *classes,
+		LapTime:       *lapTime,
+		SessionLength: *sessionLength,
+		RaceLaps:      *raceLaps,
+		PitEvery:      *pitEvery,
+		PitStopTime:   *pitStopTime,
+		LoadingTime:   *loadingTime,
+		ServerName:    *name,
+		Seed:          *seed,
+	}, track)
+	server := fakerf2.NewServer(sim, *interval, *timeScale)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go server.Run(ctx)
+
+	srv := &http.Server{Addr: *addr, Handler: server}
+	go func() {
+		log.Printf("Fake rFactor2 server listening on %s. Track: %s\n", *addr, track.ID)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Error serving: %s", err.Error())
+		}
+	}()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	<-sigs
+
+	cancel()
+	ctx, cancelShutdown := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelShutdown()
+	_ = srv.Shutdown(ctx)
+}
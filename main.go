@@ -2,26 +2,28 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"strings"
 	"syscall"
 	"time"
 
-	"github.com/oscar-martin/rfactor2telegrambot/pkg/apps"
 	"github.com/oscar-martin/rfactor2telegrambot/pkg/apps/live"
 	"github.com/oscar-martin/rfactor2telegrambot/pkg/apps/mainapp"
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/config"
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/locale"
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/metrics"
 	"github.com/oscar-martin/rfactor2telegrambot/pkg/notification"
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/results"
 	"github.com/oscar-martin/rfactor2telegrambot/pkg/servers"
 	"github.com/oscar-martin/rfactor2telegrambot/pkg/settings"
 	"github.com/oscar-martin/rfactor2telegrambot/pkg/webserver"
 
 	"github.com/nicksnyder/go-i18n/v2/i18n"
-	"golang.org/x/text/language"
 
 	_ "net/http/pprof"
 
@@ -35,11 +37,20 @@ const (
 	EnvLiveMapDomain    = "LIVEMAP_DOMAIN"
 	EnvTelegramToken    = "TELEGRAM_TOKEN"
 	EnvWebServerAddress = "WEBSERVER_ADDRESS"
+	// path to the config file. Environment variables override its values
+	EnvConfigFile = "CONFIG_FILE"
+	// directory the data of the servers is recorded in
+	EnvRecordDir = "RECORD_DIR"
+	// format: <user_id>,<user_id>,...
+	EnvAdmins = "BOT_ADMINS"
 )
 
 var (
-	bot *tgbotapi.BotAPI
-	app apps.Accepter
+	bot  *tgbotapi.BotAPI
+	app  *mainapp.MainApp
+	locs *locale.Localizers
+	// stores the language of the users
+	userSettings *settings.Manager
 )
 
 var cpuprofile = flag.String("cpuprofile", "", "write cpu profile to `file`")
@@ -70,23 +81,14 @@ func main() {
 		log.Fatalf("%s is not set", EnvTelegramToken)
 	}
 
-	liveMapDomain := os.Getenv(EnvLiveMapDomain)
-	if liveMapDomain == "" {
-		log.Fatalf("%s is not set", EnvLiveMapDomain)
-	}
-	liveMapDomain = strings.TrimRight(liveMapDomain, "/")
-
-	rf2Servers := os.Getenv(EnvServers)
-	if rf2Servers == "" {
-		log.Fatalf("%s is not set", EnvServers)
-	}
-
-	var webServerAddr = ":8080"
-	if os.Getenv(EnvWebServerAddress) != "" {
-		webServerAddr = os.Getenv(EnvWebServerAddress)
+	configFile := os.Getenv(EnvConfigFile)
+	cfg, err := loadConfig(configFile)
+	if err != nil {
+		log.Fatalf("Error loading config: %s", err.Error())
 	}
 
-	bot, err = tgbotapi.NewBotAPI(token)
+	// the client counts the failed requests to Telegram
+	bot, err = tgbotapi.NewBotAPIWithClient(token, tgbotapi.APIEndpoint, metrics.HTTPClient{Client: &http.Client{}})
 	if err != nil {
 		// Abort if something is wrong
 		log.Panic(err)
@@ -102,48 +104,90 @@ func main() {
 	ctx := context.Background()
 	ctx, cancel := context.WithCancel(ctx)
 
-	// `updates` is a golang channel which receives telegram updates
-	updates := bot.GetUpdatesChan(u)
-
-	// Pass cancellable context to goroutine
-	go receiveUpdates(ctx, updates)
-
 	exitChan := make(chan bool)
-	refreshServersTicker := time.NewTicker(10 * time.Second)
+	refreshServersTicker := time.NewTicker(cfg.CheckInterval.Duration)
+
+	locs, err = locale.NewLocalizers(locale.MessageFiles)
+	if err != nil {
+		log.Fatalf("Error loading translations: %s", err.Error())
+	}
 
-	bundle := i18n.NewBundle(language.English)
-	bundle.RegisterUnmarshalFunc("json", json.Unmarshal)
-	bundle.MustLoadMessageFile("active.en.json")
-	loc := i18n.NewLocalizer(bundle, "en")
+	// build the main app
+	ss := createServers(cfg)
+	serverIDs := []string{}
+	for _, s := range ss {
+		serverIDs = append(serverIDs, s.ID)
+	}
 
-	settings, err := settings.NewManager()
+	settings, err := settings.NewManager(serverIDs)
 	if err != nil {
 		log.Fatalf("Error creating settings manager: %s", err.Error())
 	}
+	for _, sc := range cfg.Servers {
+		settings.SetServerDefaults(sc.ID, sc.Notifications)
+	}
+	applyAccess(settings, cfg)
+	userSettings = settings
 
-	nm := notification.NewManager(ctx, bot, settings, loc)
+	rm, err := results.NewManager()
+	if err != nil {
+		log.Fatalf("Error creating results manager: %s", err.Error())
+	}
+
+	nm := notification.NewManager(ctx, bot, settings, locs)
 	go nm.Start(exitChan)
+	for _, s := range ss {
+		nm.WatchDrivers(s.ID)
+	}
 
-	// build the main app
-	ss, err := createServers(rf2Servers, liveMapDomain)
-	if err != nil {
-		log.Fatalf("Error creating servers: %s", err.Error())
+	for _, s := range ss {
+		rm.Record(ctx, s.ID)
 	}
 	ws := webserver.NewManager()
-	sm, err := servers.NewManager(ctx, bot, ss, ws, loc)
+	sm, err := servers.NewManager(ctx, bot, ss, ws, locs.Default())
 	if err != nil {
 		log.Fatalf("Error creating servers manager: %s", err.Error())
 	}
+	ws.APIHandlers(ctx, sm.Definitions())
 	// ws.Debug()
 
-	app, err = mainapp.NewMainApp(ctx, bot, ss, exitChan, settings, loc)
+	app, err = mainapp.NewMainApp(ctx, bot, ss, exitChan, settings, rm, locs)
 	if err != nil {
 		log.Fatalf("Error creating main app: %s", err.Error())
 	}
 
+	// the bot keeps working without the command suggestions
+	err = mainapp.RegisterCommands(bot, locs)
+	if err != nil {
+		log.Printf("Error registering the commands: %s", err.Error())
+	}
+
+	// `updates` is a golang channel which receives telegram updates
+	updates := bot.GetUpdatesChan(u)
+
+	// Pass cancellable context to goroutine. The updates are received once
+	// the apps that handle them are created
+	go receiveUpdates(ctx, updates)
+
 	// start syncing once the apps are created
 	go sm.Sync(refreshServersTicker, exitChan)
-	go ws.Serve(webServerAddr)
+	go ws.Serve(cfg.WebServerAddress)
+
+	go config.Watch(ctx, configFile, func(cfg config.Config) {
+		cfg, err := applyEnv(cfg)
+		if err != nil {
+			log.Printf("Ignoring config change: %s", err.Error())
+			return
+		}
+		for _, sc := range cfg.Servers {
+			settings.SetServerDefaults(sc.ID, sc.Notifications)
+			rm.Record(ctx, sc.ID)
+			nm.WatchDrivers(sc.ID)
+		}
+		applyAccess(settings, cfg)
+		sm.Apply(cfg.Servers, cfg.LiveMapDomain, cfg.RecordDir)
+		refreshServersTicker.Reset(cfg.CheckInterval.Duration)
+	})
 
 	// Tell the user the bot is online
 	log.Println("Start listening for updates. Press Ctrl-C to stop it")
@@ -158,6 +202,7 @@ func main() {
 	exitChan <- true
 
 	settings.Close()
+	rm.Close()
 
 	cancel()
 
@@ -174,18 +219,71 @@ func main() {
 	// }
 }
 
-func createServers(rf2Servers, domain string) ([]servers.Server, error) {
-	serversStr := strings.Split(rf2Servers, ";")
-	ss := []servers.Server{}
-	for _, serverStr := range serversStr {
-		serverData := strings.Split(serverStr, ",")
-		if len(serverData) != 2 {
-			return nil, fmt.Errorf("Invalid server data: %s", serverStr)
+// loadConfig reads the config file, if any, and overrides it with the
+// environment variables.
+func loadConfig(path string) (config.Config, error) {
+	cfg, err := config.Load(path)
+	if err != nil {
+		return cfg, err
+	}
+	return applyEnv(cfg)
+}
+
+func applyEnv(cfg config.Config) (config.Config, error) {
+	if liveMapDomain := os.Getenv(EnvLiveMapDomain); liveMapDomain != "" {
+		cfg.LiveMapDomain = liveMapDomain
+	}
+	cfg.LiveMapDomain = strings.TrimRight(cfg.LiveMapDomain, "/")
+
+	if rf2Servers := os.Getenv(EnvServers); rf2Servers != "" {
+		scs, err := config.ParseServers(rf2Servers)
+		if err != nil {
+			return cfg, err
 		}
-		server := servers.NewServer(serverData[0], serverData[1], domain)
-		ss = append(ss, server)
+		cfg.Servers = scs
 	}
-	return ss, nil
+
+	if webServerAddr := os.Getenv(EnvWebServerAddress); webServerAddr != "" {
+		cfg.WebServerAddress = webServerAddr
+	}
+
+	if recordDir := os.Getenv(EnvRecordDir); recordDir != "" {
+		cfg.RecordDir = recordDir
+	}
+
+	if admins := os.Getenv(EnvAdmins); admins != "" {
+		ids, err := config.ParseAdmins(admins)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.Admins = ids
+	}
+
+	err := cfg.Validate()
+	if err != nil {
+		return cfg, fmt.Errorf("%w (set %s or %s and %s)", err, EnvConfigFile, EnvServers, EnvLiveMapDomain)
+	}
+	return cfg, nil
+}
+
+// applyAccess sets the admins and the servers only shown to the members.
+func applyAccess(sm *settings.Manager, cfg config.Config) {
+	admins := []string{}
+	for _, id := range cfg.Admins {
+		admins = append(admins, fmt.Sprintf("%d", id))
+	}
+	sm.SetAdmins(admins)
+	for _, sc := range cfg.Servers {
+		sm.SetServerVisibility(sc.ID, sc.MembersOnly())
+	}
+}
+
+func createServers(cfg config.Config) []servers.Server {
+	ss := []servers.Server{}
+	for _, sc := range cfg.Servers {
+		ss = append(ss, servers.NewServerFromConfig(sc, cfg.LiveMapDomain, cfg.RecordDir))
+	}
+	return ss
 }
 
 func receiveUpdates(ctx context.Context, updates tgbotapi.UpdatesChannel) {
@@ -211,6 +309,7 @@ func handleUpdate(ctx context.Context, update tgbotapi.Update) {
 		}
 		ctx = context.WithValue(ctx, live.UserContextKey, user)
 		ctx = context.WithValue(ctx, live.ChatContextKey, update.Message.Chat)
+		ctx = locale.NewContext(ctx, chatLocalizer(user, update.Message.Chat))
 		MessageHandler(ctx, update.Message)
 	// Handle button clicks
 	case update.CallbackQuery != nil:
@@ -223,13 +322,51 @@ func handleUpdate(ctx context.Context, update tgbotapi.Update) {
 		}
 		ctx = context.WithValue(ctx, live.UserContextKey, user)
 		ctx = context.WithValue(ctx, live.ChatContextKey, update.CallbackQuery.Message.Chat)
+		ctx = locale.NewContext(ctx, chatLocalizer(user, update.CallbackQuery.Message.Chat))
 		err := CallbackQueryHandler(ctx, update.CallbackQuery)
 		if err != nil {
 			log.Printf("An error occured: %s", err.Error())
 		}
+	// Handle inline queries, typed in any chat after the name of the bot
+	case update.InlineQuery != nil:
+		user := update.InlineQuery.From
+		if user == nil {
+			return
+		}
+		ctx = context.WithValue(ctx, live.UserContextKey, user)
+		ctx = locale.NewContext(ctx, localizer(user))
+		err := app.AnswerInlineQuery(ctx, update.InlineQuery)
+		if err != nil {
+			log.Printf("An error occured: %s", err.Error())
+		}
 	}
 }
 
+// chatLocalizer returns the localizer of the language chosen for the chat. The
+// language of a private chat is the one of the user and, if none was chosen,
+// the one of its Telegram client. Groups have their own and use the default
+// language until their admins choose one.
+func chatLocalizer(user *tgbotapi.User, chat *tgbotapi.Chat) *i18n.Localizer {
+	if !chat.IsPrivate() {
+		lang, err := userSettings.ChosenLanguage(fmt.Sprintf("%d", chat.ID), locs.Languages()[0])
+		if err != nil {
+			log.Printf("Error reading the language of chat %d: %s", chat.ID, err.Error())
+		}
+		return locs.Get(lang)
+	}
+	return localizer(user)
+}
+
+// localizer returns the localizer of the language chosen for the user or, if
+// none was chosen, the one of the client of the user.
+func localizer(user *tgbotapi.User) *i18n.Localizer {
+	lang, err := userSettings.Language(fmt.Sprintf("%d", user.ID), locs.Match(user.LanguageCode))
+	if err != nil {
+		log.Printf("Error reading the language of user %d: %s", user.ID, err.Error())
+	}
+	return locs.Get(lang)
+}
+
 func MessageHandler(ctx context.Context, message *tgbotapi.Message) {
 	user := message.From
 	text := message.Text
@@ -243,10 +380,14 @@ func MessageHandler(ctx context.Context, message *tgbotapi.Message) {
 
 	var err error
 	if message.IsCommand() {
-		// text is `/command-name`
-		err = handleCommand(ctx, message.Chat.ID, text)
-	} else {
-		// text is `button-text`
+		if !isForBot(message) {
+			return
+		}
+		// text is `/command-name arguments`
+		err = handleCommand(ctx, message.Chat.ID, commandText(message))
+	} else if message.Chat.IsPrivate() {
+		// text is `button-text`. Groups do not get reply keyboards, so the
+		// rest of their messages are not for the bot
 		err = handleButton(ctx, message.Chat.ID, text)
 	}
 
@@ -255,6 +396,23 @@ func MessageHandler(ctx context.Context, message *tgbotapi.Message) {
 	}
 }
 
+// isForBot returns whether the command is for the bot. Commands in groups may
+// be addressed to other bots with the `@botname` suffix.
+func isForBot(message *tgbotapi.Message) bool {
+	_, to, found := strings.Cut(message.CommandWithAt(), "@")
+	return !found || strings.EqualFold(to, bot.Self.UserName)
+}
+
+// commandText returns the command of the message without the `@botname`
+// suffix, followed by its arguments.
+func commandText(message *tgbotapi.Message) string {
+	command := "/" + message.Command()
+	if arguments := strings.TrimSpace(message.CommandArguments()); arguments != "" {
+		command += " " + arguments
+	}
+	return command
+}
+
 // When we get a button clicked, we react accordingly
 func handleButton(ctx context.Context, chatId int64, button string) error {
 	if accept, handler := app.AcceptButton(button); accept {
@@ -11,3 +11,9 @@ type Accepter interface {
 	AcceptButton(button string) (bool, func(ctx context.Context, chatId int64) error)
 	AcceptCallback(query *tgbotapi.CallbackQuery) (bool, func(ctx context.Context, query *tgbotapi.CallbackQuery) error)
 }
+
+// InlineQuerier returns the results of the inline queries, the ones typed in
+// any chat after the name of the bot.
+type InlineQuerier interface {
+	InlineResults(ctx context.Context, query string) []interface{}
+}
@@ -0,0 +1,440 @@
+package live
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/locale"
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/servers"
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/settings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+const (
+	// users and groups ask to join to see the members only servers
+	CommandJoin = "/join"
+	// the admins list, approve and deny the users
+	CommandRequests = "/requests"
+	CommandApprove  = "/approve"
+	CommandDeny     = "/deny"
+
+	// the admins get the join requests with these buttons. Format:
+	// access:<status>:<user_id>
+	subcommandAccess = "access"
+
+	symbolApprove = "✅"
+	symbolDeny    = "❌"
+)
+
+// AccessApp handles the join requests and the commands the admins approve and
+// deny the users with.
+type AccessApp struct {
+	bot  *tgbotapi.BotAPI
+	sm   *settings.Manager
+	locs *locale.Localizers
+}
+
+func NewAccessApp(bot *tgbotapi.BotAPI, sm *settings.Manager, locs *locale.Localizers) *AccessApp {
+	return &AccessApp{
+		bot:  bot,
+		sm:   sm,
+		locs: locs,
+	}
+}
+
+func (aa *AccessApp) AcceptCommand(command string) (bool, func(ctx context.Context, chatId int64) error) {
+	name, arguments, _ := strings.Cut(command, " ")
+	switch name {
+	case CommandJoin:
+		return true, aa.join
+	case CommandRequests:
+		return true, aa.onlyAdmins(aa.sendRequests)
+	case CommandApprove, CommandDeny:
+		status := settings.AccessAllowed
+		if name == CommandDeny {
+			status = settings.AccessDenied
+		}
+		return true, aa.onlyAdmins(func(ctx context.Context, chatId int64) error {
+			loc := aa.locs.FromContext(ctx)
+			userID, err := strconv.ParseInt(strings.TrimSpace(arguments), 10, 64)
+			if err != nil {
+				return aa.sendInvalidUser(chatId, name, loc)
+			}
+			user, err := aa.setAccess(fmt.Sprintf("%d", userID), status)
+			if err != nil {
+				return aa.sendCouldNotChangeAccess(chatId, loc)
+			}
+			msg := tgbotapi.NewMessage(chatId, accessChangedText(user, status, loc))
+			_, err = aa.bot.Send(msg)
+			return err
+		})
+	}
+	return false, nil
+}
+
+func (aa *AccessApp) AcceptCallback(query *tgbotapi.CallbackQuery) (bool, func(ctx context.Context, query *tgbotapi.CallbackQuery) error) {
+	data := strings.Split(query.Data, ":")
+	if data[0] != subcommandAccess || len(data) != 3 {
+		return false, nil
+	}
+	status := data[1]
+	if status != settings.AccessAllowed && status != settings.AccessDenied {
+		return false, nil
+	}
+	return true, func(ctx context.Context, query *tgbotapi.CallbackQuery) error {
+		loc := aa.locs.FromContext(ctx)
+		if !aa.sm.IsAdmin(fmt.Sprintf("%d", query.From.ID)) {
+			_, err := aa.bot.Request(tgbotapi.NewCallbackWithAlert(query.ID, getOnlyAdminsText(loc)))
+			return err
+		}
+		user, err := aa.setAccess(data[2], status)
+		if err != nil {
+			return aa.sendCouldNotChangeAccess(query.Message.Chat.ID, loc)
+		}
+		msg := tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, accessChangedText(user, status, loc))
+		_, err = aa.bot.Send(msg)
+		return err
+	}
+}
+
+func (aa *AccessApp) AcceptButton(button string) (bool, func(ctx context.Context, chatId int64) error) {
+	return false, nil
+}
+
+// onlyAdmins wraps the handler so the rest of the users are told it is only
+// for the admins.
+func (aa *AccessApp) onlyAdmins(handler func(ctx context.Context, chatId int64) error) func(ctx context.Context, chatId int64) error {
+	return func(ctx context.Context, chatId int64) error {
+		user, ok := ctx.Value(UserContextKey).(*tgbotapi.User)
+		if ok && aa.sm.IsAdmin(fmt.Sprintf("%d", user.ID)) {
+			return handler(ctx, chatId)
+		}
+		msg := tgbotapi.NewMessage(chatId, getOnlyAdminsText(aa.locs.FromContext(ctx)))
+		_, err := aa.bot.Send(msg)
+		return err
+	}
+}
+
+// join asks the admins to let the user, or the group in group chats, see the
+// members only servers. They are asked once, the next requests are only told
+// the request is pending.
+func (aa *AccessApp) join(ctx context.Context, chatId int64) error {
+	loc := aa.locs.FromContext(ctx)
+	userID, chatID, found := subscriber(ctx)
+	if !found {
+		return nil
+	}
+	user := settings.TelegramUser{ID: userID, Name: subscriberName(ctx), ChatID: chatID}
+	status, created, err := aa.sm.RequestAccess(user)
+	if err != nil {
+		log.Printf("Error storing the join request of %s: %s\n", userID, err.Error())
+		message := loc.MustLocalize(&i18n.LocalizeConfig{
+			DefaultMessage: &i18n.Message{
+				ID:    "access.couldNotRequest",
+				Other: "Could not send the request. Try it again later",
+			},
+		})
+		msg := tgbotapi.NewMessage(chatId, message)
+		_, err := aa.bot.Send(msg)
+		return err
+	}
+	if created {
+		aa.notifyAdmins(user)
+	}
+
+	var message string
+	switch status {
+	case settings.AccessAllowed:
+		message = loc.MustLocalize(&i18n.LocalizeConfig{
+			DefaultMessage: &i18n.Message{
+				ID:    "access.alreadyMember",
+				Other: "You are a member already. You can see every server",
+			},
+		})
+	case settings.AccessDenied:
+		message = GetDeniedText(loc)
+	default:
+		message = loc.MustLocalize(&i18n.LocalizeConfig{
+			DefaultMessage: &i18n.Message{
+				ID:    "access.requestSent",
+				Other: "The admins got your request. You will be told when they answer it",
+			},
+		})
+	}
+	msg := tgbotapi.NewMessage(chatId, message)
+	_, err = aa.bot.Send(msg)
+	return err
+}
+
+// notifyAdmins sends the join request to every admin, in its language, with
+// the buttons to answer it.
+func (aa *AccessApp) notifyAdmins(user settings.TelegramUser) {
+	for _, adminID := range aa.sm.Admins() {
+		lang, err := aa.sm.StoredLanguage(adminID)
+		if err != nil {
+			log.Printf("Error reading the language of user %s: %s\n", adminID, err.Error())
+		}
+		loc := aa.locs.Get(lang)
+		message := loc.MustLocalize(&i18n.LocalizeConfig{
+			DefaultMessage: &i18n.Message{
+				ID:    "access.joinRequest",
+				Other: "%s (%s) asks to join",
+			},
+		})
+
+		chatId, _ := strconv.ParseInt(adminID, 10, 64)
+		msg := tgbotapi.NewMessage(chatId, fmt.Sprintf(message, user.Name, user.ID))
+		msg.ReplyMarkup = getAccessInlineKeyboard([]settings.TelegramUser{user}, loc)
+		_, err = aa.bot.Send(msg)
+		if err != nil {
+			// admins that never talked to the bot can not get messages
+			log.Printf("Error sending the join request of %s to admin %s: %s\n", user.ID, adminID, err.Error())
+		}
+	}
+}
+
+// sendRequests lists the pending join requests with the buttons to answer
+// them.
+func (aa *AccessApp) sendRequests(ctx context.Context, chatId int64) error {
+	loc := aa.locs.FromContext(ctx)
+	users, err := aa.sm.ListAccess(settings.AccessPending)
+	if err != nil {
+		log.Printf("Error listing the join requests: %s\n", err.Error())
+		return aa.sendCouldNotChangeAccess(chatId, loc)
+	}
+	if len(users) == 0 {
+		message := loc.MustLocalize(&i18n.LocalizeConfig{
+			DefaultMessage: &i18n.Message{
+				ID:    "access.noRequests",
+				Other: "There are no join requests",
+			},
+		})
+		msg := tgbotapi.NewMessage(chatId, message)
+		_, err := aa.bot.Send(msg)
+		return err
+	}
+
+	lines := []string{}
+	for _, user := range users {
+		lines = append(lines, fmt.Sprintf("‣ %s (%s)", user.Name, user.ID))
+	}
+	message := loc.MustLocalize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{
+			ID:    "access.requests",
+			Other: "Join requests:\n\n%s\n\nAnswer them with the buttons or with %s and %s followed by the ID",
+		},
+	})
+	msg := tgbotapi.NewMessage(chatId, fmt.Sprintf(message, strings.Join(lines, "\n"), CommandApprove, CommandDeny))
+	msg.ReplyMarkup = getAccessInlineKeyboard(users, loc)
+	_, err = aa.bot.Send(msg)
+	return err
+}
+
+// setAccess stores the access of the user and tells the user about it.
+func (aa *AccessApp) setAccess(userID, status string) (settings.TelegramUser, error) {
+	user, err := aa.sm.SetAccess(userID, status)
+	if err != nil {
+		log.Printf("Error changing the access of user %s: %s\n", userID, err.Error())
+		return user, err
+	}
+
+	lang, err := aa.sm.StoredLanguage(user.ID)
+	if err != nil {
+		log.Printf("Error reading the language of user %s: %s\n", user.ID, err.Error())
+	}
+	loc := aa.locs.Get(lang)
+	message := loc.MustLocalize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{
+			ID:    "access.youWereApproved",
+			Other: "The admins approved your request. You can see every server now",
+		},
+	})
+	if status == settings.AccessDenied {
+		message = GetDeniedText(loc)
+	}
+	chatId, _ := strconv.ParseInt(user.ChatID, 10, 64)
+	_, err = aa.bot.Send(tgbotapi.NewMessage(chatId, message))
+	if err != nil {
+		// users approved beforehand may not have talked to the bot yet
+		log.Printf("Error telling user %s about its access: %s\n", user.ID, err.Error())
+	}
+	return user, nil
+}
+
+func (aa *AccessApp) sendInvalidUser(chatId int64, command string, loc *i18n.Localizer) error {
+	message := loc.MustLocalize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{
+			ID:    "access.invalidUser",
+			Other: "Use %s <user ID>. %s lists the IDs of the join requests",
+		},
+	})
+	msg := tgbotapi.NewMessage(chatId, fmt.Sprintf(message, command, CommandRequests))
+	_, err := aa.bot.Send(msg)
+	return err
+}
+
+func (aa *AccessApp) sendCouldNotChangeAccess(chatId int64, loc *i18n.Localizer) error {
+	message := loc.MustLocalize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{
+			ID:    "access.couldNotChange",
+			Other: "Could not read or change the access of the users",
+		},
+	})
+	msg := tgbotapi.NewMessage(chatId, message)
+	_, err := aa.bot.Send(msg)
+	return err
+}
+
+func accessChangedText(user settings.TelegramUser, status string, loc *i18n.Localizer) string {
+	if status == settings.AccessDenied {
+		message := loc.MustLocalize(&i18n.LocalizeConfig{
+			DefaultMessage: &i18n.Message{
+				ID:    "access.userDenied",
+				Other: "%s (%s) can not use the bot now",
+			},
+		})
+		return fmt.Sprintf(message, user.Name, user.ID)
+	}
+	message := loc.MustLocalize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{
+			ID:    "access.userApproved",
+			Other: "%s (%s) is a member now",
+		},
+	})
+	return fmt.Sprintf(message, user.Name, user.ID)
+}
+
+func getAccessInlineKeyboard(users []settings.TelegramUser, loc *i18n.Localizer) tgbotapi.InlineKeyboardMarkup {
+	approve := loc.MustLocalize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{
+			ID:    "access.approve",
+			Other: "Approve",
+		},
+	})
+	deny := loc.MustLocalize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{
+			ID:    "access.deny",
+			Other: "Deny",
+		},
+	})
+
+	rows := [][]tgbotapi.InlineKeyboardButton{}
+	for _, user := range users {
+		label := ""
+		if len(users) > 1 {
+			label = " " + user.Name
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(symbolApprove+" "+approve+label, fmt.Sprintf("%s:%s:%s", subcommandAccess, settings.AccessAllowed, user.ID)),
+			tgbotapi.NewInlineKeyboardButtonData(symbolDeny+" "+deny+label, fmt.Sprintf("%s:%s:%s", subcommandAccess, settings.AccessDenied, user.ID)),
+		))
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// subscriberName returns the name the admins see in the join requests: the
+// one of the user in private chats and the title of the group otherwise.
+func subscriberName(ctx context.Context) string {
+	if IsGroupChat(ctx) {
+		return ctx.Value(ChatContextKey).(*tgbotapi.Chat).Title
+	}
+	user := ctx.Value(UserContextKey).(*tgbotapi.User)
+	name := strings.TrimSpace(user.FirstName + " " + user.LastName)
+	if user.UserName != "" {
+		name += fmt.Sprintf(" (@%s)", user.UserName)
+	}
+	return name
+}
+
+// viewer returns the ID the access to the servers is checked with: the one of
+// the subscriber of the chat or, in inline queries, the one of the user.
+func viewer(ctx context.Context) string {
+	if userID, _, found := subscriber(ctx); found {
+		return userID
+	}
+	if user, ok := ctx.Value(UserContextKey).(*tgbotapi.User); ok {
+		return fmt.Sprintf("%d", user.ID)
+	}
+	return ""
+}
+
+// canSeeServer returns whether the chat of the context can see the server.
+// The members only servers are seen by the admins and the users and groups
+// they approved.
+func (la *LiveApp) canSeeServer(ctx context.Context, serverID string) bool {
+	return la.sm.CanSeeServer(viewer(ctx), serverID)
+}
+
+// visibleServers returns the servers the chat of the context can see, with
+// their latest names.
+func (la *LiveApp) visibleServers(ctx context.Context) []servers.Server {
+	ss := []servers.Server{}
+	for _, server := range la.listServers() {
+		if la.canSeeServer(ctx, server.ID) {
+			ss = append(ss, server)
+		}
+	}
+	return ss
+}
+
+// checkServerAccess wraps the handler of a server so the chats that can not
+// see the server are told to join instead.
+func (la *LiveApp) checkServerAccess(serverID string, handler func(ctx context.Context, chatId int64) error) func(ctx context.Context, chatId int64) error {
+	return func(ctx context.Context, chatId int64) error {
+		if la.canSeeServer(ctx, serverID) {
+			return handler(ctx, chatId)
+		}
+		return sendMembersOnly(la.bot, chatId, la.locs.FromContext(ctx))
+	}
+}
+
+// checkServerAccessCallback is checkServerAccess for the inline buttons.
+func (la *LiveApp) checkServerAccessCallback(serverID string, handler func(ctx context.Context, query *tgbotapi.CallbackQuery) error) func(ctx context.Context, query *tgbotapi.CallbackQuery) error {
+	return func(ctx context.Context, query *tgbotapi.CallbackQuery) error {
+		if la.canSeeServer(ctx, serverID) {
+			return handler(ctx, query)
+		}
+		_, err := la.bot.Request(tgbotapi.NewCallbackWithAlert(query.ID, getMembersOnlyText(la.locs.FromContext(ctx))))
+		return err
+	}
+}
+
+func sendMembersOnly(bot *tgbotapi.BotAPI, chatId int64, loc *i18n.Localizer) error {
+	msg := tgbotapi.NewMessage(chatId, getMembersOnlyText(loc))
+	_, err := bot.Send(msg)
+	return err
+}
+
+func getMembersOnlyText(loc *i18n.Localizer) string {
+	message := loc.MustLocalize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{
+			ID:    "access.membersOnly",
+			Other: "The server is only for the members. Ask the admins to join with %s",
+		},
+	})
+	return fmt.Sprintf(message, CommandJoin)
+}
+
+func getOnlyAdminsText(loc *i18n.Localizer) string {
+	return loc.MustLocalize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{
+			ID:    "access.onlyAdmins",
+			Other: "Only the admins of the bot can do it",
+		},
+	})
+}
+
+// GetDeniedText returns the message the users denied by the admins get.
+func GetDeniedText(loc *i18n.Localizer) string {
+	return loc.MustLocalize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{
+			ID:    "access.denied",
+			Other: "The admins denied you the use of the bot",
+		},
+	})
+}
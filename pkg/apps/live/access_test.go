@@ -0,0 +1,33 @@
+package live
+
+import (
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestAccessAppAcceptCallback(t *testing.T) {
+	tests := []struct {
+		data string
+		want bool
+	}{
+		{"access:allowed:1", true},
+		{"access:denied:1", true},
+		{"access:pending:1", false},
+		{"access:admin:1", false},
+		{"access:allowed", false},
+		{"access:allowed:1:2", false},
+		{"access", false},
+		{"", false},
+	}
+
+	aa := &AccessApp{}
+	for _, tt := range tests {
+		t.Run(tt.data, func(t *testing.T) {
+			got, _ := aa.AcceptCallback(&tgbotapi.CallbackQuery{Data: tt.data})
+			if got != tt.want {
+				t.Errorf("got %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
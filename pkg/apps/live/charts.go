@@ -0,0 +1,107 @@
+package live
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/charts"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+const (
+	subcommandShowChart = "show_chart"
+
+	// the chart types are short to fit the callback data
+	chartLapTimes  = "laps"
+	chartPositions = "pos"
+	chartGap       = "gap"
+)
+
+// sendChart renders the chart of the session history and sends it as a photo.
+// The lap times chart is for the driver, the rest are for the whole field.
+func (sa *StintApp) sendChart(chatId int64, chartType, driverID string, loc *i18n.Localizer) error {
+	sa.mu.Lock()
+	history := sa.liveStandingHistoryData
+	sa.mu.Unlock()
+
+	labels := charts.Labels{
+		Lap: loc.MustLocalize(&i18n.LocalizeConfig{
+			DefaultMessage: &i18n.Message{
+				ID:    "charts.lap",
+				Other: "Lap",
+			},
+		}),
+		Pit: loc.MustLocalize(&i18n.LocalizeConfig{
+			DefaultMessage: &i18n.Message{
+				ID:    "charts.pit",
+				Other: "- - Pit",
+			},
+		}),
+	}
+
+	var b []byte
+	var err error
+	laps := 0
+	switch chartType {
+	case chartLapTimes:
+		driver, found := driverByID(history, driverID)
+		if !found {
+			return sa.sendDriverNotFound(chatId, loc)
+		}
+		driverData := history.DriversData[driver]
+		laps = len(driverData)
+		title := loc.MustLocalize(&i18n.LocalizeConfig{
+			DefaultMessage: &i18n.Message{
+				ID:    "charts.lapTimesTitle",
+				Other: "Lap times of %s",
+			},
+		})
+		labels.Title = fmt.Sprintf(title, driver)
+		if laps > 0 {
+			b, err = charts.LapTimes(driverData, labels)
+		}
+	case chartPositions, chartGap:
+		for _, driverData := range history.DriversData {
+			if len(driverData) > laps {
+				laps = len(driverData)
+			}
+		}
+		if chartType == chartPositions {
+			labels.Title = getInlineKeyboardPositionsChart(loc)
+			if laps > 0 {
+				b, err = charts.Positions(history, labels)
+			}
+		} else {
+			labels.Title = getInlineKeyboardGapChart(loc)
+			if laps > 0 {
+				b, err = charts.GapToLeader(history, labels)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown chart type %q", chartType)
+	}
+
+	if laps == 0 {
+		message := loc.MustLocalize(&i18n.LocalizeConfig{
+			DefaultMessage: &i18n.Message{
+				ID:    "stint.noLapsInSession",
+				Other: "There are no laps in the session",
+			},
+		})
+
+		msg := tgbotapi.NewMessage(chatId, message)
+		_, err := sa.bot.Send(msg)
+		return err
+	}
+	if err != nil {
+		log.Printf("Error building chart %s: %s\n", chartType, err.Error())
+		return err
+	}
+
+	msg := tgbotapi.NewPhoto(chatId, tgbotapi.FileBytes{Name: "chart.png", Bytes: b})
+	msg.Caption = fmt.Sprintf("%s\n%s", history.ServerName, labels.Title)
+	_, err = sa.bot.Send(msg)
+	return err
+}
@@ -13,6 +13,15 @@ const (
 	symbolDiff     = "⏲️"
 	symbolOptimum  = "🚀"
 	symbolPhoto    = "📸"
+	symbolPrevious = "⬅️"
+	symbolNext     = "➡️"
+	symbolFollow   = "⭐"
+	symbolUnfollow = "✖️"
+	symbolLive     = "🔴"
+	symbolStop     = "⏹"
+	symbolChart    = "📈"
+	symbolCompare  = "⚔️"
+	symbolSwap     = "🔁"
 )
 
 func getInlineKeyboardTimes(loc *i18n.Localizer) string {
@@ -206,6 +215,126 @@ func getInlineKeyboardCar(loc *i18n.Localizer) string {
 	return msg
 }
 
+func getInlineKeyboardFollow(loc *i18n.Localizer) string {
+	msg := loc.MustLocalize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{
+			ID:    "apps.follow",
+			Other: "Follow",
+		},
+	})
+	return msg
+}
+
+func getInlineKeyboardUnfollow(loc *i18n.Localizer) string {
+	msg := loc.MustLocalize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{
+			ID:    "apps.unfollow",
+			Other: "Unfollow",
+		},
+	})
+	return msg
+}
+
+func getInlineKeyboardLiveFollow(loc *i18n.Localizer) string {
+	msg := loc.MustLocalize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{
+			ID:    "apps.liveFollow",
+			Other: "Live follow",
+		},
+	})
+	return msg
+}
+
+func getInlineKeyboardStopLiveFollow(loc *i18n.Localizer) string {
+	msg := loc.MustLocalize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{
+			ID:    "apps.stopLiveFollow",
+			Other: "Stop live follow",
+		},
+	})
+	return msg
+}
+
+func getInlineKeyboardSnapshot(loc *i18n.Localizer) string {
+	msg := loc.MustLocalize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{
+			ID:    "apps.snapshot",
+			Other: "Snapshot",
+		},
+	})
+	return msg
+}
+
+func getInlineKeyboardLapTimesChart(loc *i18n.Localizer) string {
+	msg := loc.MustLocalize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{
+			ID:    "apps.lapTimesChart",
+			Other: "Lap times chart",
+		},
+	})
+	return msg
+}
+
+func getInlineKeyboardPositionsChart(loc *i18n.Localizer) string {
+	msg := loc.MustLocalize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{
+			ID:    "apps.positionsChart",
+			Other: "Positions by lap",
+		},
+	})
+	return msg
+}
+
+func getInlineKeyboardGapChart(loc *i18n.Localizer) string {
+	msg := loc.MustLocalize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{
+			ID:    "apps.gapChart",
+			Other: "Gap to leader",
+		},
+	})
+	return msg
+}
+
+func getInlineKeyboardCompare(loc *i18n.Localizer) string {
+	msg := loc.MustLocalize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{
+			ID:    "apps.compare",
+			Other: "Compare",
+		},
+	})
+	return msg
+}
+
+func getInlineKeyboardSwap(loc *i18n.Localizer) string {
+	msg := loc.MustLocalize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{
+			ID:    "apps.swap",
+			Other: "Swap",
+		},
+	})
+	return msg
+}
+
+func getInlineKeyboardLanguage(loc *i18n.Localizer) string {
+	msg := loc.MustLocalize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{
+			ID:    "apps.language",
+			Other: "Language",
+		},
+	})
+	return msg
+}
+
+func getInlineKeyboardBack(loc *i18n.Localizer) string {
+	msg := loc.MustLocalize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{
+			ID:    "apps.back",
+			Other: "Back",
+		},
+	})
+	return msg
+}
+
 func getLapHeader(loc *i18n.Localizer) string {
 	msg := loc.MustLocalize(&i18n.LocalizeConfig{
 		DefaultMessage: &i18n.Message{
@@ -266,6 +395,16 @@ func getLastHeader(loc *i18n.Localizer) string {
 	return msg
 }
 
+func getGapHeader(loc *i18n.Localizer) string {
+	msg := loc.MustLocalize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{
+			ID:    "apps.headerGap",
+			Other: "Gap",
+		},
+	})
+	return msg
+}
+
 func getBestHeader(loc *i18n.Localizer) string {
 	msg := loc.MustLocalize(&i18n.LocalizeConfig{
 		DefaultMessage: &i18n.Message{
@@ -0,0 +1,244 @@
+package live
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/helper"
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/model"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+const (
+	// the drivers are sent as their ID in these callbacks, as two driver names
+	// may not fit the callback data
+	subcommandPickRival      = "compare_driver"
+	subcommandCompareDrivers = "compare_drivers"
+
+	compareTimes    = "t"
+	compareSectors  = "s"
+	compareTopSpeed = "v"
+)
+
+// driverByID returns the name of the driver of the session with the ID.
+func driverByID(history model.LiveStandingHistoryData, id string) (string, bool) {
+	for _, driver := range history.DriverNames {
+		if helper.ToID(driver) == id {
+			return driver, true
+		}
+	}
+	return "", false
+}
+
+// handlePickRivalCallbackQuery lists the other drivers of the session to
+// compare them with the driver.
+func (sa *StintApp) handlePickRivalCallbackQuery(chatId int64, messageId int, driverID string, loc *i18n.Localizer) error {
+	sa.mu.Lock()
+	history := sa.liveStandingHistoryData
+	sa.mu.Unlock()
+
+	driver, found := driverByID(history, driverID)
+	if !found {
+		return sa.sendDriverNotFound(chatId, loc)
+	}
+
+	buttons := [][]tgbotapi.InlineKeyboardButton{}
+	for _, rival := range history.DriverNames {
+		if rival == driver {
+			continue
+		}
+		if len(buttons) == 0 || len(buttons[len(buttons)-1]) == 2 {
+			buttons = append(buttons, []tgbotapi.InlineKeyboardButton{})
+		}
+		buttons[len(buttons)-1] = append(buttons[len(buttons)-1], tgbotapi.NewInlineKeyboardButtonData(rival, fmt.Sprintf("%s:%s:%s:%s:%s", subcommandCompareDrivers, sa.serverID, compareTimes, driverID, helper.ToID(rival))))
+	}
+	buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(getInlineKeyboardBack(loc), fmt.Sprintf("%s:%s:%s:%s", subcommandShowDrivers, sa.serverID, getInlineKeyboardTimes(loc), driver)),
+	))
+
+	message := loc.MustLocalize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{
+			ID:    "compare.chooseRival",
+			Other: "Choose the driver to compare with %s:",
+		},
+	})
+	if len(buttons) == 1 {
+		message = loc.MustLocalize(&i18n.LocalizeConfig{
+			DefaultMessage: &i18n.Message{
+				ID:    "compare.noRivals",
+				Other: "There are no other drivers to compare with %s",
+			},
+		})
+	}
+
+	msg := tgbotapi.NewEditMessageText(chatId, messageId, fmt.Sprintf(message, driver))
+	markup := tgbotapi.NewInlineKeyboardMarkup(buttons...)
+	msg.ReplyMarkup = &markup
+	_, err := sa.bot.Send(msg)
+	return err
+}
+
+// handleCompareDriversCallbackQuery shows the laps of the two drivers side by
+// side.
+func (sa *StintApp) handleCompareDriversCallbackQuery(chatId int64, messageId int, view, driverID, rivalID string, loc *i18n.Localizer) error {
+	sa.mu.Lock()
+	history := sa.liveStandingHistoryData
+	remainingTime := helper.SecondsToHoursAndMinutes(sa.liveSessionInfoData.SessionInfo.EndEventTime - sa.liveSessionInfoData.SessionInfo.CurrentEventTime)
+	sa.mu.Unlock()
+
+	driver, found := driverByID(history, driverID)
+	rival, rivalFound := driverByID(history, rivalID)
+	if !found || !rivalFound {
+		return sa.sendDriverNotFound(chatId, loc)
+	}
+
+	message := loc.MustLocalize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{
+			ID:    "compare.sessionData",
+			Other: "```\nTime left: %s\n%s (%s) vs %s (%s) in %q\nNegative deltas are in favor of %s\n\n%s```",
+		},
+	})
+	tableText := buildCompareTable(history.DriversData[driver], history.DriversData[rival], helper.GetDriverCodeName(driver), helper.GetDriverCodeName(rival), view, loc)
+	text := fmt.Sprintf(message, remainingTime, driver, helper.GetDriverCodeName(driver), rival, helper.GetDriverCodeName(rival), history.ServerName, helper.GetDriverCodeName(driver), tableText)
+
+	msg := tgbotapi.NewEditMessageText(chatId, messageId, text)
+	msg.ParseMode = tgbotapi.ModeMarkdownV2
+	keyboard := getCompareInlineKeyboard(sa.serverID, driver, driverID, rivalID, view, loc)
+	msg.ReplyMarkup = &keyboard
+	_, err := sa.bot.Send(msg)
+	return err
+}
+
+func (sa *StintApp) sendDriverNotFound(chatId int64, loc *i18n.Localizer) error {
+	message := loc.MustLocalize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{
+			ID:    "compare.driverNotFound",
+			Other: "The driver is no longer in the session",
+		},
+	})
+
+	msg := tgbotapi.NewMessage(chatId, message)
+	_, err := sa.bot.Send(msg)
+	return err
+}
+
+// buildCompareTable renders the laps of the two drivers for the given view.
+// The deltas are the time of the driver minus the time of the rival and the
+// gap adds up the deltas of the laps both drivers completed with time, so out
+// laps and invalid laps do not hide the pace of the rest.
+func buildCompareTable(driverData, rivalData []model.StandingHistoryDriverData, driverCode, rivalCode, view string, loc *i18n.Localizer) string {
+	var b bytes.Buffer
+	t := table.NewWriter()
+	t.SetOutputMirror(&b)
+	style := table.StyleRounded
+	style.Options.DrawBorder = false
+	t.SetStyle(style)
+	t.AppendSeparator()
+	switch view {
+	case compareTimes:
+		t.AppendHeader(table.Row{getLapHeader(loc), driverCode, rivalCode, "Δ", getGapHeader(loc)})
+	case compareSectors:
+		t.AppendHeader(table.Row{getLapHeader(loc), "ΔS1", "ΔS2", "ΔS3"})
+	case compareTopSpeed:
+		t.AppendHeader(table.Row{getLapHeader(loc), driverCode, rivalCode, "Δ"})
+	}
+
+	laps := len(driverData)
+	if len(rivalData) > laps {
+		laps = len(rivalData)
+	}
+	// the gap is not known until both drivers complete a lap with time
+	gap := math.NaN()
+	for idx := 0; idx < laps; idx++ {
+		var lap, rivalLap model.StandingHistoryDriverData
+		if idx < len(driverData) {
+			lap = driverData[idx]
+		}
+		if idx < len(rivalData) {
+			rivalLap = rivalData[idx]
+		}
+		lapNumber := fmt.Sprintf("%d", idx+1)
+		switch view {
+		case compareTimes:
+			delta := lapDelta(lap.LapTime, rivalLap.LapTime)
+			if math.IsNaN(gap) {
+				gap = delta
+			} else if !math.IsNaN(delta) {
+				gap += delta
+			}
+			t.AppendRow([]interface{}{
+				lapNumber,
+				helper.SecondsToMinutes(lap.LapTime),
+				helper.SecondsToMinutes(rivalLap.LapTime),
+				formatDelta(delta),
+				formatDelta(gap),
+			})
+		case compareSectors:
+			s1, s2, s3 := lapSectors(lap)
+			rs1, rs2, rs3 := lapSectors(rivalLap)
+			t.AppendRow([]interface{}{
+				lapNumber,
+				formatDelta(lapDelta(s1, rs1)),
+				formatDelta(lapDelta(s2, rs2)),
+				formatDelta(lapDelta(s3, rs3)),
+			})
+		case compareTopSpeed:
+			t.AppendRow([]interface{}{
+				lapNumber,
+				formatTopSpeed(lap),
+				formatTopSpeed(rivalLap),
+				formatSpeedDelta(lap, rivalLap),
+			})
+		}
+	}
+	t.Render()
+	return b.String()
+}
+
+// lapDelta returns NaN when any of the times is not known.
+func lapDelta(t, rivalT float64) float64 {
+	if t <= 0.0 || rivalT <= 0.0 {
+		return math.NaN()
+	}
+	return t - rivalT
+}
+
+func formatDelta(delta float64) string {
+	if math.IsNaN(delta) {
+		return "-"
+	}
+	return fmt.Sprintf("%+.3f", delta)
+}
+
+func formatTopSpeed(lap model.StandingHistoryDriverData) string {
+	if lap.TopSpeed <= 0 || lap.LapTime <= 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f", lap.TopSpeed)
+}
+
+func formatSpeedDelta(lap, rivalLap model.StandingHistoryDriverData) string {
+	if formatTopSpeed(lap) == "-" || formatTopSpeed(rivalLap) == "-" {
+		return "-"
+	}
+	return fmt.Sprintf("%+.1f", lap.TopSpeed-rivalLap.TopSpeed)
+}
+
+func getCompareInlineKeyboard(serverID, driver, driverID, rivalID, view string, loc *i18n.Localizer) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(getInlineKeyboardTimes(loc)+" "+symbolTimes, fmt.Sprintf("%s:%s:%s:%s:%s", subcommandCompareDrivers, serverID, compareTimes, driverID, rivalID)),
+			tgbotapi.NewInlineKeyboardButtonData(getInlineKeyboardSectors(loc)+" "+symbolSectors, fmt.Sprintf("%s:%s:%s:%s:%s", subcommandCompareDrivers, serverID, compareSectors, driverID, rivalID)),
+			tgbotapi.NewInlineKeyboardButtonData(getTopSpeedHeader(loc)+" "+symbolOptimum, fmt.Sprintf("%s:%s:%s:%s:%s", subcommandCompareDrivers, serverID, compareTopSpeed, driverID, rivalID)),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(getInlineKeyboardUpdate(loc)+" "+symbolUpdate, fmt.Sprintf("%s:%s:%s:%s:%s", subcommandCompareDrivers, serverID, view, driverID, rivalID)),
+			tgbotapi.NewInlineKeyboardButtonData(getInlineKeyboardSwap(loc)+" "+symbolSwap, fmt.Sprintf("%s:%s:%s:%s:%s", subcommandCompareDrivers, serverID, view, rivalID, driverID)),
+			tgbotapi.NewInlineKeyboardButtonData(getInlineKeyboardBack(loc), fmt.Sprintf("%s:%s:%s:%s", subcommandShowDrivers, serverID, getInlineKeyboardTimes(loc), driver)),
+		),
+	)
+}
@@ -3,15 +3,20 @@ package live
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/oscar-martin/rfactor2telegrambot/pkg/helper"
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/layout"
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/locale"
 	"github.com/oscar-martin/rfactor2telegrambot/pkg/menus"
 	"github.com/oscar-martin/rfactor2telegrambot/pkg/model"
 	"github.com/oscar-martin/rfactor2telegrambot/pkg/pubsub"
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/resources"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/jedib0t/go-pretty/v6/table"
@@ -20,37 +25,96 @@ import (
 
 const (
 	subcommandShowLiveTiming = "show_live_timing"
+
+	subcommandShowSnapshot = "show_snapshot"
+
+	subcommandStartLiveFollow = "start_live_follow"
+	subcommandStopLiveFollow  = "stop_live_follow"
+
+	// edits are spaced to stay within the Telegram limits for groups (20
+	// messages per minute)
+	liveFollowInterval = 5 * time.Second
+	liveFollowTimeout  = 30 * time.Minute
+
+	sector1 = "SECTOR1"
+	sector2 = "SECTOR2"
+	sector3 = "SECTOR3"
 )
 
+// gridViews are the views of the grid command by name. The info types are the
+// texts of the grid buttons, which change with the language, so the command
+// takes these names instead.
+var gridViews = map[string]func(loc *i18n.Localizer) string{
+	"best":           getInlineKeyboardBestLap,
+	"bestsectors":    getInlineKeyboardBestLapSectors,
+	"last":           getInlineKeyboardLastLap,
+	"lastsectors":    getInlineKeyboardLastLapSectors,
+	"optimum":        getInlineKeyboardOptimumLap,
+	"optimumsectors": getInlineKeyboardOptimumLapSectors,
+	"status":         getInlineKeyboardStatus,
+	"info":           getInlineKeyboardInfo,
+	"diff":           getInlineKeyboardDiff,
+}
+
+// liveFollow is a grid message that is edited with the latest standing until
+// the session ends or the follow times out.
+type liveFollow struct {
+	messageID int
+	infoType  string
+	session   string
+	text      string
+	startedAt time.Time
+	nextEdit  time.Time
+	// the message is in the language of the user that started the follow
+	loc *i18n.Localizer
+}
+
 type GridApp struct {
 	bot                        *tgbotapi.BotAPI
 	appMenu                    menus.ApplicationMenu
 	serverID                   string
 	liveStandingData           model.LiveStandingData
 	liveStandingDataUpdateChan <-chan model.LiveStandingData
-	appName                    string
+	appName                    func(loc *i18n.Localizer) string
 
 	liveSessionInfoData           model.LiveSessionInfoData
 	liveSessionInfoDataUpdateChan <-chan model.LiveSessionInfoData
 
-	loc *i18n.Localizer
+	// the track of the session is drawn on the snapshots
+	serverURL                    string
+	trackThumbnailData           resources.Resource
+	trackThumbnailDataUpdateChan <-chan resources.Resource
+	// lap distances where the sectors 2 and 3 of the track start, learned from
+	// the cars entering them and drawn on the snapshots
+	sectorStarts [2]float64
+	sectorsTrack string
+
+	// live follows by chat ID. The updater only runs while there are follows
+	liveFollows       map[int64]*liveFollow
+	liveFollowRunning bool
+
+	locs *locale.Localizers
 
 	mu sync.Mutex
 }
 
-func NewGridApp(bot *tgbotapi.BotAPI, appMenu menus.ApplicationMenu, serverID string, appName string, loc *i18n.Localizer) *GridApp {
+func NewGridApp(bot *tgbotapi.BotAPI, appMenu menus.ApplicationMenu, serverID, serverURL string, appName func(loc *i18n.Localizer) string, locs *locale.Localizers) *GridApp {
 	ga := &GridApp{
 		bot:                           bot,
 		appMenu:                       appMenu,
 		serverID:                      serverID,
-		loc:                           loc,
+		serverURL:                     serverURL,
+		locs:                          locs,
 		appName:                       appName,
+		liveFollows:                   map[int64]*liveFollow{},
 		liveStandingDataUpdateChan:    pubsub.LiveStandingDataPubSub.Subscribe(pubsub.PubSubDriversSessionPreffix + serverID),
 		liveSessionInfoDataUpdateChan: pubsub.LiveSessionInfoDataPubSub.Subscribe(pubsub.PubSubSessionInfoPreffix + serverID),
+		trackThumbnailDataUpdateChan:  pubsub.TrackThumbnailPubSub.Subscribe(pubsub.PubSubThumbnailPreffix + serverID),
 	}
 
 	go ga.liveStandingDataUpdater()
 	go ga.liveSessionInfoDataUpdater()
+	go ga.trackThumbnailUpdater()
 
 	return ga
 }
@@ -67,24 +131,74 @@ func (ga *GridApp) liveSessionInfoDataUpdater() {
 	}
 }
 
+func (ga *GridApp) trackThumbnailUpdater() {
+	for t := range ga.trackThumbnailDataUpdateChan {
+		ga.mu.Lock()
+		ga.trackThumbnailData = t
+		ga.mu.Unlock()
+	}
+}
+
 func (ga *GridApp) update(lsd model.LiveStandingData, lsi model.LiveSessionInfoData) {
 	ga.mu.Lock()
 	defer ga.mu.Unlock()
+	if track := lsi.SessionInfo.TrackName; track != "" && track != ga.sectorsTrack {
+		ga.sectorsTrack = track
+		ga.sectorStarts = [2]float64{}
+	}
+	ga.learnSectorStarts(ga.liveStandingData.Drivers, lsd.Drivers)
 	ga.liveStandingData = lsd
 	ga.liveSessionInfoData = lsi
 }
 
+// learnSectorStarts keeps the lowest lap distance where a car was seen right
+// after entering the sectors 2 and 3, which is the closest one to where they
+// start. It must be called with the lock held.
+func (ga *GridApp) learnSectorStarts(prev, curr []model.StandingDriverData) {
+	prevDrivers := map[string]model.StandingDriverData{}
+	for _, d := range prev {
+		prevDrivers[d.DriverName] = d
+	}
+	for _, d := range curr {
+		p, found := prevDrivers[d.DriverName]
+		if !found || p.LapDistance >= d.LapDistance {
+			continue
+		}
+		i := -1
+		if p.Sector == sector1 && d.Sector == sector2 {
+			i = 0
+		} else if p.Sector == sector2 && d.Sector == sector3 {
+			i = 1
+		}
+		if i >= 0 && (ga.sectorStarts[i] == 0.0 || d.LapDistance < ga.sectorStarts[i]) {
+			ga.sectorStarts[i] = d.LapDistance
+		}
+	}
+}
+
 func (ga *GridApp) AcceptCommand(command string) (bool, func(ctx context.Context, chatId int64) error) {
 	return false, nil
 }
 
 func (ga *GridApp) AcceptCallback(query *tgbotapi.CallbackQuery) (bool, func(ctx context.Context, query *tgbotapi.CallbackQuery) error) {
 	data := strings.Split(query.Data, ":")
-	if data[0] == subcommandShowLiveTiming && data[1] == ga.serverID {
+	if data[0] == subcommandShowLiveTiming && len(data) == 3 && data[1] == ga.serverID {
 		ga.mu.Lock()
 		defer ga.mu.Unlock()
 		return true, func(ctx context.Context, query *tgbotapi.CallbackQuery) error {
-			return ga.handleSessionDataCallbackQuery(query.Message.Chat.ID, &query.Message.MessageID, data[2:]...)
+			return ga.handleSessionDataCallbackQuery(query.Message.Chat.ID, &query.Message.MessageID, ga.locs.FromContext(ctx), data[2:]...)
+		}
+	} else if data[0] == subcommandShowSnapshot && len(data) == 2 && data[1] == ga.serverID {
+		return true, func(ctx context.Context, query *tgbotapi.CallbackQuery) error {
+			return ga.sendSnapshot(ctx, query.Message.Chat.ID)
+		}
+	} else if data[0] == subcommandStartLiveFollow && len(data) == 3 && data[1] == ga.serverID {
+		return true, func(ctx context.Context, query *tgbotapi.CallbackQuery) error {
+			return ga.startLiveFollow(query.Message.Chat.ID, query.Message.MessageID, data[2], ga.locs.FromContext(ctx))
+		}
+	} else if data[0] == subcommandStopLiveFollow && len(data) == 2 && data[1] == ga.serverID {
+		return true, func(ctx context.Context, query *tgbotapi.CallbackQuery) error {
+			return ga.stopLiveFollow(query.Message.Chat.ID, query.Message.MessageID, ga.locs.FromContext(ctx))
 		}
 	}
 	return false, nil
@@ -95,12 +209,13 @@ func (ga *GridApp) AcceptButton(button string) (bool, func(ctx context.Context,
 	defer ga.mu.Unlock()
 
 	// fmt.Printf("GRID: button: %s. appName: %s\n", button, buttonGrid+" "+ga.driversSession.ServerName)
-	if button == ga.appName+" "+ga.liveStandingData.ServerName {
-		return true, ga.renderGrid()
-	} else if button == ga.appMenu.ButtonBackTo() {
+	serverName := ga.liveStandingData.ServerName
+	if ga.locs.Matches(button, func(loc *i18n.Localizer) string { return ga.appName(loc) + " " + serverName }) {
+		return true, ga.renderGrid(getInlineKeyboardBestLap)
+	} else if ga.appMenu.IsButtonBackTo(button) {
 		return true, func(ctx context.Context, chatId int64) error {
 			msg := tgbotapi.NewMessage(chatId, "OK")
-			msg.ReplyMarkup = ga.appMenu.PrevMenu()
+			msg.ReplyMarkup = ga.appMenu.PrevMenu(ctx)
 			_, err := ga.bot.Send(msg)
 			return err
 		}
@@ -109,9 +224,10 @@ func (ga *GridApp) AcceptButton(button string) (bool, func(ctx context.Context,
 	return false, nil
 }
 
-func (ga *GridApp) renderGrid() func(ctx context.Context, chatId int64) error {
+func (ga *GridApp) renderGrid(view func(loc *i18n.Localizer) string) func(ctx context.Context, chatId int64) error {
 	return func(ctx context.Context, chatId int64) error {
-		err := ga.sendSessionData(chatId, nil, ga.liveStandingData, getInlineKeyboardBestLap(ga.loc))
+		loc := ga.locs.FromContext(ctx)
+		err := ga.sendSessionData(chatId, nil, ga.liveStandingData, view(loc), false, loc)
 		if err != nil {
 			log.Printf("An error occured: %s", err.Error())
 		}
@@ -119,179 +235,27 @@ func (ga *GridApp) renderGrid() func(ctx context.Context, chatId int64) error {
 	}
 }
 
-func (ga *GridApp) handleSessionDataCallbackQuery(chatId int64, messageId *int, data ...string) error {
+func (ga *GridApp) handleSessionDataCallbackQuery(chatId int64, messageId *int, loc *i18n.Localizer, data ...string) error {
 	infoType := data[0]
-	return ga.sendSessionData(chatId, messageId, ga.liveStandingData, infoType)
-}
 
-func (ga *GridApp) sendSessionData(chatId int64, messageId *int, driversSession model.LiveStandingData, infoType string) error {
-	if len(driversSession.Drivers) > 0 {
-		var b bytes.Buffer
-		t := table.NewWriter()
-		t.SetOutputMirror(&b)
-		style := table.StyleRounded
-		style.Options.DrawBorder = false
-		t.SetStyle(style)
-		t.AppendSeparator()
+	// a live message keeps being updated with the new info type
+	ga.mu.Lock()
+	lf, following := ga.liveFollows[chatId]
+	following = following && lf.messageID == *messageId
+	if following {
+		lf.infoType = infoType
+		lf.loc = loc
+	}
+	ga.mu.Unlock()
 
-		switch infoType {
-		case getInlineKeyboardStatus(ga.loc):
-			t.AppendHeader(table.Row{getDriverHeader(ga.loc), getSectorsHeader(ga.loc), "S" /*, "FUEL"*/})
-		case getInlineKeyboardInfo(ga.loc):
-			t.AppendHeader(table.Row{getDriverHeader(ga.loc), getNameHeader(ga.loc) /*, "Núm"*/, getLapHeader(ga.loc)})
-		case getInlineKeyboardLastLap(ga.loc):
-			t.AppendHeader(table.Row{getDriverHeader(ga.loc), getLastHeader(ga.loc), getBestHeader(ga.loc)})
-		case getInlineKeyboardOptimumLap(ga.loc):
-			t.AppendHeader(table.Row{getDriverHeader(ga.loc), getOptimalHeader(ga.loc), getBestHeader(ga.loc)})
-		case getInlineKeyboardBestLap(ga.loc):
-			t.AppendHeader(table.Row{getDriverHeader(ga.loc), getBestHeader(ga.loc), getTopSpeedHeader(ga.loc)})
-		default:
-			t.AppendHeader(table.Row{getDriverHeader(ga.loc), infoType})
-		}
-		for idx, driverStat := range driversSession.Drivers {
-			switch infoType {
-			case getInlineKeyboardStatus(ga.loc):
-				// state := "🟢"
-				state := ""
-				if driverStat.InGarageStall {
-					state = "P"
-					// state = "🔴"
-				} else if driverStat.Pitting {
-					state = "P"
-					// state = "🟡"
-				}
-				var s1 float64
-				s2 := -1.0
-				s3 := -1.0
-				if driverStat.CurrentSectorTime1 > 0.0 {
-					// s1 is done in current lap
-					s1 = driverStat.CurrentSectorTime1
-					if s1 > 0.0 && driverStat.CurrentSectorTime2 > 0.0 {
-						// s2 is done in current lap
-						s2 = driverStat.CurrentSectorTime2 - s1
-					}
-				} else {
-					s1 = driverStat.LastSectorTime1
-					if s1 > 0.0 && driverStat.LastSectorTime2 > 0.0 {
-						s2 = driverStat.LastSectorTime2 - s1
-					}
-					if s2 > 0.0 && driverStat.LastLapTime > 0.0 {
-						s3 = driverStat.LastLapTime - s2 - s1
-					}
-				}
-				t.AppendRow([]interface{}{
-					helper.GetDriverCodeName(driverStat.DriverName),
-					fmt.Sprintf("%s %s %s", helper.ToSectorTime(s1), helper.ToSectorTime(s2), helper.ToSectorTime(s3)),
-					// fmt.Sprintf("%.0f%%", driverStat.FuelFraction*100),
-					state,
-				})
-			case getInlineKeyboardInfo(ga.loc):
-				t.AppendRow([]interface{}{
-					helper.GetDriverCodeName(driverStat.DriverName),
-					driverStat.DriverName,
-					// driverStat.CarNumber,
-					driverStat.LapsCompleted,
-				})
-			case getInlineKeyboardDiff(ga.loc):
-				diff := ""
-				if idx == 0 {
-					diff = helper.SecondsToMinutes(driverStat.BestLapTime)
-				} else {
-					diff = helper.SecondsToDiff(driverStat.BestLapTime - driversSession.Drivers[0].BestLapTime)
-				}
-				t.AppendRow([]interface{}{
-					helper.GetDriverCodeName(driverStat.DriverName),
-					diff,
-				})
-			case getInlineKeyboardBestLap(ga.loc):
-				topSpeed := "-"
-				if driverStat.BestLap > 0 {
-					kph, found := driverStat.TopSpeedPerLap[driverStat.BestLap]
-					if found {
-						topSpeed = fmt.Sprintf("%.1f km/h", kph)
-					}
-				}
-				// fmt.Printf("Driver: %s\n   BestLap: %d\n   Data: %+v\n   Top Speed: %s\n", driverStat.DriverName, driverStat.BestLap, driverStat.TopSpeedPerLap, topSpeed)
-				t.AppendRow([]interface{}{
-					helper.GetDriverCodeName(driverStat.DriverName),
-					helper.SecondsToMinutes(driverStat.BestLapTime),
-					topSpeed,
-				})
-			case getInlineKeyboardLastLap(ga.loc):
-				t.AppendRow([]interface{}{
-					helper.GetDriverCodeName(driverStat.DriverName),
-					helper.SecondsToMinutes(driverStat.LastLapTime),
-					helper.SecondsToMinutes(driverStat.BestLapTime),
-				})
-			case getInlineKeyboardOptimumLap(ga.loc):
-				optimumLap := -1.0
-				if driverStat.BestSectorTime1 > 0.0 && driverStat.BestSectorTime2 > 0.0 && driverStat.BestSectorTime3 > 0.0 {
-					optimumLap = driverStat.BestSectorTime1 + driverStat.BestSectorTime2 + driverStat.BestSectorTime3
-				}
-				t.AppendRow([]interface{}{
-					helper.GetDriverCodeName(driverStat.DriverName),
-					helper.SecondsToMinutes(optimumLap),
-					helper.SecondsToMinutes(driverStat.BestLapTime),
-				})
-			case getInlineKeyboardOptimumLapSectors(ga.loc):
-				ls1 := driverStat.BestSectorTime1
-				ls2 := driverStat.BestSectorTime2
-				ls3 := driverStat.BestSectorTime3
-				t.AppendRow([]interface{}{
-					helper.GetDriverCodeName(driverStat.DriverName),
-					fmt.Sprintf("%s %s %s", helper.ToSectorTime(ls1), helper.ToSectorTime(ls2), helper.ToSectorTime(ls3)),
-				})
-			case getInlineKeyboardBestLapSectors(ga.loc):
-				bs1 := driverStat.BestLapSectorTime1
-				bs2 := -1.0
-				if bs1 > 0.0 {
-					bs2 = driverStat.BestLapSectorTime2 - bs1
-				}
-				bs3 := -1.0
-				if bs2 > 0.0 && driverStat.BestLapTime > 0.0 {
-					bs3 = driverStat.BestLapTime - bs2 - bs1
-				}
-				t.AppendRow([]interface{}{
-					helper.GetDriverCodeName(driverStat.DriverName),
-					fmt.Sprintf("%s %s %s", helper.ToSectorTime(bs1), helper.ToSectorTime(bs2), helper.ToSectorTime(bs3)),
-				})
-			case getInlineKeyboardLastLapSectors(ga.loc):
-				ls1 := driverStat.LastSectorTime1
-				ls2 := -1.0
-				if ls1 > 0.0 && driverStat.LastSectorTime2 > 0.0 {
-					ls2 = driverStat.LastSectorTime2 - ls1
-				}
-				ls3 := -1.0
-				if ls2 > 0.0 && driverStat.LastLapTime > 0.0 {
-					ls3 = driverStat.LastLapTime - ls2 - ls1
-				}
-				t.AppendRow([]interface{}{
-					helper.GetDriverCodeName(driverStat.DriverName),
-					fmt.Sprintf("%s %s %s", helper.ToSectorTime(ls1), helper.ToSectorTime(ls2), helper.ToSectorTime(ls3)),
-				})
-			case getInlineKeyboardLaps(ga.loc):
-				t.AppendRow([]interface{}{
-					helper.GetDriverCodeName(driverStat.DriverName),
-					fmt.Sprintf("%d", driverStat.LapsCompleted),
-				})
-			case getInlineKeyboardTeam(ga.loc):
-				t.AppendRow([]interface{}{
-					helper.GetDriverCodeName(driverStat.DriverName),
-					driverStat.CarClass,
-				})
-			case getInlineKeyboardDriver(ga.loc):
-				t.AppendRow([]interface{}{
-					helper.GetDriverCodeName(driverStat.DriverName),
-					driverStat.DriverName,
-				})
-			}
-		}
-		t.Render()
+	return ga.sendSessionData(chatId, messageId, ga.liveStandingData, infoType, following, loc)
+}
 
-		keyboard := getGridInlineKeyboard(driversSession.ServerID, fmt.Sprintf("%s%s/live", ga.liveSessionInfoData.SessionInfo.LiveMapDomain, ga.liveSessionInfoData.SessionInfo.LiveMapPath), ga.loc)
+func (ga *GridApp) sendSessionData(chatId int64, messageId *int, driversSession model.LiveStandingData, infoType string, following bool, loc *i18n.Localizer) error {
+	if len(driversSession.Drivers) > 0 {
+		keyboard := getGridInlineKeyboard(driversSession.ServerID, getLiveMapURL(ga.liveSessionInfoData), infoType, following, loc)
 		var cfg tgbotapi.Chattable
-		remainingTime := helper.SecondsToHoursAndMinutes(ga.liveSessionInfoData.SessionInfo.EndEventTime - ga.liveSessionInfoData.SessionInfo.CurrentEventTime)
-		text := fmt.Sprintf("```\nTime left: %s\nServer: %q\n\n%s```", remainingTime, driversSession.ServerName, b.String())
+		text := buildSessionDataText(driversSession, ga.liveSessionInfoData, infoType, loc)
 		if messageId == nil {
 			msg := tgbotapi.NewMessage(chatId, text)
 			msg.ParseMode = tgbotapi.ModeMarkdownV2
@@ -306,14 +270,455 @@ func (ga *GridApp) sendSessionData(chatId int64, messageId *int, driversSession
 		_, err := ga.bot.Send(cfg)
 		return err
 	} else {
-		message := "There are no drivers in the session"
+		message := loc.MustLocalize(&i18n.LocalizeConfig{
+			DefaultMessage: &i18n.Message{
+				ID:    "stint.noDriversInSession",
+				Other: "There are no drivers in the session",
+			},
+		})
 		msg := tgbotapi.NewMessage(chatId, message)
 		_, err := ga.bot.Send(msg)
 		return err
 	}
 }
 
-func getGridInlineKeyboard(serverID, liveMapUrl string, loc *i18n.Localizer) tgbotapi.InlineKeyboardMarkup {
+// sendSnapshot sends an image of the track with the cars where they are now.
+func (ga *GridApp) sendSnapshot(ctx context.Context, chatId int64) error {
+	ga.mu.Lock()
+	lsd := ga.liveStandingData
+	si := ga.liveSessionInfoData.SessionInfo
+	liveMapURL := getLiveMapURL(ga.liveSessionInfoData)
+	serverURL := ga.serverURL
+	trackID := ga.trackThumbnailData.ID()
+	// the sectors are only drawn once a car entered them
+	sectors := layout.Sectors{}
+	if si.LapDistance > 0.0 {
+		for i, start := range ga.sectorStarts {
+			sectors[i] = start / si.LapDistance
+		}
+	}
+	ga.mu.Unlock()
+
+	var aiw layout.AIW
+	err := fmt.Errorf("no track for the session")
+	if trackID != "" {
+		aiw, err = resources.TrackLayout(ctx, serverURL, trackID)
+	}
+	if err != nil {
+		log.Printf("Error getting track layout: %s\n", err.Error())
+		text := ga.locs.FromContext(ctx).MustLocalize(&i18n.LocalizeConfig{
+			DefaultMessage: &i18n.Message{
+				ID:    "livemap.trackMapNotAvailable",
+				Other: "The track map is not yet available",
+			},
+		})
+		_, err = ga.bot.Send(tgbotapi.NewMessage(chatId, text))
+		return err
+	}
+
+	// the leader is drawn the last so it is on top
+	cars := []layout.SnapshotCar{}
+	for i := len(lsd.Drivers) - 1; i >= 0; i-- {
+		driver := lsd.Drivers[i]
+		cars = append(cars, layout.SnapshotCar{
+			X:      driver.CarPosition.X,
+			Z:      driver.CarPosition.Z,
+			Code:   helper.GetDriverCodeName(driver.DriverName),
+			Leader: i == 0,
+		})
+	}
+	b, err := layout.BuildSnapshotPNG(aiw, sectors, cars)
+	if err != nil {
+		log.Printf("Error building snapshot: %s\n", err.Error())
+		return err
+	}
+
+	msg := tgbotapi.NewPhoto(chatId, tgbotapi.FileBytes{Name: "snapshot.png", Bytes: b})
+	msg.Caption = fmt.Sprintf("%s\n%s - %s (%s)", lsd.ServerName, si.TrackName, si.Session, helper.SecondsToMinutes(si.CurrentEventTime))
+	if liveMapURL != "" {
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonURL(getInlineKeyboardLiveMap(ga.locs.FromContext(ctx)), liveMapURL),
+		))
+	}
+	_, err = ga.bot.Send(msg)
+	return err
+}
+
+func (ga *GridApp) startLiveFollow(chatId int64, messageId int, infoType string, loc *i18n.Localizer) error {
+	ga.mu.Lock()
+	if len(ga.liveStandingData.Drivers) == 0 {
+		ga.mu.Unlock()
+		message := loc.MustLocalize(&i18n.LocalizeConfig{
+			DefaultMessage: &i18n.Message{
+				ID:    "stint.noDriversInSession",
+				Other: "There are no drivers in the session",
+			},
+		})
+		msg := tgbotapi.NewMessage(chatId, message)
+		_, err := ga.bot.Send(msg)
+		return err
+	}
+	previous, found := ga.liveFollows[chatId]
+	ga.liveFollows[chatId] = &liveFollow{
+		messageID: messageId,
+		infoType:  infoType,
+		session:   ga.liveSessionInfoData.SessionInfo.Session,
+		startedAt: time.Now(),
+		loc:       loc,
+	}
+	startUpdater := !ga.liveFollowRunning
+	ga.liveFollowRunning = true
+	standing := ga.liveStandingData
+	ga.mu.Unlock()
+
+	// only one live message is kept per chat
+	if found && previous.messageID != messageId {
+		ga.endLiveFollow(chatId, *previous)
+	}
+	if startUpdater {
+		go ga.liveFollowUpdater()
+	}
+	err := ga.sendSessionData(chatId, &messageId, standing, infoType, true, loc)
+	if err != nil {
+		return err
+	}
+	// the bot needs the right to pin messages in groups, so the follow goes
+	// on without the pin when it does not have it
+	_, err = ga.bot.Request(tgbotapi.PinChatMessageConfig{ChatID: chatId, MessageID: messageId, DisableNotification: true})
+	if err != nil {
+		log.Printf("Error pinning live follow: %s", err.Error())
+	}
+	return nil
+}
+
+func (ga *GridApp) stopLiveFollow(chatId int64, messageId int, loc *i18n.Localizer) error {
+	ga.mu.Lock()
+	lf, found := ga.liveFollows[chatId]
+	if found && lf.messageID == messageId {
+		delete(ga.liveFollows, chatId)
+	}
+	ga.mu.Unlock()
+
+	if !found || lf.messageID != messageId {
+		lf = &liveFollow{messageID: messageId}
+	}
+	// the user stopping the follow may not be the one that started it
+	lf.loc = loc
+	return ga.endLiveFollow(chatId, *lf)
+}
+
+// endLiveFollow unpins the live message and restores its keyboard.
+func (ga *GridApp) endLiveFollow(chatId int64, lf liveFollow) error {
+	ga.unpinLiveFollow(chatId, lf.messageID)
+	return ga.restoreGridKeyboard(chatId, lf)
+}
+
+func (ga *GridApp) unpinLiveFollow(chatId int64, messageId int) {
+	_, err := ga.bot.Request(tgbotapi.UnpinChatMessageConfig{ChatID: chatId, MessageID: messageId})
+	if err != nil {
+		log.Printf("Error unpinning live follow: %s", err.Error())
+	}
+}
+
+// restoreGridKeyboard replaces the keyboard of a live message with the one of
+// a regular grid message.
+func (ga *GridApp) restoreGridKeyboard(chatId int64, lf liveFollow) error {
+	ga.mu.Lock()
+	liveMapURL := getLiveMapURL(ga.liveSessionInfoData)
+	ga.mu.Unlock()
+
+	infoType := lf.infoType
+	if infoType == "" {
+		infoType = getInlineKeyboardBestLap(lf.loc)
+	}
+	keyboard := getGridInlineKeyboard(ga.serverID, liveMapURL, infoType, false, lf.loc)
+	msg := tgbotapi.NewEditMessageReplyMarkup(chatId, lf.messageID, keyboard)
+	_, err := ga.bot.Send(msg)
+	if err != nil && !isMessageNotModified(err) {
+		return err
+	}
+	return nil
+}
+
+func (ga *GridApp) liveFollowUpdater() {
+	ticker := time.NewTicker(liveFollowInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ga.mu.Lock()
+		standing := ga.liveStandingData
+		sessionInfo := ga.liveSessionInfoData
+		follows := map[int64]liveFollow{}
+		for chatId, lf := range ga.liveFollows {
+			follows[chatId] = *lf
+		}
+		ga.mu.Unlock()
+
+		for chatId, lf := range follows {
+			ga.updateLiveFollow(chatId, lf, standing, sessionInfo)
+		}
+
+		ga.mu.Lock()
+		if len(ga.liveFollows) == 0 {
+			ga.liveFollowRunning = false
+			ga.mu.Unlock()
+			return
+		}
+		ga.mu.Unlock()
+	}
+}
+
+func (ga *GridApp) updateLiveFollow(chatId int64, lf liveFollow, standing model.LiveStandingData, sessionInfo model.LiveSessionInfoData) {
+	now := time.Now()
+	sessionEnded := len(standing.Drivers) == 0 || sessionInfo.SessionInfo.Session != lf.session
+	if sessionEnded || now.Sub(lf.startedAt) > liveFollowTimeout {
+		ga.mu.Lock()
+		current, found := ga.liveFollows[chatId]
+		if found && current.messageID == lf.messageID {
+			delete(ga.liveFollows, chatId)
+		}
+		ga.mu.Unlock()
+
+		err := ga.endLiveFollow(chatId, lf)
+		if err != nil {
+			log.Printf("Error stopping live follow: %s", err.Error())
+		}
+		return
+	}
+	if now.Before(lf.nextEdit) {
+		return
+	}
+
+	text := buildSessionDataText(standing, sessionInfo, lf.infoType, lf.loc)
+	if text == lf.text {
+		return
+	}
+	keyboard := getGridInlineKeyboard(standing.ServerID, getLiveMapURL(sessionInfo), lf.infoType, true, lf.loc)
+	msg := tgbotapi.NewEditMessageText(chatId, lf.messageID, text)
+	msg.ParseMode = tgbotapi.ModeMarkdownV2
+	msg.ReplyMarkup = &keyboard
+	_, err := ga.bot.Send(msg)
+
+	ga.mu.Lock()
+	defer ga.mu.Unlock()
+	current, found := ga.liveFollows[chatId]
+	if !found || current.messageID != lf.messageID {
+		// stopped or replaced while editing the message
+		return
+	}
+	var tgErr *tgbotapi.Error
+	switch {
+	case err == nil || isMessageNotModified(err):
+		current.text = text
+	case errors.As(err, &tgErr) && tgErr.RetryAfter > 0:
+		current.nextEdit = now.Add(time.Duration(tgErr.RetryAfter) * time.Second)
+	default:
+		// the message can not be edited anymore (i.e. it was deleted)
+		log.Printf("Error updating live follow: %s", err.Error())
+		delete(ga.liveFollows, chatId)
+		go ga.unpinLiveFollow(chatId, lf.messageID)
+	}
+}
+
+func isMessageNotModified(err error) bool {
+	return strings.Contains(err.Error(), "message is not modified")
+}
+
+// getLiveMapURL returns the URL of the livemap of the server or an empty
+// string when it is disabled.
+func getLiveMapURL(sessionInfo model.LiveSessionInfoData) string {
+	if sessionInfo.SessionInfo.LiveMapPath == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s%s/live", sessionInfo.SessionInfo.LiveMapDomain, sessionInfo.SessionInfo.LiveMapPath)
+}
+
+// buildSessionDataText renders the grid message for the given info type
+func buildSessionDataText(driversSession model.LiveStandingData, sessionInfo model.LiveSessionInfoData, infoType string, loc *i18n.Localizer) string {
+	tableText := buildGridTable(driversSession, infoType, loc)
+	remainingTime := helper.SecondsToHoursAndMinutes(sessionInfo.SessionInfo.EndEventTime - sessionInfo.SessionInfo.CurrentEventTime)
+	return fmt.Sprintf("```\nTime left: %s\nServer: %q\n\n%s```", remainingTime, driversSession.ServerName, tableText)
+}
+
+// buildGridTable renders the standing of the drivers for the given info type
+func buildGridTable(driversSession model.LiveStandingData, infoType string, loc *i18n.Localizer) string {
+	var b bytes.Buffer
+	t := table.NewWriter()
+	t.SetOutputMirror(&b)
+	style := table.StyleRounded
+	style.Options.DrawBorder = false
+	t.SetStyle(style)
+	t.AppendSeparator()
+
+	switch infoType {
+	case getInlineKeyboardStatus(loc):
+		t.AppendHeader(table.Row{getDriverHeader(loc), getSectorsHeader(loc), "S" /*, "FUEL"*/})
+	case getInlineKeyboardInfo(loc):
+		t.AppendHeader(table.Row{getDriverHeader(loc), getNameHeader(loc) /*, "Núm"*/, getLapHeader(loc)})
+	case getInlineKeyboardLastLap(loc):
+		t.AppendHeader(table.Row{getDriverHeader(loc), getLastHeader(loc), getBestHeader(loc)})
+	case getInlineKeyboardOptimumLap(loc):
+		t.AppendHeader(table.Row{getDriverHeader(loc), getOptimalHeader(loc), getBestHeader(loc)})
+	case getInlineKeyboardBestLap(loc):
+		t.AppendHeader(table.Row{getDriverHeader(loc), getBestHeader(loc), getTopSpeedHeader(loc)})
+	default:
+		t.AppendHeader(table.Row{getDriverHeader(loc), infoType})
+	}
+	for idx, driverStat := range driversSession.Drivers {
+		switch infoType {
+		case getInlineKeyboardStatus(loc):
+			// state := "🟢"
+			state := ""
+			if driverStat.InGarageStall {
+				state = "P"
+				// state = "🔴"
+			} else if driverStat.Pitting {
+				state = "P"
+				// state = "🟡"
+			}
+			var s1 float64
+			s2 := -1.0
+			s3 := -1.0
+			if driverStat.CurrentSectorTime1 > 0.0 {
+				// s1 is done in current lap
+				s1 = driverStat.CurrentSectorTime1
+				if s1 > 0.0 && driverStat.CurrentSectorTime2 > 0.0 {
+					// s2 is done in current lap
+					s2 = driverStat.CurrentSectorTime2 - s1
+				}
+			} else {
+				s1 = driverStat.LastSectorTime1
+				if s1 > 0.0 && driverStat.LastSectorTime2 > 0.0 {
+					s2 = driverStat.LastSectorTime2 - s1
+				}
+				if s2 > 0.0 && driverStat.LastLapTime > 0.0 {
+					s3 = driverStat.LastLapTime - s2 - s1
+				}
+			}
+			t.AppendRow([]interface{}{
+				helper.GetDriverCodeName(driverStat.DriverName),
+				fmt.Sprintf("%s %s %s", helper.ToSectorTime(s1), helper.ToSectorTime(s2), helper.ToSectorTime(s3)),
+				// fmt.Sprintf("%.0f%%", driverStat.FuelFraction*100),
+				state,
+			})
+		case getInlineKeyboardInfo(loc):
+			t.AppendRow([]interface{}{
+				helper.GetDriverCodeName(driverStat.DriverName),
+				driverStat.DriverName,
+				// driverStat.CarNumber,
+				driverStat.LapsCompleted,
+			})
+		case getInlineKeyboardDiff(loc):
+			diff := ""
+			if idx == 0 {
+				diff = helper.SecondsToMinutes(driverStat.BestLapTime)
+			} else {
+				diff = helper.SecondsToDiff(driverStat.BestLapTime - driversSession.Drivers[0].BestLapTime)
+			}
+			t.AppendRow([]interface{}{
+				helper.GetDriverCodeName(driverStat.DriverName),
+				diff,
+			})
+		case getInlineKeyboardBestLap(loc):
+			topSpeed := "-"
+			if driverStat.BestLap > 0 {
+				kph, found := driverStat.TopSpeedPerLap[driverStat.BestLap]
+				if found {
+					topSpeed = fmt.Sprintf("%.1f km/h", kph)
+				}
+			}
+			// fmt.Printf("Driver: %s\n   BestLap: %d\n   Data: %+v\n   Top Speed: %s\n", driverStat.DriverName, driverStat.BestLap, driverStat.TopSpeedPerLap, topSpeed)
+			t.AppendRow([]interface{}{
+				helper.GetDriverCodeName(driverStat.DriverName),
+				helper.SecondsToMinutes(driverStat.BestLapTime),
+				topSpeed,
+			})
+		case getInlineKeyboardLastLap(loc):
+			t.AppendRow([]interface{}{
+				helper.GetDriverCodeName(driverStat.DriverName),
+				helper.SecondsToMinutes(driverStat.LastLapTime),
+				helper.SecondsToMinutes(driverStat.BestLapTime),
+			})
+		case getInlineKeyboardOptimumLap(loc):
+			optimumLap := -1.0
+			if driverStat.BestSectorTime1 > 0.0 && driverStat.BestSectorTime2 > 0.0 && driverStat.BestSectorTime3 > 0.0 {
+				optimumLap = driverStat.BestSectorTime1 + driverStat.BestSectorTime2 + driverStat.BestSectorTime3
+			}
+			t.AppendRow([]interface{}{
+				helper.GetDriverCodeName(driverStat.DriverName),
+				helper.SecondsToMinutes(optimumLap),
+				helper.SecondsToMinutes(driverStat.BestLapTime),
+			})
+		case getInlineKeyboardOptimumLapSectors(loc):
+			ls1 := driverStat.BestSectorTime1
+			ls2 := driverStat.BestSectorTime2
+			ls3 := driverStat.BestSectorTime3
+			t.AppendRow([]interface{}{
+				helper.GetDriverCodeName(driverStat.DriverName),
+				fmt.Sprintf("%s %s %s", helper.ToSectorTime(ls1), helper.ToSectorTime(ls2), helper.ToSectorTime(ls3)),
+			})
+		case getInlineKeyboardBestLapSectors(loc):
+			bs1 := driverStat.BestLapSectorTime1
+			bs2 := -1.0
+			if bs1 > 0.0 {
+				bs2 = driverStat.BestLapSectorTime2 - bs1
+			}
+			bs3 := -1.0
+			if bs2 > 0.0 && driverStat.BestLapTime > 0.0 {
+				bs3 = driverStat.BestLapTime - bs2 - bs1
+			}
+			t.AppendRow([]interface{}{
+				helper.GetDriverCodeName(driverStat.DriverName),
+				fmt.Sprintf("%s %s %s", helper.ToSectorTime(bs1), helper.ToSectorTime(bs2), helper.ToSectorTime(bs3)),
+			})
+		case getInlineKeyboardLastLapSectors(loc):
+			ls1 := driverStat.LastSectorTime1
+			ls2 := -1.0
+			if ls1 > 0.0 && driverStat.LastSectorTime2 > 0.0 {
+				ls2 = driverStat.LastSectorTime2 - ls1
+			}
+			ls3 := -1.0
+			if ls2 > 0.0 && driverStat.LastLapTime > 0.0 {
+				ls3 = driverStat.LastLapTime - ls2 - ls1
+			}
+			t.AppendRow([]interface{}{
+				helper.GetDriverCodeName(driverStat.DriverName),
+				fmt.Sprintf("%s %s %s", helper.ToSectorTime(ls1), helper.ToSectorTime(ls2), helper.ToSectorTime(ls3)),
+			})
+		case getInlineKeyboardLaps(loc):
+			t.AppendRow([]interface{}{
+				helper.GetDriverCodeName(driverStat.DriverName),
+				fmt.Sprintf("%d", driverStat.LapsCompleted),
+			})
+		case getInlineKeyboardTeam(loc):
+			t.AppendRow([]interface{}{
+				helper.GetDriverCodeName(driverStat.DriverName),
+				driverStat.CarClass,
+			})
+		case getInlineKeyboardDriver(loc):
+			t.AppendRow([]interface{}{
+				helper.GetDriverCodeName(driverStat.DriverName),
+				driverStat.DriverName,
+			})
+		}
+	}
+	t.Render()
+	return b.String()
+}
+
+func getGridInlineKeyboard(serverID, liveMapUrl, infoType string, following bool, loc *i18n.Localizer) tgbotapi.InlineKeyboardMarkup {
+	liveFollowButton := tgbotapi.NewInlineKeyboardButtonData(getInlineKeyboardLiveFollow(loc)+" "+symbolLive, fmt.Sprintf("%s:%s:%s", subcommandStartLiveFollow, serverID, infoType))
+	if following {
+		liveFollowButton = tgbotapi.NewInlineKeyboardButtonData(getInlineKeyboardStopLiveFollow(loc)+" "+symbolStop, fmt.Sprintf("%s:%s", subcommandStopLiveFollow, serverID))
+	}
+	otherInfoRow := tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(getInlineKeyboardStatus(loc), fmt.Sprintf("%s:%s:%s", subcommandShowLiveTiming, serverID, getInlineKeyboardStatus(loc))),
+		tgbotapi.NewInlineKeyboardButtonData(getInlineKeyboardInfo(loc), fmt.Sprintf("%s:%s:%s", subcommandShowLiveTiming, serverID, getInlineKeyboardInfo(loc))),
+		tgbotapi.NewInlineKeyboardButtonData(getInlineKeyboardDiff(loc), fmt.Sprintf("%s:%s:%s", subcommandShowLiveTiming, serverID, getInlineKeyboardDiff(loc))),
+	)
+	if liveMapUrl != "" {
+		otherInfoRow = append(otherInfoRow, tgbotapi.NewInlineKeyboardButtonURL(getInlineKeyboardLiveMap(loc), liveMapUrl))
+	}
 	return tgbotapi.NewInlineKeyboardMarkup(
 		tgbotapi.NewInlineKeyboardRow(
 			tgbotapi.NewInlineKeyboardButtonData(getInlineKeyboardBestLap(loc)+" "+symbolTimes, fmt.Sprintf("%s:%s:%s", subcommandShowLiveTiming, serverID, getInlineKeyboardBestLap(loc))),
@@ -327,11 +732,14 @@ func getGridInlineKeyboard(serverID, liveMapUrl string, loc *i18n.Localizer) tgb
 			tgbotapi.NewInlineKeyboardButtonData(getInlineKeyboardOptimumLap(loc)+" "+symbolTimes, fmt.Sprintf("%s:%s:%s", subcommandShowLiveTiming, serverID, getInlineKeyboardOptimumLap(loc))),
 			tgbotapi.NewInlineKeyboardButtonData(getInlineKeyboardOptimumLapSectors(loc), fmt.Sprintf("%s:%s:%s", subcommandShowLiveTiming, serverID, getInlineKeyboardOptimumLapSectors(loc))),
 		),
+		otherInfoRow,
+		tgbotapi.NewInlineKeyboardRow(
+			liveFollowButton,
+			tgbotapi.NewInlineKeyboardButtonData(getInlineKeyboardSnapshot(loc)+" "+symbolPhoto, fmt.Sprintf("%s:%s", subcommandShowSnapshot, serverID)),
+		),
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData(getInlineKeyboardStatus(loc), fmt.Sprintf("%s:%s:%s", subcommandShowLiveTiming, serverID, getInlineKeyboardStatus(loc))),
-			tgbotapi.NewInlineKeyboardButtonData(getInlineKeyboardInfo(loc), fmt.Sprintf("%s:%s:%s", subcommandShowLiveTiming, serverID, getInlineKeyboardInfo(loc))),
-			tgbotapi.NewInlineKeyboardButtonData(getInlineKeyboardDiff(loc), fmt.Sprintf("%s:%s:%s", subcommandShowLiveTiming, serverID, getInlineKeyboardDiff(loc))),
-			tgbotapi.NewInlineKeyboardButtonURL(getInlineKeyboardLiveMap(loc), liveMapUrl),
+			tgbotapi.NewInlineKeyboardButtonData(getInlineKeyboardPositionsChart(loc)+" "+symbolChart, fmt.Sprintf("%s:%s:%s", subcommandShowChart, serverID, chartPositions)),
+			tgbotapi.NewInlineKeyboardButtonData(getInlineKeyboardGapChart(loc)+" "+symbolChart, fmt.Sprintf("%s:%s:%s", subcommandShowChart, serverID, chartGap)),
 		),
 	)
 }
@@ -0,0 +1,38 @@
+package live
+
+import (
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestGridAppAcceptCallback(t *testing.T) {
+	tests := []struct {
+		data string
+		want bool
+	}{
+		{"show_live_timing:server1:info", true},
+		{"show_live_timing:server2:info", false},
+		{"show_live_timing:server1", false},
+		{"show_live_timing", false},
+		{"show_snapshot:server1", true},
+		{"show_snapshot", false},
+		{"start_live_follow:server1:info", true},
+		{"start_live_follow:server1", false},
+		{"start_live_follow:server1:info:extra", false},
+		{"start_live_follow", false},
+		{"stop_live_follow:server1", true},
+		{"stop_live_follow", false},
+		{"", false},
+	}
+
+	ga := &GridApp{serverID: "server1"}
+	for _, tt := range tests {
+		t.Run(tt.data, func(t *testing.T) {
+			got, _ := ga.AcceptCallback(&tgbotapi.CallbackQuery{Data: tt.data})
+			if got != tt.want {
+				t.Errorf("got %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package live
+
+import (
+	"context"
+	"fmt"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+// IsGroupChat returns whether the chat of the context is a group. Groups do
+// not get reply keyboards, as they are shown to every member of the group.
+func IsGroupChat(ctx context.Context) bool {
+	chatCtxValue := ctx.Value(ChatContextKey)
+	if chatCtxValue == nil {
+		return false
+	}
+	return !chatCtxValue.(*tgbotapi.Chat).IsPrivate()
+}
+
+// replyMenu returns the menu to send along a message to the chat of the
+// context. Groups get no menu.
+func replyMenu(ctx context.Context, menu tgbotapi.ReplyKeyboardMarkup) interface{} {
+	if IsGroupChat(ctx) {
+		return nil
+	}
+	return menu
+}
+
+// subscriber returns the user and chat IDs the settings of the chat of the
+// context are stored with. Private chats have the settings of the user and
+// groups the ones of the group, shared by all its members.
+func subscriber(ctx context.Context) (string, string, bool) {
+	userCtxValue := ctx.Value(UserContextKey)
+	chatCtxValue := ctx.Value(ChatContextKey)
+	if userCtxValue == nil || chatCtxValue == nil {
+		return "", "", false
+	}
+	user := userCtxValue.(*tgbotapi.User)
+	chat := chatCtxValue.(*tgbotapi.Chat)
+	chatID := fmt.Sprintf("%d", chat.ID)
+	if chat.IsPrivate() {
+		return fmt.Sprintf("%d", user.ID), chatID, true
+	}
+	return chatID, chatID, true
+}
+
+// checkCanChangeSettings returns whether the user of the context can change
+// the settings of its chat. Only the administrators can change the ones of a
+// group, the rest of the members are told so.
+func checkCanChangeSettings(ctx context.Context, bot *tgbotapi.BotAPI, query *tgbotapi.CallbackQuery, loc *i18n.Localizer) (bool, error) {
+	if !IsGroupChat(ctx) {
+		return true, nil
+	}
+	chat := ctx.Value(ChatContextKey).(*tgbotapi.Chat)
+	member, err := bot.GetChatMember(tgbotapi.GetChatMemberConfig{
+		ChatConfigWithUser: tgbotapi.ChatConfigWithUser{
+			ChatID: chat.ID,
+			UserID: query.From.ID,
+		},
+	})
+	if err != nil {
+		return false, err
+	}
+	if member.IsCreator() || member.IsAdministrator() {
+		return true, nil
+	}
+
+	message := loc.MustLocalize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{
+			ID:    "settings.onlyAdmins",
+			Other: "Only the administrators of the group can change its settings",
+		},
+	})
+	_, err = bot.Request(tgbotapi.NewCallbackWithAlert(query.ID, message))
+	return false, err
+}
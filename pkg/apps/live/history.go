@@ -0,0 +1,357 @@
+package live
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/helper"
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/locale"
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/results"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+const (
+	subcommandShowHistoryServers = "show_history_servers"
+	subcommandShowHistory        = "show_history"
+	subcommandShowHistoryGrid    = "show_history_grid"
+	subcommandShowHistoryDrivers = "show_history_drivers"
+	subcommandShowHistoryStint   = "show_history_stint"
+
+	historySessionsPerPage = 5
+	historyDateFormat      = "02/01 15:04"
+
+	// the stint callbacks carry these keys instead of the localized labels
+	// to stay within the callback data limit
+	historyStintTimes   = "t"
+	historyStintSectors = "s"
+)
+
+type HistoryApp struct {
+	bot  *tgbotapi.BotAPI
+	rm   *results.Manager
+	locs *locale.Localizers
+	// the sessions of the servers the chat can not see are not shown
+	canSeeServer func(ctx context.Context, serverID string) bool
+	title        func(loc *i18n.Localizer) string
+}
+
+func NewHistoryApp(bot *tgbotapi.BotAPI, rm *results.Manager, canSeeServer func(ctx context.Context, serverID string) bool, appName func(loc *i18n.Localizer) string, locs *locale.Localizers) *HistoryApp {
+	return &HistoryApp{
+		bot:          bot,
+		rm:           rm,
+		locs:         locs,
+		canSeeServer: canSeeServer,
+		title:        appName,
+	}
+}
+
+func (ha *HistoryApp) AcceptCommand(command string) (bool, func(ctx context.Context, chatId int64) error) {
+	return false, nil
+}
+
+func (ha *HistoryApp) AcceptCallback(query *tgbotapi.CallbackQuery) (bool, func(ctx context.Context, query *tgbotapi.CallbackQuery) error) {
+	data := strings.Split(query.Data, ":")
+	switch {
+	case data[0] == subcommandShowHistoryServers:
+		return true, func(ctx context.Context, query *tgbotapi.CallbackQuery) error {
+			return ha.renderServers(&query.Message.MessageID)(ctx, query.Message.Chat.ID)
+		}
+	case data[0] == subcommandShowHistory && len(data) == 3:
+		return true, func(ctx context.Context, query *tgbotapi.CallbackQuery) error {
+			page, _ := strconv.Atoi(data[2])
+			return ha.sendSessions(ctx, query.Message.Chat.ID, &query.Message.MessageID, data[1], page)
+		}
+	case data[0] == subcommandShowHistoryGrid && len(data) == 3:
+		return true, func(ctx context.Context, query *tgbotapi.CallbackQuery) error {
+			sessionID, _ := strconv.ParseInt(data[1], 10, 64)
+			return ha.sendSessionData(ctx, query.Message.Chat.ID, &query.Message.MessageID, sessionID, data[2])
+		}
+	case data[0] == subcommandShowHistoryDrivers && len(data) == 2:
+		return true, func(ctx context.Context, query *tgbotapi.CallbackQuery) error {
+			sessionID, _ := strconv.ParseInt(data[1], 10, 64)
+			return ha.sendDriversData(ctx, query.Message.Chat.ID, &query.Message.MessageID, sessionID)
+		}
+	case data[0] == subcommandShowHistoryStint && len(data) == 4 && (data[2] == historyStintTimes || data[2] == historyStintSectors):
+		return true, func(ctx context.Context, query *tgbotapi.CallbackQuery) error {
+			sessionID, _ := strconv.ParseInt(data[1], 10, 64)
+			return ha.sendStintData(ctx, query.Message.Chat.ID, &query.Message.MessageID, sessionID, data[2], data[3])
+		}
+	}
+	return false, nil
+}
+
+func (ha *HistoryApp) AcceptButton(button string) (bool, func(ctx context.Context, chatId int64) error) {
+	if ha.locs.Matches(button, ha.title) {
+		return true, ha.renderServers(nil)
+	}
+	return false, nil
+}
+
+func (ha *HistoryApp) renderServers(messageID *int) func(ctx context.Context, chatId int64) error {
+	return func(ctx context.Context, chatId int64) error {
+		loc := ha.locs.FromContext(ctx)
+		stored, err := ha.rm.ListServers()
+		if err != nil {
+			log.Printf("Error listing servers with stored sessions: %s\n", err.Error())
+			return ha.sendCouldNotReadSessions(chatId, loc)
+		}
+		ss := []results.Server{}
+		for _, s := range stored {
+			if ha.canSeeServer(ctx, s.ID) {
+				ss = append(ss, s)
+			}
+		}
+		if len(ss) == 0 {
+			message := loc.MustLocalize(&i18n.LocalizeConfig{
+				DefaultMessage: &i18n.Message{
+					ID:    "history.noSessions",
+					Other: "There are no stored sessions",
+				},
+			})
+
+			msg := tgbotapi.NewMessage(chatId, message)
+			_, err := ha.bot.Send(msg)
+			return err
+		}
+
+		buttons := [][]tgbotapi.InlineKeyboardButton{}
+		for idx, s := range ss {
+			if idx%2 == 0 {
+				buttons = append(buttons, []tgbotapi.InlineKeyboardButton{})
+			}
+			buttons[len(buttons)-1] = append(buttons[len(buttons)-1], tgbotapi.NewInlineKeyboardButtonData(s.Name, fmt.Sprintf("%s:%s:%d", subcommandShowHistory, s.ID, 0)))
+		}
+		text := loc.MustLocalize(&i18n.LocalizeConfig{
+			DefaultMessage: &i18n.Message{
+				ID:    "history.chooseServer",
+				Other: "Choose the server:",
+			},
+		})
+		return ha.send(chatId, messageID, text, "", tgbotapi.NewInlineKeyboardMarkup(buttons...))
+	}
+}
+
+func (ha *HistoryApp) sendSessions(ctx context.Context, chatId int64, messageId *int, serverID string, page int) error {
+	loc := ha.locs.FromContext(ctx)
+	if !ha.canSeeServer(ctx, serverID) {
+		return sendMembersOnly(ha.bot, chatId, loc)
+	}
+	sessions, total, err := ha.rm.ListSessions(serverID, page*historySessionsPerPage, historySessionsPerPage)
+	if err != nil {
+		log.Printf("Error listing stored sessions for server %s: %s\n", serverID, err.Error())
+		return ha.sendCouldNotReadSessions(chatId, loc)
+	}
+
+	buttons := [][]tgbotapi.InlineKeyboardButton{}
+	serverName := serverID
+	for _, s := range sessions {
+		serverName = s.ServerName
+		label := fmt.Sprintf("%s · %s · %s", s.FinishedAt.Format(historyDateFormat), s.SessionType, s.TrackName)
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(label, fmt.Sprintf("%s:%d:%s", subcommandShowHistoryGrid, s.ID, getInlineKeyboardBestLap(loc))),
+		))
+	}
+
+	navigation := []tgbotapi.InlineKeyboardButton{}
+	if page > 0 {
+		navigation = append(navigation, tgbotapi.NewInlineKeyboardButtonData(symbolPrevious, fmt.Sprintf("%s:%s:%d", subcommandShowHistory, serverID, page-1)))
+	}
+	navigation = append(navigation, tgbotapi.NewInlineKeyboardButtonData(getInlineKeyboardBack(loc), fmt.Sprintf("%s:%d", subcommandShowHistoryServers, 0)))
+	if (page+1)*historySessionsPerPage < total {
+		navigation = append(navigation, tgbotapi.NewInlineKeyboardButtonData(symbolNext, fmt.Sprintf("%s:%s:%d", subcommandShowHistory, serverID, page+1)))
+	}
+	buttons = append(buttons, navigation)
+
+	message := loc.MustLocalize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{
+			ID:    "history.chooseSession",
+			Other: "Sessions stored for %s (%d/%d):",
+		},
+	})
+	pages := (total + historySessionsPerPage - 1) / historySessionsPerPage
+	text := fmt.Sprintf(message, serverName, page+1, max(pages, 1))
+	return ha.send(chatId, messageId, text, "", tgbotapi.NewInlineKeyboardMarkup(buttons...))
+}
+
+func (ha *HistoryApp) sendSessionData(ctx context.Context, chatId int64, messageId *int, sessionID int64, infoType string) error {
+	loc := ha.locs.FromContext(ctx)
+	sr, err := ha.rm.GetSession(sessionID)
+	if err != nil {
+		log.Printf("Error reading stored session %d: %s\n", sessionID, err.Error())
+		return ha.sendCouldNotReadSessions(chatId, loc)
+	}
+	if !ha.canSeeServer(ctx, sr.ServerID) {
+		return sendMembersOnly(ha.bot, chatId, loc)
+	}
+
+	message := loc.MustLocalize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{
+			ID:    "history.sessionData",
+			Other: "```\nServer: %q\nTrack: %s\nSession: %s (%s)\n\n%s```",
+		},
+	})
+	tableText := buildGridTable(sr.Standing, infoType, loc)
+	text := fmt.Sprintf(message, sr.ServerName, sr.TrackName, sr.SessionType, sr.FinishedAt.Format(historyDateFormat), tableText)
+	return ha.send(chatId, messageId, text, tgbotapi.ModeMarkdownV2, getHistoryGridInlineKeyboard(sr.Session, loc))
+}
+
+func (ha *HistoryApp) sendDriversData(ctx context.Context, chatId int64, messageId *int, sessionID int64) error {
+	loc := ha.locs.FromContext(ctx)
+	sr, err := ha.rm.GetSession(sessionID)
+	if err != nil {
+		log.Printf("Error reading stored session %d: %s\n", sessionID, err.Error())
+		return ha.sendCouldNotReadSessions(chatId, loc)
+	}
+	if !ha.canSeeServer(ctx, sr.ServerID) {
+		return sendMembersOnly(ha.bot, chatId, loc)
+	}
+
+	buttons := [][]tgbotapi.InlineKeyboardButton{}
+	for idx, driver := range sr.History.DriverNames {
+		if idx%2 == 0 {
+			buttons = append(buttons, []tgbotapi.InlineKeyboardButton{})
+		}
+		buttons[len(buttons)-1] = append(buttons[len(buttons)-1], tgbotapi.NewInlineKeyboardButtonData(driver, fmt.Sprintf("%s:%d:%s:%s", subcommandShowHistoryStint, sessionID, historyStintTimes, helper.ToID(driver))))
+	}
+	buttons = append(buttons, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(getInlineKeyboardBack(loc), fmt.Sprintf("%s:%d:%s", subcommandShowHistoryGrid, sessionID, getInlineKeyboardBestLap(loc))),
+	))
+
+	msg := loc.MustLocalize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{
+			ID:    "stint.chooseDriverFromList",
+			Other: "Choose the driver from the list:",
+		},
+	})
+	text := fmt.Sprintf("%s\n\n", msg)
+	return ha.send(chatId, messageId, text, "", tgbotapi.NewInlineKeyboardMarkup(buttons...))
+}
+
+func (ha *HistoryApp) sendStintData(ctx context.Context, chatId int64, messageId *int, sessionID int64, infoType, driverID string) error {
+	loc := ha.locs.FromContext(ctx)
+	sr, err := ha.rm.GetSession(sessionID)
+	if err != nil {
+		log.Printf("Error reading stored session %d: %s\n", sessionID, err.Error())
+		return ha.sendCouldNotReadSessions(chatId, loc)
+	}
+	if !ha.canSeeServer(ctx, sr.ServerID) {
+		return sendMembersOnly(ha.bot, chatId, loc)
+	}
+
+	driver, found := driverByID(sr.History, driverID)
+	if !found {
+		text := loc.MustLocalize(&i18n.LocalizeConfig{
+			DefaultMessage: &i18n.Message{
+				ID:    "history.driverNotFound",
+				Other: "The driver is not in the session",
+			},
+		})
+
+		msg := tgbotapi.NewMessage(chatId, text)
+		_, err := ha.bot.Send(msg)
+		return err
+	}
+
+	driverData := sr.History.DriversData[driver]
+	if len(driverData) == 0 {
+		text := loc.MustLocalize(&i18n.LocalizeConfig{
+			DefaultMessage: &i18n.Message{
+				ID:    "stint.noDataForDriver",
+				Other: "No data for driver %s",
+			},
+		})
+
+		msg := tgbotapi.NewMessage(chatId, fmt.Sprintf(text, driver))
+		_, err := ha.bot.Send(msg)
+		return err
+	}
+
+	message := loc.MustLocalize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{
+			ID:    "history.driverSessionData",
+			Other: "```\nData for %s in %q\nTrack: %s\nSession: %s (%s)\n\n%s```",
+		},
+	})
+	label := getInlineKeyboardTimes(loc)
+	if infoType == historyStintSectors {
+		label = getInlineKeyboardSectors(loc)
+	}
+	tableText := buildStintTable(driverData, label, loc)
+	text := fmt.Sprintf(message, driver, sr.ServerName, sr.TrackName, sr.SessionType, sr.FinishedAt.Format(historyDateFormat), tableText)
+	return ha.send(chatId, messageId, text, tgbotapi.ModeMarkdownV2, getHistoryStintInlineKeyboard(sessionID, driverID, loc))
+}
+
+func (ha *HistoryApp) sendCouldNotReadSessions(chatId int64, loc *i18n.Localizer) error {
+	message := loc.MustLocalize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{
+			ID:    "history.couldNotReadSessions",
+			Other: "Could not read the stored sessions",
+		},
+	})
+
+	msg := tgbotapi.NewMessage(chatId, message)
+	_, err := ha.bot.Send(msg)
+	return err
+}
+
+func (ha *HistoryApp) send(chatId int64, messageId *int, text, parseMode string, keyboard tgbotapi.InlineKeyboardMarkup) error {
+	var cfg tgbotapi.Chattable
+	if messageId == nil {
+		msg := tgbotapi.NewMessage(chatId, text)
+		msg.ParseMode = parseMode
+		msg.ReplyMarkup = keyboard
+		cfg = msg
+	} else {
+		msg := tgbotapi.NewEditMessageText(chatId, *messageId, text)
+		msg.ParseMode = parseMode
+		msg.ReplyMarkup = &keyboard
+		cfg = msg
+	}
+	_, err := ha.bot.Send(cfg)
+	return err
+}
+
+func getHistoryGridInlineKeyboard(s results.Session, loc *i18n.Localizer) tgbotapi.InlineKeyboardMarkup {
+	data := func(infoType string) string {
+		return fmt.Sprintf("%s:%d:%s", subcommandShowHistoryGrid, s.ID, infoType)
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(getInlineKeyboardBestLap(loc)+" "+symbolTimes, data(getInlineKeyboardBestLap(loc))),
+			tgbotapi.NewInlineKeyboardButtonData(getInlineKeyboardBestLapSectors(loc), data(getInlineKeyboardBestLapSectors(loc))),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(getInlineKeyboardLastLap(loc)+" "+symbolTimes, data(getInlineKeyboardLastLap(loc))),
+			tgbotapi.NewInlineKeyboardButtonData(getInlineKeyboardLastLapSectors(loc), data(getInlineKeyboardLastLapSectors(loc))),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(getInlineKeyboardOptimumLap(loc)+" "+symbolTimes, data(getInlineKeyboardOptimumLap(loc))),
+			tgbotapi.NewInlineKeyboardButtonData(getInlineKeyboardOptimumLapSectors(loc), data(getInlineKeyboardOptimumLapSectors(loc))),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(getInlineKeyboardInfo(loc), data(getInlineKeyboardInfo(loc))),
+			tgbotapi.NewInlineKeyboardButtonData(getInlineKeyboardDiff(loc), data(getInlineKeyboardDiff(loc))),
+			tgbotapi.NewInlineKeyboardButtonData(getInlineKeyboardDriver(loc)+" "+symbolDriver, fmt.Sprintf("%s:%d", subcommandShowHistoryDrivers, s.ID)),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(getInlineKeyboardBack(loc), fmt.Sprintf("%s:%s:%d", subcommandShowHistory, s.ServerID, 0)),
+		),
+	)
+}
+
+func getHistoryStintInlineKeyboard(sessionID int64, driverID string, loc *i18n.Localizer) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(getInlineKeyboardTimes(loc)+" "+symbolTimes, fmt.Sprintf("%s:%d:%s:%s", subcommandShowHistoryStint, sessionID, historyStintTimes, driverID)),
+			tgbotapi.NewInlineKeyboardButtonData(getInlineKeyboardSectors(loc)+" "+symbolSectors, fmt.Sprintf("%s:%d:%s:%s", subcommandShowHistoryStint, sessionID, historyStintSectors, driverID)),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(getInlineKeyboardBack(loc), fmt.Sprintf("%s:%d", subcommandShowHistoryDrivers, sessionID)),
+		),
+	)
+}
@@ -0,0 +1,73 @@
+package live
+
+import (
+	"math"
+	"testing"
+
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/helper"
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/locale"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// callbackDataLimit is the maximum size in bytes of the data of a button.
+const callbackDataLimit = 64
+
+func newTestLocalizers(t *testing.T) *locale.Localizers {
+	t.Helper()
+	locs, err := locale.NewLocalizers("../../../" + locale.MessageFiles)
+	if err != nil {
+		t.Fatalf("error loading the translations: %s", err)
+	}
+	return locs
+}
+
+func TestHistoryAppAcceptCallback(t *testing.T) {
+	tests := []struct {
+		data string
+		want bool
+	}{
+		{"show_history_servers", true},
+		{"show_history:server1:0", true},
+		{"show_history:server1", false},
+		{"show_history", false},
+		{"show_history_grid:1:Info", true},
+		{"show_history_grid:1", false},
+		{"show_history_drivers:1", true},
+		{"show_history_drivers", false},
+		{"show_history_stint:1:t:123", true},
+		{"show_history_stint:1:s:123", true},
+		{"show_history_stint:1:Times:123", false},
+		{"show_history_stint:1:t:Driver:Name", false},
+		{"show_history_stint:1:t", false},
+		{"show_history_stint", false},
+		{"", false},
+	}
+
+	ha := &HistoryApp{}
+	for _, tt := range tests {
+		t.Run(tt.data, func(t *testing.T) {
+			got, _ := ha.AcceptCallback(&tgbotapi.CallbackQuery{Data: tt.data})
+			if got != tt.want {
+				t.Errorf("got %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHistoryStintCallbackDataLimit(t *testing.T) {
+	locs := newTestLocalizers(t)
+	driver := "A Driver With A Very Long Name That Would Not Fit In The Callback Data"
+	for _, lang := range locs.Languages() {
+		t.Run(lang, func(t *testing.T) {
+			keyboard := getHistoryStintInlineKeyboard(math.MaxInt64, helper.ToID(driver), locs.Get(lang))
+			for _, row := range keyboard.InlineKeyboard {
+				for _, button := range row {
+					if len(*button.CallbackData) > callbackDataLimit {
+						t.Errorf("the data of %q has %d bytes: %s", button.Text, len(*button.CallbackData), *button.CallbackData)
+					}
+				}
+			}
+		})
+	}
+}
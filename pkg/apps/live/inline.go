@@ -0,0 +1,76 @@
+package live
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/helper"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+// InlineResults returns the standings and the best laps of the sessions of
+// the servers matching the query, so they can be shared in any chat. Only the
+// servers the user can see are searched.
+func (la *LiveApp) InlineResults(ctx context.Context, query string) []interface{} {
+	loc := la.locs.FromContext(ctx)
+	results := []interface{}{}
+	for _, server := range la.visibleServers(ctx) {
+		if !server.ReceivingData {
+			continue
+		}
+		la.mu.Lock()
+		serverApp := la.serverApps[server.ID]
+		la.mu.Unlock()
+		results = append(results, serverApp.gridApp.inlineResults(query, loc)...)
+	}
+	return results
+}
+
+// inlineResults returns the standings and the best laps of the session when
+// the query is part of the name or the ID of the server or of the track.
+func (ga *GridApp) inlineResults(query string, loc *i18n.Localizer) []interface{} {
+	ga.mu.Lock()
+	standing := ga.liveStandingData
+	sessionInfo := ga.liveSessionInfoData
+	ga.mu.Unlock()
+
+	si := sessionInfo.SessionInfo
+	query = strings.ToLower(strings.TrimSpace(query))
+	matches := strings.Contains(strings.ToLower(standing.ServerName), query) ||
+		strings.Contains(strings.ToLower(ga.serverID), query) ||
+		strings.Contains(strings.ToLower(si.TrackName), query)
+	if !matches || len(standing.Drivers) == 0 {
+		return []interface{}{}
+	}
+
+	standingsTitle := loc.MustLocalize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{
+			ID:    "inline.standings",
+			Other: "%s – %s – standings",
+		},
+	})
+	bestLapsTitle := loc.MustLocalize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{
+			ID:    "inline.bestLaps",
+			Other: "%s – best laps",
+		},
+	})
+	description := fmt.Sprintf("%s (%s)", standing.ServerName, helper.SecondsToHoursAndMinutes(si.EndEventTime-si.CurrentEventTime))
+
+	standings := tgbotapi.NewInlineQueryResultArticleMarkdownV2(
+		fmt.Sprintf("%s:standings", ga.serverID),
+		fmt.Sprintf(standingsTitle, si.TrackName, si.Session),
+		buildSessionDataText(standing, sessionInfo, getInlineKeyboardInfo(loc), loc),
+	)
+	standings.Description = description
+	bestLaps := tgbotapi.NewInlineQueryResultArticleMarkdownV2(
+		fmt.Sprintf("%s:best", ga.serverID),
+		fmt.Sprintf(bestLapsTitle, si.TrackName),
+		buildSessionDataText(standing, sessionInfo, getInlineKeyboardBestLap(loc), loc),
+	)
+	bestLaps.Description = description
+	return []interface{}{standings, bestLaps}
+}
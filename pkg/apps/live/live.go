@@ -3,12 +3,16 @@ package live
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
 
 	"github.com/oscar-martin/rfactor2telegrambot/pkg/apps"
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/locale"
 	"github.com/oscar-martin/rfactor2telegrambot/pkg/menus"
 	"github.com/oscar-martin/rfactor2telegrambot/pkg/model"
 	"github.com/oscar-martin/rfactor2telegrambot/pkg/pubsub"
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/results"
 	"github.com/oscar-martin/rfactor2telegrambot/pkg/servers"
 	"github.com/oscar-martin/rfactor2telegrambot/pkg/settings"
 
@@ -18,73 +22,146 @@ import (
 
 const (
 	liveAppName = "LiveTiming"
+
+	// the commands work in groups too, where there are no reply keyboards.
+	// The server is the first argument of the commands taking one
+	CommandLive    = "/live"
+	CommandServers = "/servers"
+	CommandGrid    = "/grid"
+	CommandStint   = "/stint"
+	CommandMap     = "/map"
+	CommandCar     = "/car"
 )
 
 type LiveApp struct {
-	bot                        *tgbotapi.BotAPI
-	appMenu                    menus.ApplicationMenu
-	menuKeyboard               tgbotapi.ReplyKeyboardMarkup
-	accepters                  []apps.Accepter
-	servers                    []servers.Server
-	liveSessionInfoUpdateChans []<-chan model.LiveSessionInfoData
-	loc                        *i18n.Localizer
-	mu                         sync.Mutex
-}
-
-func NewLiveApp(ctx context.Context, bot *tgbotapi.BotAPI, ss []servers.Server, appMenu menus.ApplicationMenu, sm *settings.Manager, loc *i18n.Localizer) (*LiveApp, error) {
-	liveSessionInfoUpdateChans := []<-chan model.LiveSessionInfoData{}
-	for _, server := range ss {
-		liveSessionInfoUpdateChans = append(liveSessionInfoUpdateChans, pubsub.LiveSessionInfoDataPubSub.Subscribe(pubsub.PubSubSessionInfoPreffix+server.ID))
-	}
+	bot       *tgbotapi.BotAPI
+	appMenu   menus.ApplicationMenu
+	accepters []apps.Accepter
+	servers   []servers.Server
+	// server apps are kept when their server is removed so they are reused
+	// if it is added again
+	serverApps  map[string]*ServerApp
+	settingsApp *SettingsApp
+	historyApp  *HistoryApp
+	accessApp   *AccessApp
+	sm          *settings.Manager
+	locs        *locale.Localizers
+	mu          sync.Mutex
+}
+
+func NewLiveApp(ctx context.Context, bot *tgbotapi.BotAPI, ss []servers.Server, appMenu menus.ApplicationMenu, sm *settings.Manager, rm *results.Manager, locs *locale.Localizers) (*LiveApp, error) {
 	la := &LiveApp{
-		bot:                        bot,
-		appMenu:                    appMenu,
-		liveSessionInfoUpdateChans: liveSessionInfoUpdateChans,
-		loc:                        loc,
-		servers:                    ss,
+		bot:        bot,
+		appMenu:    appMenu,
+		serverApps: map[string]*ServerApp{},
+		sm:         sm,
+		locs:       locs,
+		servers:    ss,
 	}
 
-	la.accepters = []apps.Accepter{}
 	for _, server := range ss {
-		serverAppMenu := menus.NewApplicationMenu(server.StatusAndName(), liveAppName, la, loc)
-		serverApp := NewServerApp(la.bot, serverAppMenu, server.ID, server.URL, loc)
-		la.accepters = append(la.accepters, serverApp)
+		la.addServerApp(server)
 	}
 
-	settingsApp := NewSettingsApp(la.bot, appMenu, sm, la.getButtonSettingsTitle(), loc)
-	la.accepters = append(la.accepters, settingsApp)
+	// the settings change the language, so they go back to the menu of the
+	// live app to show it in the new language
+	settingsAppMenu := menus.NewApplicationMenu("", liveAppName, la, locs)
+	la.settingsApp = NewSettingsApp(la.bot, settingsAppMenu, sm, la.visibleServers, getButtonSettingsTitle, locs)
+	la.historyApp = NewHistoryApp(la.bot, rm, la.canSeeServer, getButtonHistoryTitle, locs)
+	la.accessApp = NewAccessApp(la.bot, sm, locs)
 
-	la.updateKeyboard()
+	la.updateAccepters()
 
-	for _, liveSessionInfoUpdateChan := range la.liveSessionInfoUpdateChans {
-		go la.updater(liveSessionInfoUpdateChan)
-	}
+	go la.serversUpdater(pubsub.ServersChangedPubSub.Subscribe(pubsub.PubSubServersChangedPreffix))
 
 	return la, nil
 }
 
-func (la *LiveApp) updateKeyboard() {
+func (la *LiveApp) addServerApp(server servers.Server) {
+	serverAppMenu := menus.NewApplicationMenu(server.StatusAndName(), liveAppName, la, la.locs)
+	la.serverApps[server.ID] = NewServerApp(la.bot, serverAppMenu, server.ID, server.URL, la.sm, la.locs)
+	go la.updater(pubsub.LiveSessionInfoDataPubSub.Subscribe(pubsub.PubSubSessionInfoPreffix + server.ID))
+}
+
+func (la *LiveApp) updateAccepters() {
+	accepters := []apps.Accepter{}
+	for _, server := range la.servers {
+		accepters = append(accepters, la.serverApps[server.ID])
+	}
+	la.accepters = append(accepters, la.settingsApp, la.historyApp, la.accessApp)
+}
+
+func (la *LiveApp) serversUpdater(c <-chan []model.ServerDefinition) {
+	for definitions := range c {
+		la.setServers(definitions)
+	}
+}
+
+// setServers updates the servers after the configuration was reloaded.
+func (la *LiveApp) setServers(definitions []model.ServerDefinition) {
+	la.mu.Lock()
+	defer la.mu.Unlock()
+
+	current := map[string]servers.Server{}
+	for _, server := range la.servers {
+		current[server.ID] = server
+	}
+
+	ss := []servers.Server{}
+	for _, definition := range definitions {
+		server, found := current[definition.ID]
+		if !found {
+			server = servers.NewServer(definition.ID, definition.URL, "")
+		}
+		// servers receiving data are named after their session info
+		if !found || !server.ReceivingData {
+			server.Name = definition.Name
+		}
+		server.URL = definition.URL
+
+		serverApp, found := la.serverApps[definition.ID]
+		if found {
+			serverApp.setServerURL(definition.URL)
+		} else {
+			la.addServerApp(server)
+		}
+		ss = append(ss, server)
+	}
+	la.servers = ss
+	la.updateAccepters()
+}
+
+// keyboard returns the menu in the language of the user of the context, with
+// the servers it can see. It must be called with the lock held.
+func (la *LiveApp) keyboard(ctx context.Context) tgbotapi.ReplyKeyboardMarkup {
+	loc := la.locs.FromContext(ctx)
 	buttons := [][]tgbotapi.KeyboardButton{}
+	visible := 0
 	for idx := range la.servers {
-		if idx%2 == 0 {
+		if !la.canSeeServer(ctx, la.servers[idx].ID) {
+			continue
+		}
+		if visible%2 == 0 {
 			buttons = append(buttons, []tgbotapi.KeyboardButton{})
 		}
 		buttons[len(buttons)-1] = append(buttons[len(buttons)-1], tgbotapi.NewKeyboardButton(la.servers[idx].StatusAndName()))
+		visible++
 	}
 	backButtonRow := tgbotapi.NewKeyboardButtonRow(
-		tgbotapi.NewKeyboardButton(la.appMenu.ButtonBackTo()),
-		tgbotapi.NewKeyboardButton(la.getButtonSettingsTitle()),
+		tgbotapi.NewKeyboardButton(la.appMenu.ButtonBackTo(loc)),
+		tgbotapi.NewKeyboardButton(getButtonSettingsTitle(loc)),
+		tgbotapi.NewKeyboardButton(getButtonHistoryTitle(loc)),
 	)
 
 	buttons = append(buttons, backButtonRow)
 
 	menuKeyboard := tgbotapi.NewReplyKeyboard()
 	menuKeyboard.Keyboard = buttons
-	la.menuKeyboard = menuKeyboard
+	return menuKeyboard
 }
 
-func (la *LiveApp) getButtonSettingsTitle() string {
-	msg := la.loc.MustLocalize(&i18n.LocalizeConfig{
+func getButtonSettingsTitle(loc *i18n.Localizer) string {
+	msg := loc.MustLocalize(&i18n.LocalizeConfig{
 		DefaultMessage: &i18n.Message{
 			ID:    "live.buttonSettings",
 			Other: "Settings",
@@ -93,6 +170,16 @@ func (la *LiveApp) getButtonSettingsTitle() string {
 	return msg
 }
 
+func getButtonHistoryTitle(loc *i18n.Localizer) string {
+	msg := loc.MustLocalize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{
+			ID:    "live.buttonHistory",
+			Other: "History",
+		},
+	})
+	return msg
+}
+
 func (la *LiveApp) update(lsid model.LiveSessionInfoData) {
 	la.mu.Lock()
 	defer la.mu.Unlock()
@@ -105,7 +192,16 @@ func (la *LiveApp) update(lsid model.LiveSessionInfoData) {
 			la.servers[idx].ReceivingData = lsid.SessionInfo.ReceivingData
 		}
 	}
-	la.updateKeyboard()
+}
+
+// listServers returns a copy of the servers with their latest names.
+func (la *LiveApp) listServers() []servers.Server {
+	la.mu.Lock()
+	defer la.mu.Unlock()
+
+	ss := make([]servers.Server, len(la.servers))
+	copy(ss, la.servers)
+	return ss
 }
 
 func (la *LiveApp) updater(c <-chan model.LiveSessionInfoData) {
@@ -114,17 +210,67 @@ func (la *LiveApp) updater(c <-chan model.LiveSessionInfoData) {
 	}
 }
 
-func (la *LiveApp) Menu() tgbotapi.ReplyKeyboardMarkup {
+func (la *LiveApp) Menu(ctx context.Context) tgbotapi.ReplyKeyboardMarkup {
+	la.mu.Lock()
+	defer la.mu.Unlock()
+
+	return la.keyboard(ctx)
+}
+
+func (la *LiveApp) getAccepters() []apps.Accepter {
 	la.mu.Lock()
 	defer la.mu.Unlock()
 
-	return la.menuKeyboard
+	return la.accepters
 }
 
 func (la *LiveApp) AcceptCommand(command string) (bool, func(ctx context.Context, chatId int64) error) {
-	for _, accepter := range la.accepters {
+	name, arguments, _ := strings.Cut(command, " ")
+	switch name {
+	case CommandLive:
+		return true, func(ctx context.Context, chatId int64) error {
+			loc := la.locs.FromContext(ctx)
+			return la.sendServers(ctx, chatId, getChooseServerText(loc))
+		}
+	case CommandServers:
+		return true, la.sendServersStatus
+	case CommandGrid, CommandStint, CommandMap, CommandCar:
+		return true, func(ctx context.Context, chatId int64) error {
+			loc := la.locs.FromContext(ctx)
+			serverApp, rest, found := la.splitServer(arguments)
+			if !found {
+				return la.sendServerNotFound(ctx, chatId, arguments)
+			}
+			if !la.canSeeServer(ctx, serverApp.serverID) {
+				return sendMembersOnly(la.bot, chatId, loc)
+			}
+			switch {
+			case name == CommandGrid && rest == "":
+				return serverApp.gridApp.renderGrid(getInlineKeyboardBestLap)(ctx, chatId)
+			case name == CommandGrid:
+				view, found := gridViews[strings.ToLower(rest)]
+				if !found {
+					return la.sendUnknownView(chatId, rest, loc)
+				}
+				return serverApp.gridApp.renderGrid(view)(ctx, chatId)
+			case name == CommandMap:
+				return serverApp.gridApp.sendSnapshot(ctx, chatId)
+			case rest == "":
+				// the stint and car commands list the drivers to choose one
+				return serverApp.stintApp.renderDrivers()(ctx, chatId)
+			case name == CommandStint:
+				return serverApp.stintApp.renderDriver(rest)(ctx, chatId)
+			default:
+				return serverApp.stintApp.renderCar(rest)(ctx, chatId)
+			}
+		}
+	}
+	for _, accepter := range la.getAccepters() {
 		accept, handler := accepter.AcceptCommand(command)
 		if accept {
+			if serverApp, ok := accepter.(*ServerApp); ok {
+				return true, la.checkServerAccess(serverApp.serverID, handler)
+			}
 			return true, handler
 		}
 	}
@@ -133,9 +279,12 @@ func (la *LiveApp) AcceptCommand(command string) (bool, func(ctx context.Context
 }
 
 func (la *LiveApp) AcceptCallback(query *tgbotapi.CallbackQuery) (bool, func(ctx context.Context, query *tgbotapi.CallbackQuery) error) {
-	for _, accepter := range la.accepters {
+	for _, accepter := range la.getAccepters() {
 		accept, handler := accepter.AcceptCallback(query)
 		if accept {
+			if serverApp, ok := accepter.(*ServerApp); ok {
+				return true, la.checkServerAccessCallback(serverApp.serverID, handler)
+			}
 			return true, handler
 		}
 	}
@@ -152,14 +301,14 @@ func (la *LiveApp) AcceptButton(button string) (bool, func(ctx context.Context,
 		return true, func(ctx context.Context, chatId int64) error {
 			message := fmt.Sprintf("%s\n", la.appMenu.Name)
 			msg := tgbotapi.NewMessage(chatId, message)
-			msg.ReplyMarkup = la.menuKeyboard
+			msg.ReplyMarkup = la.Menu(ctx)
 			_, err := la.bot.Send(msg)
 			return err
 		}
-	} else if button == la.appMenu.ButtonBackTo() {
+	} else if la.appMenu.IsButtonBackTo(button) {
 		return true, func(ctx context.Context, chatId int64) error {
 			msg := tgbotapi.NewMessage(chatId, "OK")
-			msg.ReplyMarkup = la.appMenu.PrevMenu()
+			msg.ReplyMarkup = la.appMenu.PrevMenu(ctx)
 			_, err := la.bot.Send(msg)
 			return err
 		}
@@ -167,6 +316,9 @@ func (la *LiveApp) AcceptButton(button string) (bool, func(ctx context.Context,
 	for _, accepter := range la.accepters {
 		accept, handler := accepter.AcceptButton(button)
 		if accept {
+			if serverApp, ok := accepter.(*ServerApp); ok {
+				return true, la.checkServerAccess(serverApp.serverID, handler)
+			}
 			return true, handler
 		}
 	}
@@ -174,3 +326,144 @@ func (la *LiveApp) AcceptButton(button string) (bool, func(ctx context.Context,
 	return false, nil
 
 }
+
+// findServerApp returns the app of the server typed by the user, either its ID
+// or its name. The name may be partial when it matches only one server.
+func (la *LiveApp) findServerApp(server string) (*ServerApp, bool) {
+	la.mu.Lock()
+	defer la.mu.Unlock()
+
+	server = strings.ToLower(strings.TrimSpace(server))
+	if server == "" {
+		return nil, false
+	}
+	matches := []string{}
+	for _, s := range la.servers {
+		name := strings.ToLower(s.Name)
+		if strings.ToLower(s.ID) == server || name == server {
+			return la.serverApps[s.ID], true
+		}
+		if strings.Contains(name, server) {
+			matches = append(matches, s.ID)
+		}
+	}
+	if len(matches) != 1 {
+		return nil, false
+	}
+	return la.serverApps[matches[0]], true
+}
+
+// splitServer splits the arguments of a command into the server, which goes
+// first, and the rest of the arguments. Server names may have spaces, so the
+// longest leading words naming a server are taken.
+func (la *LiveApp) splitServer(arguments string) (*ServerApp, string, bool) {
+	words := strings.Fields(arguments)
+	for i := len(words); i > 0; i-- {
+		if serverApp, found := la.findServerApp(strings.Join(words[:i], " ")); found {
+			return serverApp, strings.Join(words[i:], " "), true
+		}
+	}
+	return nil, "", false
+}
+
+// sendServersStatus lists the servers with their IDs, which the commands take
+// too, and their current sessions.
+func (la *LiveApp) sendServersStatus(ctx context.Context, chatId int64) error {
+	loc := la.locs.FromContext(ctx)
+	carsText := loc.MustLocalize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{
+			ID:    "server.carsInSession",
+			Other: "Cars in session",
+		},
+	})
+
+	la.mu.Lock()
+	lines := []string{}
+	for _, server := range la.servers {
+		if !la.canSeeServer(ctx, server.ID) {
+			continue
+		}
+		line := fmt.Sprintf("%s (%s)", server.StatusAndName(), server.ID)
+		if server.ReceivingData {
+			si := la.serverApps[server.ID].sessionInfo()
+			line += fmt.Sprintf("\n    ‣ %s - %s. %s: %d", si.TrackName, si.Session, carsText, si.NumberOfVehicles)
+		}
+		lines = append(lines, line)
+	}
+	la.mu.Unlock()
+
+	message := loc.MustLocalize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{
+			ID:    "live.servers",
+			Other: "Servers and the IDs the commands take too:\n\n%s",
+		},
+	})
+	return la.sendServers(ctx, chatId, fmt.Sprintf(message, strings.Join(lines, "\n")))
+}
+
+func (la *LiveApp) sendUnknownView(chatId int64, view string, loc *i18n.Localizer) error {
+	views := []string{}
+	for name := range gridViews {
+		views = append(views, name)
+	}
+	sort.Strings(views)
+
+	message := loc.MustLocalize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{
+			ID:    "live.unknownView",
+			Other: "There is no view %q. The views are: %s",
+		},
+	})
+
+	msg := tgbotapi.NewMessage(chatId, fmt.Sprintf(message, view, strings.Join(views, ", ")))
+	_, err := la.bot.Send(msg)
+	return err
+}
+
+// sendServers lists the servers the chat can see with inline buttons, so they
+// can be browsed in groups too.
+func (la *LiveApp) sendServers(ctx context.Context, chatId int64, text string) error {
+	loc := la.locs.FromContext(ctx)
+	rows := [][]tgbotapi.InlineKeyboardButton{}
+	for _, server := range la.visibleServers(ctx) {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(server.StatusAndName(), fmt.Sprintf("%s:%s:%s", subcommandLiveServer, server.ID, liveServerInfo)),
+			tgbotapi.NewInlineKeyboardButtonData(getButtonGridTitle(loc), fmt.Sprintf("%s:%s:%s", subcommandLiveServer, server.ID, liveServerGrid)),
+			tgbotapi.NewInlineKeyboardButtonData(getButtonStintTitle(loc), fmt.Sprintf("%s:%s:%s", subcommandLiveServer, server.ID, liveServerStint)),
+		))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(getButtonSettingsTitle(loc)+" "+symbolNotifications, subcommandNotificationsServers),
+		tgbotapi.NewInlineKeyboardButtonData(getButtonHistoryTitle(loc), subcommandShowHistoryServers),
+	))
+
+	msg := tgbotapi.NewMessage(chatId, text)
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	_, err := la.bot.Send(msg)
+	return err
+}
+
+func (la *LiveApp) sendServerNotFound(ctx context.Context, chatId int64, server string) error {
+	loc := la.locs.FromContext(ctx)
+	text := getChooseServerText(loc)
+	if server != "" {
+		message := loc.MustLocalize(&i18n.LocalizeConfig{
+			DefaultMessage: &i18n.Message{
+				ID:    "live.serverNotFound",
+				Other: "There is no server %q. Choose one of these:",
+			},
+		})
+		text = fmt.Sprintf(message, server)
+	}
+	return la.sendServers(ctx, chatId, text)
+}
+
+func getChooseServerText(loc *i18n.Localizer) string {
+	msg := loc.MustLocalize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{
+			ID:    "live.chooseServer",
+			Other: "Choose the server:",
+		},
+	})
+	return msg
+}
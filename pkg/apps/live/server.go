@@ -9,11 +9,13 @@ import (
 
 	"github.com/oscar-martin/rfactor2telegrambot/pkg/apps"
 	"github.com/oscar-martin/rfactor2telegrambot/pkg/helper"
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/locale"
 	"github.com/oscar-martin/rfactor2telegrambot/pkg/menus"
 	"github.com/oscar-martin/rfactor2telegrambot/pkg/model"
 	"github.com/oscar-martin/rfactor2telegrambot/pkg/pubsub"
 	"github.com/oscar-martin/rfactor2telegrambot/pkg/resources"
 	"github.com/oscar-martin/rfactor2telegrambot/pkg/servers"
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/settings"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/nicksnyder/go-i18n/v2/i18n"
@@ -21,12 +23,17 @@ import (
 
 const (
 	subcommandShowLiveMap = "show_live_map"
+
+	// the servers listed by the live command open these views
+	subcommandLiveServer = "live_server"
+	liveServerInfo       = "info"
+	liveServerGrid       = "grid"
+	liveServerStint      = "stint"
 )
 
 type ServerApp struct {
 	bot                           *tgbotapi.BotAPI
 	appMenu                       menus.ApplicationMenu
-	menuKeyboard                  tgbotapi.ReplyKeyboardMarkup
 	gridApp                       *GridApp
 	stintApp                      *StintApp
 	accepters                     []apps.Accepter
@@ -37,7 +44,7 @@ type ServerApp struct {
 	trackThumbnailData           resources.Resource
 	trackThumbnailDataUpdateChan <-chan resources.Resource
 
-	loc *i18n.Localizer
+	locs *locale.Localizers
 
 	mu sync.Mutex
 }
@@ -49,12 +56,12 @@ func sanitizeServerName(name string) string {
 	return strings.TrimSpace(fixed)
 }
 
-func NewServerApp(bot *tgbotapi.BotAPI, appMenu menus.ApplicationMenu, serverID, serverURL string, loc *i18n.Localizer) *ServerApp {
+func NewServerApp(bot *tgbotapi.BotAPI, appMenu menus.ApplicationMenu, serverID, serverURL string, sm *settings.Manager, locs *locale.Localizers) *ServerApp {
 	sa := &ServerApp{
 		bot:                           bot,
 		appMenu:                       appMenu,
 		serverID:                      serverID,
-		loc:                           loc,
+		locs:                          locs,
 		liveSessionInfoDataUpdateChan: pubsub.LiveSessionInfoDataPubSub.Subscribe(pubsub.PubSubSessionInfoPreffix + serverID),
 		trackThumbnailDataUpdateChan:  pubsub.TrackThumbnailPubSub.Subscribe(pubsub.PubSubThumbnailPreffix + serverID),
 	}
@@ -62,11 +69,11 @@ func NewServerApp(bot *tgbotapi.BotAPI, appMenu menus.ApplicationMenu, serverID,
 	go sa.liveSessionInfoUpdater()
 	go sa.trackThumbnailUpdater()
 
-	gridAppMenu := menus.NewApplicationMenu("", serverID, sa, loc)
-	gridApp := NewGridApp(bot, gridAppMenu, serverID, sa.getButtonGridTitle(), loc)
+	gridAppMenu := menus.NewApplicationMenu("", serverID, sa, locs)
+	gridApp := NewGridApp(bot, gridAppMenu, serverID, serverURL, getButtonGridTitle, locs)
 
-	stintAppMenu := menus.NewApplicationMenu("", serverID, sa, loc)
-	stintApp := NewStintApp(bot, stintAppMenu, serverID, serverURL, sa.getButtonStintTitle(), loc)
+	stintAppMenu := menus.NewApplicationMenu("", serverID, sa, locs)
+	stintApp := NewStintApp(bot, stintAppMenu, serverID, serverURL, getButtonStintTitle, sm, locs)
 
 	accepters := []apps.Accepter{gridApp, stintApp}
 
@@ -79,28 +86,27 @@ func NewServerApp(bot *tgbotapi.BotAPI, appMenu menus.ApplicationMenu, serverID,
 func (sa *ServerApp) update(lsid model.LiveSessionInfoData, t resources.Resource) {
 	sa.mu.Lock()
 	defer sa.mu.Unlock()
-	stint := sa.getButtonStintTitle() + " " + lsid.ServerName
-	grid := sa.getButtonGridTitle() + " " + lsid.ServerName
-	info := sa.getButtonInfoTitle() + " " + lsid.ServerName
-
-	menuKeyboard := tgbotapi.NewReplyKeyboard(
-		tgbotapi.NewKeyboardButtonRow(
-			tgbotapi.NewKeyboardButton(stint),
-			tgbotapi.NewKeyboardButton(grid),
-		),
-		tgbotapi.NewKeyboardButtonRow(
-			tgbotapi.NewKeyboardButton(sa.appMenu.ButtonBackTo()),
-			tgbotapi.NewKeyboardButton(info),
-		),
-	)
-
-	sa.menuKeyboard = menuKeyboard
 	sa.liveSessionInfoData = lsid
 	sa.trackThumbnailData = t
 }
 
-func (sa *ServerApp) getButtonStintTitle() string {
-	msg := sa.loc.MustLocalize(&i18n.LocalizeConfig{
+func (sa *ServerApp) setServerURL(serverURL string) {
+	sa.stintApp.mu.Lock()
+	defer sa.stintApp.mu.Unlock()
+	sa.stintApp.serverURL = serverURL
+	sa.gridApp.mu.Lock()
+	defer sa.gridApp.mu.Unlock()
+	sa.gridApp.serverURL = serverURL
+}
+
+func (sa *ServerApp) sessionInfo() model.SessionInfo {
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+	return sa.liveSessionInfoData.SessionInfo
+}
+
+func getButtonStintTitle(loc *i18n.Localizer) string {
+	msg := loc.MustLocalize(&i18n.LocalizeConfig{
 		DefaultMessage: &i18n.Message{
 			ID:    "serverapp.buttonStint",
 			Other: "Stint",
@@ -109,8 +115,8 @@ func (sa *ServerApp) getButtonStintTitle() string {
 	return msg
 }
 
-func (sa *ServerApp) getButtonGridTitle() string {
-	msg := sa.loc.MustLocalize(&i18n.LocalizeConfig{
+func getButtonGridTitle(loc *i18n.Localizer) string {
+	msg := loc.MustLocalize(&i18n.LocalizeConfig{
 		DefaultMessage: &i18n.Message{
 			ID:    "serverapp.buttonGrid",
 			Other: "Grid",
@@ -119,8 +125,8 @@ func (sa *ServerApp) getButtonGridTitle() string {
 	return msg
 }
 
-func (sa *ServerApp) getButtonInfoTitle() string {
-	msg := sa.loc.MustLocalize(&i18n.LocalizeConfig{
+func getButtonInfoTitle(loc *i18n.Localizer) string {
+	msg := loc.MustLocalize(&i18n.LocalizeConfig{
 		DefaultMessage: &i18n.Message{
 			ID:    "serverapp.buttonInfo",
 			Other: "Info",
@@ -141,8 +147,24 @@ func (sa *ServerApp) trackThumbnailUpdater() {
 	}
 }
 
-func (sa *ServerApp) Menu() tgbotapi.ReplyKeyboardMarkup {
-	return sa.menuKeyboard
+func (sa *ServerApp) Menu(ctx context.Context) tgbotapi.ReplyKeyboardMarkup {
+	loc := sa.locs.FromContext(ctx)
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+	stint := getButtonStintTitle(loc) + " " + sa.liveSessionInfoData.ServerName
+	grid := getButtonGridTitle(loc) + " " + sa.liveSessionInfoData.ServerName
+	info := getButtonInfoTitle(loc) + " " + sa.liveSessionInfoData.ServerName
+
+	return tgbotapi.NewReplyKeyboard(
+		tgbotapi.NewKeyboardButtonRow(
+			tgbotapi.NewKeyboardButton(stint),
+			tgbotapi.NewKeyboardButton(grid),
+		),
+		tgbotapi.NewKeyboardButtonRow(
+			tgbotapi.NewKeyboardButton(sa.appMenu.ButtonBackTo(loc)),
+			tgbotapi.NewKeyboardButton(info),
+		),
+	)
 }
 
 func (sa *ServerApp) AcceptCommand(command string) (bool, func(ctx context.Context, chatId int64) error) {
@@ -157,6 +179,23 @@ func (sa *ServerApp) AcceptCommand(command string) (bool, func(ctx context.Conte
 }
 
 func (sa *ServerApp) AcceptCallback(query *tgbotapi.CallbackQuery) (bool, func(ctx context.Context, query *tgbotapi.CallbackQuery) error) {
+	data := strings.Split(query.Data, ":")
+	if data[0] == subcommandLiveServer && len(data) == 3 && data[1] == sa.serverID {
+		var handler func(ctx context.Context, chatId int64) error
+		switch data[2] {
+		case liveServerInfo:
+			handler = sa.renderInfo()
+		case liveServerGrid:
+			handler = sa.gridApp.renderGrid(getInlineKeyboardBestLap)
+		case liveServerStint:
+			handler = sa.stintApp.renderDrivers()
+		default:
+			return false, nil
+		}
+		return true, func(ctx context.Context, query *tgbotapi.CallbackQuery) error {
+			return handler(ctx, query.Message.Chat.ID)
+		}
+	}
 	for _, accepter := range sa.accepters {
 		accept, handler := accepter.AcceptCallback(query)
 		if accept {
@@ -172,89 +211,114 @@ func (sa *ServerApp) AcceptButton(button string) (bool, func(ctx context.Context
 	defer sa.mu.Unlock()
 
 	// fmt.Printf("SERVER: button: %s. appName: %s\n", button, sa.sessionInfo.ServerName)
-	if sanitizeServerName(button) == sa.liveSessionInfoData.ServerName ||
-		sanitizeServerName(button) == sa.getButtonInfoTitle()+" "+sa.liveSessionInfoData.ServerName {
+	serverName := sa.liveSessionInfoData.ServerName
+	if sanitizeServerName(button) == serverName ||
+		sa.locs.Matches(sanitizeServerName(button), func(loc *i18n.Localizer) string {
+			return getButtonInfoTitle(loc) + " " + serverName
+		}) {
+		return true, sa.renderInfo()
+	} else if sa.appMenu.IsButtonBackTo(button) {
 		return true, func(ctx context.Context, chatId int64) error {
-			if !sa.liveSessionInfoData.SessionInfo.WebSocketRunning {
-				message := sa.loc.MustLocalize(&i18n.LocalizeConfig{
-					DefaultMessage: &i18n.Message{
-						ID:    "server.serverIsOffline",
-						Other: "Server %s is offline",
-					},
-				})
-
-				msg := tgbotapi.NewMessage(chatId, fmt.Sprintf(message, sa.liveSessionInfoData.ServerName))
-				msg.ReplyMarkup = sa.appMenu.PrevMenu()
-				_, err := sa.bot.Send(msg)
-				return err
-			} else if !sa.liveSessionInfoData.SessionInfo.ReceivingData {
-				message := sa.loc.MustLocalize(&i18n.LocalizeConfig{
-					DefaultMessage: &i18n.Message{
-						ID:    "server.noDataReceived",
-						Other: "No data received from server %s",
-					},
-				})
-
-				msg := tgbotapi.NewMessage(chatId, fmt.Sprintf(message, sa.liveSessionInfoData.ServerName))
-				msg.ReplyMarkup = sa.appMenu.PrevMenu()
-				_, err := sa.bot.Send(msg)
-				return err
-			}
-			si := sa.liveSessionInfoData.SessionInfo
-			laps := sa.loc.MustLocalize(&i18n.LocalizeConfig{
-				DefaultMessage: &i18n.Message{
-					ID:    "server.notLimited",
-					Other: "Not Limited",
-				},
-			})
-			if si.MaximumLaps < 100 {
-				laps = fmt.Sprintf("%d", si.MaximumLaps)
+			msg := tgbotapi.NewMessage(chatId, "OK")
+			msg.ReplyMarkup = sa.appMenu.PrevMenu(ctx)
+			_, err := sa.bot.Send(msg)
+			return err
+		}
+	} else {
+		for _, accepter := range sa.accepters {
+			accept, handler := accepter.AcceptButton(button)
+			if accept {
+				return true, handler
 			}
-			trackText := sa.loc.MustLocalize(&i18n.LocalizeConfig{
-				DefaultMessage: &i18n.Message{
-					ID:    "server.track",
-					Other: "Track",
-				},
-			})
-			timeLeftText := sa.loc.MustLocalize(&i18n.LocalizeConfig{
-				DefaultMessage: &i18n.Message{
-					ID:    "server.timeLeft",
-					Other: "Time left",
-				},
-			})
-			sessionText := sa.loc.MustLocalize(&i18n.LocalizeConfig{
-				DefaultMessage: &i18n.Message{
-					ID:    "server.session",
-					Other: "Session",
-				},
-			})
-			lapsText := sa.loc.MustLocalize(&i18n.LocalizeConfig{
-				DefaultMessage: &i18n.Message{
-					ID:    "server.laps",
-					Other: "Laps",
-				},
-			})
-			carsInSessionText := sa.loc.MustLocalize(&i18n.LocalizeConfig{
-				DefaultMessage: &i18n.Message{
-					ID:    "server.carsInSession",
-					Other: "Cars in session",
-				},
-			})
-			rainText := sa.loc.MustLocalize(&i18n.LocalizeConfig{
+		}
+		// fmt.Print("SERVER: FALSE\n")
+		return false, nil
+	}
+}
+
+func (sa *ServerApp) renderInfo() func(ctx context.Context, chatId int64) error {
+	return func(ctx context.Context, chatId int64) error {
+		loc := sa.locs.FromContext(ctx)
+		if !sa.liveSessionInfoData.SessionInfo.WebSocketRunning {
+			message := loc.MustLocalize(&i18n.LocalizeConfig{
 				DefaultMessage: &i18n.Message{
-					ID:    "server.rain",
-					Other: "Rain",
+					ID:    "server.serverIsOffline",
+					Other: "Server %s is offline",
 				},
 			})
 
-			tempText := sa.loc.MustLocalize(&i18n.LocalizeConfig{
+			msg := tgbotapi.NewMessage(chatId, fmt.Sprintf(message, sa.liveSessionInfoData.ServerName))
+			msg.ReplyMarkup = replyMenu(ctx, sa.appMenu.PrevMenu(ctx))
+			_, err := sa.bot.Send(msg)
+			return err
+		} else if !sa.liveSessionInfoData.SessionInfo.ReceivingData {
+			message := loc.MustLocalize(&i18n.LocalizeConfig{
 				DefaultMessage: &i18n.Message{
-					ID:    "server.temp",
-					Other: "Temperature (Track/Ambient)",
+					ID:    "server.noDataReceived",
+					Other: "No data received from server %s",
 				},
 			})
 
-			text := fmt.Sprintf(`%s:
+			msg := tgbotapi.NewMessage(chatId, fmt.Sprintf(message, sa.liveSessionInfoData.ServerName))
+			msg.ReplyMarkup = replyMenu(ctx, sa.appMenu.PrevMenu(ctx))
+			_, err := sa.bot.Send(msg)
+			return err
+		}
+		si := sa.liveSessionInfoData.SessionInfo
+		laps := loc.MustLocalize(&i18n.LocalizeConfig{
+			DefaultMessage: &i18n.Message{
+				ID:    "server.notLimited",
+				Other: "Not Limited",
+			},
+		})
+		if si.MaximumLaps < 100 {
+			laps = fmt.Sprintf("%d", si.MaximumLaps)
+		}
+		trackText := loc.MustLocalize(&i18n.LocalizeConfig{
+			DefaultMessage: &i18n.Message{
+				ID:    "server.track",
+				Other: "Track",
+			},
+		})
+		timeLeftText := loc.MustLocalize(&i18n.LocalizeConfig{
+			DefaultMessage: &i18n.Message{
+				ID:    "server.timeLeft",
+				Other: "Time left",
+			},
+		})
+		sessionText := loc.MustLocalize(&i18n.LocalizeConfig{
+			DefaultMessage: &i18n.Message{
+				ID:    "server.session",
+				Other: "Session",
+			},
+		})
+		lapsText := loc.MustLocalize(&i18n.LocalizeConfig{
+			DefaultMessage: &i18n.Message{
+				ID:    "server.laps",
+				Other: "Laps",
+			},
+		})
+		carsInSessionText := loc.MustLocalize(&i18n.LocalizeConfig{
+			DefaultMessage: &i18n.Message{
+				ID:    "server.carsInSession",
+				Other: "Cars in session",
+			},
+		})
+		rainText := loc.MustLocalize(&i18n.LocalizeConfig{
+			DefaultMessage: &i18n.Message{
+				ID:    "server.rain",
+				Other: "Rain",
+			},
+		})
+
+		tempText := loc.MustLocalize(&i18n.LocalizeConfig{
+			DefaultMessage: &i18n.Message{
+				ID:    "server.temp",
+				Other: "Temperature (Track/Ambient)",
+			},
+		})
+
+		text := fmt.Sprintf(`%s:
 			‣ %s: %s (%0.fm)
 			‣ %s: %s
 			‣ %s: %s (%s: %s)
@@ -262,61 +326,44 @@ func (sa *ServerApp) AcceptButton(button string) (bool, func(ctx context.Context
 			‣ %s: %.1f%% (min: %.1f%%. max: %.1f%%)
 			‣ %s: %0.fºC/%0.fºC
 			`,
-				sa.liveSessionInfoData.ServerName,
-				trackText,
-				si.TrackName,
-				si.LapDistance,
-				timeLeftText,
-				helper.SecondsToHoursAndMinutes(si.EndEventTime-si.CurrentEventTime),
-				sessionText,
-				si.Session,
-				lapsText,
-				laps,
-				carsInSessionText,
-				si.NumberOfVehicles,
-				rainText,
-				si.Raining,
-				si.MinPathWetness,
-				si.MaxPathWetness,
-				tempText,
-				si.TrackTemp,
-				si.AmbientTemp)
-			err := fmt.Errorf("No track thumbnail available")
-			var filePath string
-			if !sa.trackThumbnailData.IsZero() {
-				filePath = sa.trackThumbnailData.FilePath()
-				err = nil
-			}
-			var cfg tgbotapi.Chattable
-			if err != nil {
-				log.Printf("Error getting thumbnail data: %s\n", err.Error())
-				msg := tgbotapi.NewMessage(chatId, text)
-				msg.ReplyMarkup = sa.menuKeyboard
-				cfg = msg
-			} else {
-				msg := tgbotapi.NewPhoto(chatId, tgbotapi.FilePath(filePath))
-				msg.Caption = text
-				msg.ReplyMarkup = sa.menuKeyboard
-				cfg = msg
-			}
-			_, err = sa.bot.Send(cfg)
-			return err
+			sa.liveSessionInfoData.ServerName,
+			trackText,
+			si.TrackName,
+			si.LapDistance,
+			timeLeftText,
+			helper.SecondsToHoursAndMinutes(si.EndEventTime-si.CurrentEventTime),
+			sessionText,
+			si.Session,
+			lapsText,
+			laps,
+			carsInSessionText,
+			si.NumberOfVehicles,
+			rainText,
+			si.Raining,
+			si.MinPathWetness,
+			si.MaxPathWetness,
+			tempText,
+			si.TrackTemp,
+			si.AmbientTemp)
+		err := fmt.Errorf("No track thumbnail available")
+		var filePath string
+		if !sa.trackThumbnailData.IsZero() {
+			filePath = sa.trackThumbnailData.FilePath()
+			err = nil
 		}
-	} else if button == sa.appMenu.ButtonBackTo() {
-		return true, func(ctx context.Context, chatId int64) error {
-			msg := tgbotapi.NewMessage(chatId, "OK")
-			msg.ReplyMarkup = sa.appMenu.PrevMenu()
-			_, err := sa.bot.Send(msg)
-			return err
-		}
-	} else {
-		for _, accepter := range sa.accepters {
-			accept, handler := accepter.AcceptButton(button)
-			if accept {
-				return true, handler
-			}
+		var cfg tgbotapi.Chattable
+		if err != nil {
+			log.Printf("Error getting thumbnail data: %s\n", err.Error())
+			msg := tgbotapi.NewMessage(chatId, text)
+			msg.ReplyMarkup = replyMenu(ctx, sa.Menu(ctx))
+			cfg = msg
+		} else {
+			msg := tgbotapi.NewPhoto(chatId, tgbotapi.FilePath(filePath))
+			msg.Caption = text
+			msg.ReplyMarkup = replyMenu(ctx, sa.Menu(ctx))
+			cfg = msg
 		}
-		// fmt.Print("SERVER: FALSE\n")
-		return false, nil
+		_, err = sa.bot.Send(cfg)
+		return err
 	}
 }
@@ -7,7 +7,9 @@ import (
 	"strings"
 	"sync"
 
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/locale"
 	"github.com/oscar-martin/rfactor2telegrambot/pkg/menus"
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/servers"
 	"github.com/oscar-martin/rfactor2telegrambot/pkg/settings"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
@@ -26,8 +28,20 @@ const (
 	inlineKeyboardWarmup                 = settings.Warmup
 	inlineKeyboardRace                   = settings.Race
 
+	inlineKeyboardRaceFinished = settings.RaceFinished
+
 	symbolNotifications     = "🔔"
 	subcommandNotifications = "notifications"
+
+	subcommandNotificationsServers = "notifications_servers"
+	subcommandNotificationsServer  = "notifications_server"
+
+	symbolLanguage      = "🌐"
+	symbolSelected      = "✅"
+	subcommandLanguages = "languages"
+	subcommandLanguage  = "language"
+
+	CommandNotify = "/notify"
 )
 
 type SettingsApp struct {
@@ -35,43 +49,72 @@ type SettingsApp struct {
 	appMenu      menus.ApplicationMenu
 	menuKeyboard tgbotapi.ReplyKeyboardMarkup
 	sm           *settings.Manager
-	loc          *i18n.Localizer
-	title        string
+	listServers  func(ctx context.Context) []servers.Server
+	locs         *locale.Localizers
+	title        func(loc *i18n.Localizer) string
 	mu           sync.Mutex
 }
 
-func NewSettingsApp(bot *tgbotapi.BotAPI, appMenu menus.ApplicationMenu, sm *settings.Manager, appName string, loc *i18n.Localizer) *SettingsApp {
+func NewSettingsApp(bot *tgbotapi.BotAPI, appMenu menus.ApplicationMenu, sm *settings.Manager, listServers func(ctx context.Context) []servers.Server, appName func(loc *i18n.Localizer) string, locs *locale.Localizers) *SettingsApp {
 	sa := &SettingsApp{
-		bot:     bot,
-		sm:      sm,
-		loc:     loc,
-		title:   appName,
-		appMenu: appMenu,
+		bot:         bot,
+		sm:          sm,
+		listServers: listServers,
+		locs:        locs,
+		title:       appName,
+		appMenu:     appMenu,
 	}
 
 	return sa
 }
 
-func (sa *SettingsApp) Menu() tgbotapi.ReplyKeyboardMarkup {
+func (sa *SettingsApp) Menu(ctx context.Context) tgbotapi.ReplyKeyboardMarkup {
 	return sa.menuKeyboard
 }
 
 func (sa *SettingsApp) AcceptCommand(command string) (bool, func(ctx context.Context, chatId int64) error) {
+	if command == CommandNotify {
+		return true, sa.renderServers(nil)
+	}
 	return false, nil
 }
 
 func (sa *SettingsApp) AcceptCallback(query *tgbotapi.CallbackQuery) (bool, func(ctx context.Context, query *tgbotapi.CallbackQuery) error) {
 	data := strings.Split(query.Data, ":")
-	if data[0] == subcommandNotifications {
+	if data[0] == subcommandNotificationsServers {
+		return true, func(ctx context.Context, query *tgbotapi.CallbackQuery) error {
+			return sa.renderServers(&query.Message.MessageID)(ctx, query.Message.Chat.ID)
+		}
+	} else if data[0] == subcommandNotificationsServer && len(data) == 3 {
+		return true, func(ctx context.Context, query *tgbotapi.CallbackQuery) error {
+			serverID := data[2]
+			return sa.renderNotifications(&query.Message.MessageID, serverID)(ctx, query.Message.Chat.ID)
+		}
+	} else if data[0] == subcommandLanguages {
+		return true, func(ctx context.Context, query *tgbotapi.CallbackQuery) error {
+			return sa.renderLanguages(ctx, query.Message.Chat.ID, query.Message.MessageID)
+		}
+	} else if data[0] == subcommandLanguage && len(data) == 2 && sa.locs.Has(data[1]) {
+		return true, func(ctx context.Context, query *tgbotapi.CallbackQuery) error {
+			allowed, err := checkCanChangeSettings(ctx, sa.bot, query, sa.locs.FromContext(ctx))
+			if !allowed {
+				return err
+			}
+			return sa.setLanguage(ctx, query.Message.Chat.ID, query.Message.MessageID, data[1])
+		}
+	} else if data[0] == subcommandNotifications && len(data) == 4 && settings.IsSessionType(data[3]) {
 		sa.mu.Lock()
 		defer sa.mu.Unlock()
 		return true, func(ctx context.Context, query *tgbotapi.CallbackQuery) error {
-			userID := data[1]
-			sessionType := data[2]
+			loc := sa.locs.FromContext(ctx)
+			serverID := data[2]
+			sessionType := data[3]
 
-			chatCtxValue := ctx.Value(ChatContextKey)
-			if chatCtxValue == nil {
-				message := sa.loc.MustLocalize(&i18n.LocalizeConfig{
+			// the settings of a group are the ones of the group, not the ones
+			// of the user in the callback data
+			userID, chatID, found := subscriber(ctx)
+			if !found {
+				message := loc.MustLocalize(&i18n.LocalizeConfig{
 					DefaultMessage: &i18n.Message{
 						ID:    "settings.chatNotFound",
 						Other: "Could not read chat information",
@@ -79,16 +122,23 @@ func (sa *SettingsApp) AcceptCallback(query *tgbotapi.CallbackQuery) (bool, func
 				})
 
 				msg := tgbotapi.NewMessage(query.Message.Chat.ID, message)
-				msg.ReplyMarkup = sa.appMenu.PrevMenu()
+				msg.ReplyMarkup = replyMenu(ctx, sa.appMenu.PrevMenu(ctx))
 				_, err := sa.bot.Send(msg)
 				return err
 			}
-			chat := chatCtxValue.(*tgbotapi.Chat)
-			chatID := fmt.Sprintf("%d", chat.ID)
+			allowed, err := checkCanChangeSettings(ctx, sa.bot, query, loc)
+			if !allowed {
+				return err
+			}
+			// the callback data can be forged, so only the servers the user
+			// sees are stored
+			if _, found := sa.server(ctx, serverID); !found {
+				return fmt.Errorf("server %s is not configured", serverID)
+			}
 
-			err := sa.sm.ToggleNotificationForSessionStarted(userID, chatID, sessionType)
+			err = sa.sm.ToggleNotificationForSessionStarted(userID, chatID, serverID, sessionType)
 			if err != nil {
-				message := sa.loc.MustLocalize(&i18n.LocalizeConfig{
+				message := loc.MustLocalize(&i18n.LocalizeConfig{
 					DefaultMessage: &i18n.Message{
 						ID:    "settings.couldNotChangeNotificationStatus",
 						Other: "Could not change notification status",
@@ -96,11 +146,11 @@ func (sa *SettingsApp) AcceptCallback(query *tgbotapi.CallbackQuery) (bool, func
 				})
 
 				msg := tgbotapi.NewMessage(query.Message.Chat.ID, message)
-				msg.ReplyMarkup = sa.appMenu.PrevMenu()
+				msg.ReplyMarkup = replyMenu(ctx, sa.appMenu.PrevMenu(ctx))
 				_, err := sa.bot.Send(msg)
 				return err
 			}
-			return sa.renderNotifications(&query.Message.MessageID)(ctx, query.Message.Chat.ID)
+			return sa.renderNotifications(&query.Message.MessageID, serverID)(ctx, query.Message.Chat.ID)
 		}
 	}
 	return false, nil
@@ -111,12 +161,12 @@ func (sa *SettingsApp) AcceptButton(button string) (bool, func(ctx context.Conte
 	defer sa.mu.Unlock()
 
 	// fmt.Printf("SETTINGS: button: %s. appName: %s\n", button, buttonSettings)
-	if button == sa.title {
-		return true, sa.renderNotifications(nil)
-	} else if button == sa.appMenu.ButtonBackTo() {
+	if sa.locs.Matches(button, sa.title) {
+		return true, sa.renderServers(nil)
+	} else if sa.appMenu.IsButtonBackTo(button) {
 		return true, func(ctx context.Context, chatId int64) error {
 			msg := tgbotapi.NewMessage(chatId, "OK")
-			msg.ReplyMarkup = sa.appMenu.PrevMenu()
+			msg.ReplyMarkup = sa.appMenu.PrevMenu(ctx)
 			_, err := sa.bot.Send(msg)
 			return err
 		}
@@ -124,74 +174,231 @@ func (sa *SettingsApp) AcceptButton(button string) (bool, func(ctx context.Conte
 	return false, nil
 }
 
-func (sa *SettingsApp) renderNotifications(messageID *int) func(ctx context.Context, chatId int64) error {
+func (sa *SettingsApp) renderServers(messageID *int) func(ctx context.Context, chatId int64) error {
 	return func(ctx context.Context, chatId int64) error {
-		userCtxValue := ctx.Value(UserContextKey)
-		if userCtxValue == nil {
-			message := sa.loc.MustLocalize(&i18n.LocalizeConfig{
-				DefaultMessage: &i18n.Message{
-					ID:    "settings.userNotFound",
-					Other: "Could not read user",
-				},
-			})
-
-			msg := tgbotapi.NewMessage(chatId, message)
-			msg.ReplyMarkup = sa.appMenu.PrevMenu()
-			_, err := sa.bot.Send(msg)
+		loc := sa.locs.FromContext(ctx)
+		userID, err := sa.userID(ctx, chatId)
+		if userID == "" {
 			return err
 		}
-		user := userCtxValue.(*tgbotapi.User)
-		userID := fmt.Sprintf("%d", user.ID)
-		notificationStatus, err := sa.sm.ListNotifications(userID)
+		notificationStatus, err := sa.sm.ListServerNotifications(userID)
 		if err != nil {
 			log.Println(err)
-			message := sa.loc.MustLocalize(&i18n.LocalizeConfig{
-				DefaultMessage: &i18n.Message{
-					ID:    "settings.couldNotReadNotifications",
-					Other: "Could not read notifications for user",
-				},
-			})
-
-			msg := tgbotapi.NewMessage(chatId, message)
-			msg.ReplyMarkup = sa.appMenu.PrevMenu()
-			_, err := sa.bot.Send(msg)
+			return sa.sendCouldNotReadNotifications(ctx, chatId, loc)
+		}
+		keyboard := getSettingsServersInlineKeyboard(userID, sa.listServers(ctx), notificationStatus, loc)
+		text := loc.MustLocalize(&i18n.LocalizeConfig{
+			DefaultMessage: &i18n.Message{
+				ID:    "settings.chooseServer",
+				Other: "Choose the server to configure its notifications",
+			},
+		})
+		return sa.send(chatId, messageID, text, keyboard)
+	}
+}
+
+func (sa *SettingsApp) renderNotifications(messageID *int, serverID string) func(ctx context.Context, chatId int64) error {
+	return func(ctx context.Context, chatId int64) error {
+		loc := sa.locs.FromContext(ctx)
+		userID, err := sa.userID(ctx, chatId)
+		if userID == "" {
 			return err
 		}
-		keyboard := getSettingsInlineKeyboard(userID, notificationStatus)
-		text := sa.loc.MustLocalize(&i18n.LocalizeConfig{
+		notificationStatus, err := sa.sm.ListNotifications(userID, serverID)
+		if err != nil {
+			log.Println(err)
+			return sa.sendCouldNotReadNotifications(ctx, chatId, loc)
+		}
+		server, found := sa.server(ctx, serverID)
+		if !found && sa.sm.IsMembersOnly(serverID) {
+			return sendMembersOnly(sa.bot, chatId, loc)
+		} else if !found {
+			return fmt.Errorf("server %s is not configured", serverID)
+		}
+		keyboard := getSettingsInlineKeyboard(userID, serverID, notificationStatus, loc)
+		message := loc.MustLocalize(&i18n.LocalizeConfig{
 			DefaultMessage: &i18n.Message{
-				ID:    "settings.notifications",
-				Other: "Notification status\n(Only notifies the first session)",
+				ID:    "settings.serverNotifications",
+				Other: "Notification status for %s\n(Only notifies the first session)",
 			},
 		})
+		return sa.send(chatId, messageID, fmt.Sprintf(message, server.Name), keyboard)
+	}
+}
 
-		var cfg tgbotapi.Chattable
-		if messageID == nil {
-			msg := tgbotapi.NewMessage(chatId, text)
-			msg.ReplyMarkup = keyboard
-			cfg = msg
-		} else {
-			msg := tgbotapi.NewEditMessageText(chatId, *messageID, text)
-			msg.ReplyMarkup = &keyboard
-			cfg = msg
+// server returns the configured server with the ID if the user of the context
+// can see it.
+func (sa *SettingsApp) server(ctx context.Context, serverID string) (servers.Server, bool) {
+	for _, server := range sa.listServers(ctx) {
+		if server.ID == serverID {
+			return server, true
 		}
-		_, err = sa.bot.Send(cfg)
-		return err
 	}
+	return servers.Server{}, false
 }
 
-func getSettingsInlineKeyboard(userID string, n settings.Notifications) tgbotapi.InlineKeyboardMarkup {
+// userID reads the ID the settings of the chat are stored with from the
+// context: the one of the user in private chats and the one of the group in
+// groups. When it is not there, the user is told so and an empty ID is
+// returned.
+func (sa *SettingsApp) userID(ctx context.Context, chatId int64) (string, error) {
+	userID, _, found := subscriber(ctx)
+	if !found {
+		loc := sa.locs.FromContext(ctx)
+		message := loc.MustLocalize(&i18n.LocalizeConfig{
+			DefaultMessage: &i18n.Message{
+				ID:    "settings.userNotFound",
+				Other: "Could not read user",
+			},
+		})
+
+		msg := tgbotapi.NewMessage(chatId, message)
+		msg.ReplyMarkup = replyMenu(ctx, sa.appMenu.PrevMenu(ctx))
+		_, err := sa.bot.Send(msg)
+		return "", err
+	}
+	return userID, nil
+}
+
+func (sa *SettingsApp) sendCouldNotReadNotifications(ctx context.Context, chatId int64, loc *i18n.Localizer) error {
+	message := loc.MustLocalize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{
+			ID:    "settings.couldNotReadNotifications",
+			Other: "Could not read notifications for user",
+		},
+	})
+
+	msg := tgbotapi.NewMessage(chatId, message)
+	msg.ReplyMarkup = replyMenu(ctx, sa.appMenu.PrevMenu(ctx))
+	_, err := sa.bot.Send(msg)
+	return err
+}
+
+func (sa *SettingsApp) send(chatId int64, messageID *int, text string, keyboard tgbotapi.InlineKeyboardMarkup) error {
+	var cfg tgbotapi.Chattable
+	if messageID == nil {
+		msg := tgbotapi.NewMessage(chatId, text)
+		msg.ReplyMarkup = keyboard
+		cfg = msg
+	} else {
+		msg := tgbotapi.NewEditMessageText(chatId, *messageID, text)
+		msg.ReplyMarkup = &keyboard
+		cfg = msg
+	}
+	_, err := sa.bot.Send(cfg)
+	return err
+}
+
+func getSettingsServersInlineKeyboard(userID string, ss []servers.Server, ns map[string]settings.Notifications, loc *i18n.Localizer) tgbotapi.InlineKeyboardMarkup {
+	rows := [][]tgbotapi.InlineKeyboardButton{}
+	for _, server := range ss {
+		symbol := ns[server.ID].Symbol()
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(server.Name+" "+symbol, fmt.Sprintf("%s:%s:%s", subcommandNotificationsServer, userID, server.ID)),
+		))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(getInlineKeyboardLanguage(loc)+" "+symbolLanguage, subcommandLanguages),
+	))
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+func getSettingsInlineKeyboard(userID, serverID string, n settings.Notifications, loc *i18n.Localizer) tgbotapi.InlineKeyboardMarkup {
+	callbackData := func(sessionType string) string {
+		return fmt.Sprintf("%s:%s:%s:%s", subcommandNotifications, userID, serverID, sessionType)
+	}
 	return tgbotapi.NewInlineKeyboardMarkup(
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData(inlineKeyboardTestday+" "+n.TestDaySymbol(), fmt.Sprintf("%s:%s:%s", subcommandNotifications, userID, inlineKeyboardTestday)),
-			tgbotapi.NewInlineKeyboardButtonData(inlineKeyboardPractice+" "+n.PracticeSymbol(), fmt.Sprintf("%s:%s:%s", subcommandNotifications, userID, inlineKeyboardPractice)),
+			tgbotapi.NewInlineKeyboardButtonData(inlineKeyboardTestday+" "+n.TestDaySymbol(), callbackData(inlineKeyboardTestday)),
+			tgbotapi.NewInlineKeyboardButtonData(inlineKeyboardPractice+" "+n.PracticeSymbol(), callbackData(inlineKeyboardPractice)),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(inlineKeyboardQual+" "+n.QualSymbol(), callbackData(inlineKeyboardQual)),
+			tgbotapi.NewInlineKeyboardButtonData(inlineKeyboardWarmup+" "+n.WarmupSymbol(), callbackData(inlineKeyboardWarmup)),
 		),
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData(inlineKeyboardQual+" "+n.QualSymbol(), fmt.Sprintf("%s:%s:%s", subcommandNotifications, userID, inlineKeyboardQual)),
-			tgbotapi.NewInlineKeyboardButtonData(inlineKeyboardWarmup+" "+n.WarmupSymbol(), fmt.Sprintf("%s:%s:%s", subcommandNotifications, userID, inlineKeyboardWarmup)),
+			tgbotapi.NewInlineKeyboardButtonData(inlineKeyboardRace+" "+n.RaceSymbol(), callbackData(inlineKeyboardRace)),
+			tgbotapi.NewInlineKeyboardButtonData(inlineKeyboardRaceFinished+" "+n.RaceFinishedSymbol(), callbackData(inlineKeyboardRaceFinished)),
 		),
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData(inlineKeyboardRace+" "+n.RaceSymbol(), fmt.Sprintf("%s:%s:%s", subcommandNotifications, userID, inlineKeyboardRace)),
+			tgbotapi.NewInlineKeyboardButtonData(getInlineKeyboardBack(loc), fmt.Sprintf("%s:%s", subcommandNotificationsServers, userID)),
 		),
 	)
 }
+
+// renderLanguages lists the languages the bot speaks. The language of the user
+// is checked.
+func (sa *SettingsApp) renderLanguages(ctx context.Context, chatId int64, messageID int) error {
+	loc := sa.locs.FromContext(ctx)
+	userID, err := sa.userID(ctx, chatId)
+	if userID == "" {
+		return err
+	}
+	current, err := sa.sm.StoredLanguage(userID)
+	if err != nil {
+		log.Printf("Error reading the language of user %s: %s\n", userID, err.Error())
+	}
+
+	rows := [][]tgbotapi.InlineKeyboardButton{}
+	for _, lang := range sa.locs.Languages() {
+		title := sa.locs.Name(lang)
+		if lang == current {
+			title += " " + symbolSelected
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(title, fmt.Sprintf("%s:%s", subcommandLanguage, lang)),
+		))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(getInlineKeyboardBack(loc), fmt.Sprintf("%s:%s", subcommandNotificationsServers, userID)),
+	))
+
+	text := loc.MustLocalize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{
+			ID:    "settings.chooseLanguage",
+			Other: "Choose the language of the bot",
+		},
+	})
+	return sa.send(chatId, &messageID, text, tgbotapi.NewInlineKeyboardMarkup(rows...))
+}
+
+// setLanguage stores the language chosen by the user and sends the menu again,
+// as the buttons of the menu the user has are in the previous language.
+func (sa *SettingsApp) setLanguage(ctx context.Context, chatId int64, messageID int, lang string) error {
+	userID, err := sa.userID(ctx, chatId)
+	if userID == "" {
+		return err
+	}
+	err = sa.sm.SetLanguage(userID, lang)
+	if err != nil {
+		loc := sa.locs.FromContext(ctx)
+		message := loc.MustLocalize(&i18n.LocalizeConfig{
+			DefaultMessage: &i18n.Message{
+				ID:    "settings.couldNotChangeLanguage",
+				Other: "Could not change the language",
+			},
+		})
+
+		msg := tgbotapi.NewMessage(chatId, message)
+		_, err := sa.bot.Send(msg)
+		return err
+	}
+
+	loc := sa.locs.Get(lang)
+	ctx = locale.NewContext(ctx, loc)
+	err = sa.renderLanguages(ctx, chatId, messageID)
+	if err != nil && !isMessageNotModified(err) {
+		return err
+	}
+
+	message := loc.MustLocalize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{
+			ID:    "settings.languageChanged",
+			Other: "The language is now %s",
+		},
+	})
+	msg := tgbotapi.NewMessage(chatId, fmt.Sprintf(message, sa.locs.Name(lang)))
+	msg.ReplyMarkup = replyMenu(ctx, sa.appMenu.PrevMenu(ctx))
+	_, err = sa.bot.Send(msg)
+	return err
+}
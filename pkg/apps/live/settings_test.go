@@ -0,0 +1,42 @@
+package live
+
+import (
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestSettingsAppAcceptCallback(t *testing.T) {
+	tests := []struct {
+		data string
+		want bool
+	}{
+		{"notifications_servers", true},
+		{"notifications_server:1:server1", true},
+		{"notifications_server:1", false},
+		{"notifications:1:server1:Race", true},
+		{"notifications:1:server1:RaceFinished", true},
+		{"notifications:1:server1:race = 1 OR 1", false},
+		{"notifications:1:server1", false},
+		{"notifications:1:server1:Race:extra", false},
+		{"notifications", false},
+		{"languages", true},
+		{"language:en", true},
+		{"language:es", true},
+		{"language:xx", false},
+		{"language:' OR '1'='1", false},
+		{"language:en:extra", false},
+		{"language", false},
+		{"", false},
+	}
+
+	sa := &SettingsApp{locs: newTestLocalizers(t)}
+	for _, tt := range tests {
+		t.Run(tt.data, func(t *testing.T) {
+			got, _ := sa.AcceptCallback(&tgbotapi.CallbackQuery{Data: tt.data})
+			if got != tt.want {
+				t.Errorf("got %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
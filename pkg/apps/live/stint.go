@@ -10,10 +10,12 @@ import (
 	"time"
 
 	"github.com/oscar-martin/rfactor2telegrambot/pkg/helper"
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/locale"
 	"github.com/oscar-martin/rfactor2telegrambot/pkg/menus"
 	"github.com/oscar-martin/rfactor2telegrambot/pkg/model"
 	"github.com/oscar-martin/rfactor2telegrambot/pkg/pubsub"
 	"github.com/oscar-martin/rfactor2telegrambot/pkg/resources"
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/settings"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/jedib0t/go-pretty/v6/table"
@@ -23,6 +25,8 @@ import (
 const (
 	subcommandShowDrivers = "show_drivers"
 	subcommandShowCars    = "show_cars"
+
+	subcommandFollowDriver = "follow_driver"
 )
 
 type StintApp struct {
@@ -32,23 +36,25 @@ type StintApp struct {
 	serverURL                         string
 	liveStandingHistoryData           model.LiveStandingHistoryData
 	liveStandingHistoryDataUpdateChan <-chan model.LiveStandingHistoryData
-	appName                           string
+	appName                           func(loc *i18n.Localizer) string
 
 	liveSessionInfoData           model.LiveSessionInfoData
 	liveSessionInfoDataUpdateChan <-chan model.LiveSessionInfoData
 
-	loc *i18n.Localizer
+	sm   *settings.Manager
+	locs *locale.Localizers
 
 	mu sync.Mutex
 }
 
-func NewStintApp(bot *tgbotapi.BotAPI, appMenu menus.ApplicationMenu, serverID, serverURL string, appName string, loc *i18n.Localizer) *StintApp {
+func NewStintApp(bot *tgbotapi.BotAPI, appMenu menus.ApplicationMenu, serverID, serverURL string, appName func(loc *i18n.Localizer) string, sm *settings.Manager, locs *locale.Localizers) *StintApp {
 	sa := &StintApp{
 		bot:                               bot,
 		appMenu:                           appMenu,
 		serverID:                          serverID,
 		serverURL:                         serverURL,
-		loc:                               loc,
+		sm:                                sm,
+		locs:                              locs,
 		appName:                           appName,
 		liveStandingHistoryDataUpdateChan: pubsub.LiveStandingHistoryPubSub.Subscribe(pubsub.PubSubStintDataPreffix + serverID),
 		liveSessionInfoDataUpdateChan:     pubsub.LiveSessionInfoDataPubSub.Subscribe(pubsub.PubSubSessionInfoPreffix + serverID),
@@ -85,17 +91,44 @@ func (sa *StintApp) AcceptCommand(command string) (bool, func(ctx context.Contex
 
 func (sa *StintApp) AcceptCallback(query *tgbotapi.CallbackQuery) (bool, func(ctx context.Context, query *tgbotapi.CallbackQuery) error) {
 	data := strings.Split(query.Data, ":")
-	if data[0] == subcommandShowDrivers && data[1] == sa.serverID {
+	if data[0] == subcommandShowDrivers && len(data) >= 4 && data[1] == sa.serverID {
+		sa.mu.Lock()
+		defer sa.mu.Unlock()
+		return true, func(ctx context.Context, query *tgbotapi.CallbackQuery) error {
+			return sa.handleStintDataCallbackQuery(ctx, query.Message.Chat.ID, &query.Message.MessageID, data[2:]...)
+		}
+	} else if data[0] == subcommandFollowDriver && len(data) >= 3 && data[1] == sa.serverID {
 		sa.mu.Lock()
 		defer sa.mu.Unlock()
 		return true, func(ctx context.Context, query *tgbotapi.CallbackQuery) error {
-			return sa.handleStintDataCallbackQuery(query.Message.Chat.ID, &query.Message.MessageID, data[2:]...)
+			allowed, err := checkCanChangeSettings(ctx, sa.bot, query, sa.locs.FromContext(ctx))
+			if !allowed {
+				return err
+			}
+			return sa.handleFollowDriverCallbackQuery(ctx, query.Message.Chat.ID, &query.Message.MessageID, strings.Join(data[2:], ":"))
 		}
-	} else if data[0] == subcommandShowCars && data[1] == sa.serverID {
+	} else if data[0] == subcommandShowCars && len(data) >= 3 && data[1] == sa.serverID {
 		sa.mu.Lock()
 		defer sa.mu.Unlock()
 		return true, func(ctx context.Context, query *tgbotapi.CallbackQuery) error {
-			return sa.handleCarDataCallbackQuery(query.Message.Chat.ID, &query.Message.MessageID, data[2])
+			return sa.handleCarDataCallbackQuery(query.Message.Chat.ID, &query.Message.MessageID, data[2], sa.locs.FromContext(ctx))
+		}
+	} else if data[0] == subcommandPickRival && len(data) == 3 && data[1] == sa.serverID {
+		return true, func(ctx context.Context, query *tgbotapi.CallbackQuery) error {
+			return sa.handlePickRivalCallbackQuery(query.Message.Chat.ID, query.Message.MessageID, data[2], sa.locs.FromContext(ctx))
+		}
+	} else if data[0] == subcommandCompareDrivers && len(data) == 5 && data[1] == sa.serverID {
+		return true, func(ctx context.Context, query *tgbotapi.CallbackQuery) error {
+			return sa.handleCompareDriversCallbackQuery(query.Message.Chat.ID, query.Message.MessageID, data[2], data[3], data[4], sa.locs.FromContext(ctx))
+		}
+	} else if data[0] == subcommandShowChart && (len(data) == 3 || len(data) == 4) && data[1] == sa.serverID {
+		return true, func(ctx context.Context, query *tgbotapi.CallbackQuery) error {
+			// only the lap times chart is for a driver
+			driverID := ""
+			if len(data) == 4 {
+				driverID = data[3]
+			}
+			return sa.sendChart(query.Message.Chat.ID, data[2], driverID, sa.locs.FromContext(ctx))
 		}
 	}
 	return false, nil
@@ -106,12 +139,13 @@ func (sa *StintApp) AcceptButton(button string) (bool, func(ctx context.Context,
 	defer sa.mu.Unlock()
 
 	// fmt.Printf("STINT: button: %s. appName: %s\n", button, buttonStint+" "+sa.stintData.ServerName)
-	if button == sa.appName+" "+sa.liveStandingHistoryData.ServerName {
+	serverName := sa.liveStandingHistoryData.ServerName
+	if sa.locs.Matches(button, func(loc *i18n.Localizer) string { return sa.appName(loc) + " " + serverName }) {
 		return true, sa.renderDrivers()
-	} else if button == sa.appMenu.ButtonBackTo() {
+	} else if sa.appMenu.IsButtonBackTo(button) {
 		return true, func(ctx context.Context, chatId int64) error {
 			msg := tgbotapi.NewMessage(chatId, "OK")
-			msg.ReplyMarkup = sa.appMenu.PrevMenu()
+			msg.ReplyMarkup = sa.appMenu.PrevMenu(ctx)
 			_, err := sa.bot.Send(msg)
 			return err
 		}
@@ -122,13 +156,14 @@ func (sa *StintApp) AcceptButton(button string) (bool, func(ctx context.Context,
 
 func (sa *StintApp) renderDrivers() func(ctx context.Context, chatId int64) error {
 	return func(ctx context.Context, chatId int64) error {
+		loc := sa.locs.FromContext(ctx)
 		if len(sa.liveStandingHistoryData.DriverNames) > 0 {
-			err := sa.sendDriversData(chatId, nil)
+			err := sa.sendDriversData(chatId, nil, sa.followedDrivers(ctx), loc)
 			if err != nil {
 				return err
 			}
 		} else {
-			message := sa.loc.MustLocalize(&i18n.LocalizeConfig{
+			message := loc.MustLocalize(&i18n.LocalizeConfig{
 				DefaultMessage: &i18n.Message{
 					ID:    "stint.noDriversInSession",
 					Other: "There are no drivers in the session",
@@ -143,17 +178,127 @@ func (sa *StintApp) renderDrivers() func(ctx context.Context, chatId int64) erro
 	}
 }
 
-func (sa *StintApp) handleStintDataCallbackQuery(chatId int64, messageId *int, data ...string) error {
+// findDriver returns the driver of the session typed by the user, either its
+// name or its code. The name may be partial when it matches only one driver.
+func (sa *StintApp) findDriver(driver string) (string, bool) {
+	sa.mu.Lock()
+	defer sa.mu.Unlock()
+
+	driver = strings.ToLower(strings.TrimSpace(driver))
+	matches := []string{}
+	for _, name := range sa.liveStandingHistoryData.DriverNames {
+		if strings.ToLower(name) == driver || strings.ToLower(helper.GetDriverCodeName(name)) == driver {
+			return name, true
+		}
+		if strings.Contains(strings.ToLower(name), driver) {
+			matches = append(matches, name)
+		}
+	}
+	if len(matches) != 1 {
+		return "", false
+	}
+	return matches[0], true
+}
+
+// renderDriver sends the laps of the driver typed by the user.
+func (sa *StintApp) renderDriver(driver string) func(ctx context.Context, chatId int64) error {
+	return func(ctx context.Context, chatId int64) error {
+		name, found := sa.findDriver(driver)
+		if !found {
+			return sa.sendUnknownDriver(chatId, driver, sa.locs.FromContext(ctx))
+		}
+		return sa.handleStintDataCallbackQuery(ctx, chatId, nil, getInlineKeyboardTimes(sa.locs.FromContext(ctx)), name)
+	}
+}
+
+// renderCar sends the car of the driver typed by the user.
+func (sa *StintApp) renderCar(driver string) func(ctx context.Context, chatId int64) error {
+	return func(ctx context.Context, chatId int64) error {
+		name, found := sa.findDriver(driver)
+		if !found {
+			return sa.sendUnknownDriver(chatId, driver, sa.locs.FromContext(ctx))
+		}
+		return sa.handleCarDataCallbackQuery(chatId, nil, name, sa.locs.FromContext(ctx))
+	}
+}
+
+func (sa *StintApp) sendUnknownDriver(chatId int64, driver string, loc *i18n.Localizer) error {
+	sa.mu.Lock()
+	serverName := sa.liveStandingHistoryData.ServerName
+	sa.mu.Unlock()
+
+	message := loc.MustLocalize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{
+			ID:    "stint.driverNotFound",
+			Other: "There is no driver %q in %s",
+		},
+	})
+
+	msg := tgbotapi.NewMessage(chatId, fmt.Sprintf(message, driver, serverName))
+	_, err := sa.bot.Send(msg)
+	return err
+}
+
+// followedDrivers returns the drivers followed by the user in the context or,
+// in groups, by the group.
+func (sa *StintApp) followedDrivers(ctx context.Context) map[string]bool {
+	userID, _, found := subscriber(ctx)
+	if !found {
+		return map[string]bool{}
+	}
+	followed, err := sa.sm.ListFollowedDrivers(userID)
+	if err != nil {
+		log.Printf("Error listing followed drivers: %s", err.Error())
+	}
+	return followed
+}
+
+func (sa *StintApp) handleFollowDriverCallbackQuery(ctx context.Context, chatId int64, messageId *int, driver string) error {
+	loc := sa.locs.FromContext(ctx)
+	userID, chatID, found := subscriber(ctx)
+	if !found {
+		message := loc.MustLocalize(&i18n.LocalizeConfig{
+			DefaultMessage: &i18n.Message{
+				ID:    "settings.userNotFound",
+				Other: "Could not read user",
+			},
+		})
+
+		msg := tgbotapi.NewMessage(chatId, message)
+		_, err := sa.bot.Send(msg)
+		return err
+	}
+
+	_, err := sa.sm.ToggleFollowedDriver(userID, chatID, driver)
+	if err != nil {
+		log.Printf("Error following driver %s: %s", driver, err.Error())
+		message := loc.MustLocalize(&i18n.LocalizeConfig{
+			DefaultMessage: &i18n.Message{
+				ID:    "stint.couldNotFollowDriver",
+				Other: "Could not change the follow status of the driver %s",
+			},
+		})
+
+		msg := tgbotapi.NewMessage(chatId, fmt.Sprintf(message, driver))
+		_, err := sa.bot.Send(msg)
+		return err
+	}
+	return sa.handleStintDataCallbackQuery(ctx, chatId, messageId, getInlineKeyboardTimes(loc), driver)
+}
+
+func (sa *StintApp) handleStintDataCallbackQuery(ctx context.Context, chatId int64, messageId *int, data ...string) error {
+	loc := sa.locs.FromContext(ctx)
 	infoType := data[0]
 	driver := data[1]
 	driverData, found := sa.liveStandingHistoryData.DriversData[driver]
 	if found {
-		err := sa.sendStintData(chatId, messageId, driverData, driver, sa.liveStandingHistoryData.ServerName, sa.liveStandingHistoryData.ServerID, infoType)
+		following := sa.followedDrivers(ctx)[driver]
+		err := sa.sendStintData(chatId, messageId, driverData, driver, sa.liveStandingHistoryData.ServerName, sa.liveStandingHistoryData.ServerID, infoType, following, loc)
 		if err != nil {
 			log.Printf("An error occured: %s", err.Error())
 		}
 	} else {
-		text := sa.loc.MustLocalize(&i18n.LocalizeConfig{
+		text := loc.MustLocalize(&i18n.LocalizeConfig{
 			DefaultMessage: &i18n.Message{
 				ID:    "stint.noDataForDriver",
 				Other: "No data for driver %s",
@@ -168,7 +313,7 @@ func (sa *StintApp) handleStintDataCallbackQuery(chatId int64, messageId *int, d
 	return nil
 }
 
-func (sa *StintApp) handleCarDataCallbackQuery(chatId int64, messageId *int, driver string) error {
+func (sa *StintApp) handleCarDataCallbackQuery(chatId int64, messageId *int, driver string, loc *i18n.Localizer) error {
 	driverData, found := sa.liveStandingHistoryData.DriversData[driver]
 	if found && len(driverData) > 0 {
 		if driverData[0].CarId != "" {
@@ -186,7 +331,7 @@ func (sa *StintApp) handleCarDataCallbackQuery(chatId int64, messageId *int, dri
 			}()
 			select {
 			case <-ctx.Done():
-				text := sa.loc.MustLocalize(&i18n.LocalizeConfig{
+				text := loc.MustLocalize(&i18n.LocalizeConfig{
 					DefaultMessage: &i18n.Message{
 						ID:    "stint.timeoutDownloadingCarImage",
 						Other: "The waiting time for downloading the car image for %s has expired",
@@ -198,7 +343,7 @@ func (sa *StintApp) handleCarDataCallbackQuery(chatId int64, messageId *int, dri
 				_, err := sa.bot.Send(msg)
 				return err
 			case err := <-errChan:
-				text := sa.loc.MustLocalize(&i18n.LocalizeConfig{
+				text := loc.MustLocalize(&i18n.LocalizeConfig{
 					DefaultMessage: &i18n.Message{
 						ID:    "stint.couldNotReadCarImage",
 						Other: "Could not read the image of the car %s: %v",
@@ -211,19 +356,19 @@ func (sa *StintApp) handleCarDataCallbackQuery(chatId int64, messageId *int, dri
 				return err
 			case carTh := <-carThChan:
 				filePath := carTh.FilePath()
-				carText := sa.loc.MustLocalize(&i18n.LocalizeConfig{
+				carText := loc.MustLocalize(&i18n.LocalizeConfig{
 					DefaultMessage: &i18n.Message{
 						ID:    "stint.car",
 						Other: "Car",
 					},
 				})
-				classText := sa.loc.MustLocalize(&i18n.LocalizeConfig{
+				classText := loc.MustLocalize(&i18n.LocalizeConfig{
 					DefaultMessage: &i18n.Message{
 						ID:    "stint.class",
 						Other: "Class",
 					},
 				})
-				driverText := sa.loc.MustLocalize(&i18n.LocalizeConfig{
+				driverText := loc.MustLocalize(&i18n.LocalizeConfig{
 					DefaultMessage: &i18n.Message{
 						ID:    "stint.driver",
 						Other: "Driver",
@@ -245,7 +390,7 @@ func (sa *StintApp) handleCarDataCallbackQuery(chatId int64, messageId *int, dri
 				return err
 			}
 		} else {
-			text := sa.loc.MustLocalize(&i18n.LocalizeConfig{
+			text := loc.MustLocalize(&i18n.LocalizeConfig{
 				DefaultMessage: &i18n.Message{
 					ID:    "stint.noDataForDriver",
 					Other: "No data for driver %s",
@@ -257,7 +402,7 @@ func (sa *StintApp) handleCarDataCallbackQuery(chatId int64, messageId *int, dri
 			return err
 		}
 	} else {
-		text := sa.loc.MustLocalize(&i18n.LocalizeConfig{
+		text := loc.MustLocalize(&i18n.LocalizeConfig{
 			DefaultMessage: &i18n.Message{
 				ID:    "stint.noDataForDriver",
 				Other: "No data for driver %s",
@@ -271,65 +416,22 @@ func (sa *StintApp) handleCarDataCallbackQuery(chatId int64, messageId *int, dri
 	}
 }
 
-func (sa *StintApp) sendStintData(chatId int64, messageId *int, driverData []model.StandingHistoryDriverData, driverName, serverName, serverId, infoType string) error {
+func (sa *StintApp) sendStintData(chatId int64, messageId *int, driverData []model.StandingHistoryDriverData, driverName, serverName, serverId, infoType string, following bool, loc *i18n.Localizer) error {
 	if len(driverData) > 0 {
-		var b bytes.Buffer
-		t := table.NewWriter()
-		t.SetOutputMirror(&b)
-		style := table.StyleRounded
-		style.Options.DrawBorder = false
-		t.SetStyle(style)
-		t.AppendSeparator()
-		switch infoType {
-		case getInlineKeyboardTimes(sa.loc):
-			t.AppendHeader(table.Row{getLapHeader(sa.loc), infoType, getTopSpeedHeader(sa.loc)})
-		case getInlineKeyboardSectors(sa.loc):
-			t.AppendHeader(table.Row{getLapHeader(sa.loc), infoType})
-		}
-		for idx, lapData := range driverData {
-			switch infoType {
-			case getInlineKeyboardTimes(sa.loc):
-				topSpeed := "-"
-				if lapData.TopSpeed > 0 && lapData.LapTime > 0 {
-					topSpeed = fmt.Sprintf("%.1f km/h", lapData.TopSpeed)
-				}
-
-				t.AppendRow([]interface{}{
-					fmt.Sprintf("%d", idx+1),
-					helper.SecondsToMinutes(lapData.LapTime),
-					topSpeed,
-				})
-			case getInlineKeyboardSectors(sa.loc):
-				ls1 := lapData.SectorTime1
-				ls2 := -1.0
-				if ls1 > 0.0 && lapData.SectorTime2 > 0.0 {
-					ls2 = lapData.SectorTime2 - ls1
-				}
-				ls3 := -1.0
-				if ls2 > 0.0 && lapData.LapTime > 0.0 {
-					ls3 = lapData.LapTime - ls2 - ls1
-				}
+		tableText := buildStintTable(driverData, infoType, loc)
 
-				t.AppendRow([]interface{}{
-					fmt.Sprintf("%d", idx+1),
-					fmt.Sprintf("%s %s %s", helper.ToSectorTime(ls1), helper.ToSectorTime(ls2), helper.ToSectorTime(ls3)),
-				})
-			}
-		}
-		t.Render()
-
-		keyboard := getStintInlineKeyboard(driverName, serverId, sa.loc)
+		keyboard := getStintInlineKeyboard(driverName, serverId, following, loc)
 		var cfg tgbotapi.Chattable
 		remainingTime := helper.SecondsToHoursAndMinutes(sa.liveSessionInfoData.SessionInfo.EndEventTime - sa.liveSessionInfoData.SessionInfo.CurrentEventTime)
 
-		message := sa.loc.MustLocalize(&i18n.LocalizeConfig{
+		message := loc.MustLocalize(&i18n.LocalizeConfig{
 			DefaultMessage: &i18n.Message{
 				ID:    "stint.sessionData",
 				Other: "```\nTime left: %s\nData for %s in %q\n\n%s```",
 			},
 		})
 
-		text := fmt.Sprintf(message, remainingTime, driverName, serverName, b.String())
+		text := fmt.Sprintf(message, remainingTime, driverName, serverName, tableText)
 		if messageId == nil {
 			msg := tgbotapi.NewMessage(chatId, text)
 			msg.ParseMode = tgbotapi.ModeMarkdownV2
@@ -344,7 +446,7 @@ func (sa *StintApp) sendStintData(chatId int64, messageId *int, driverData []mod
 		_, err := sa.bot.Send(cfg)
 		return err
 	} else {
-		message := sa.loc.MustLocalize(&i18n.LocalizeConfig{
+		message := loc.MustLocalize(&i18n.LocalizeConfig{
 			DefaultMessage: &i18n.Message{
 				ID:    "stint.noLapsInSession",
 				Other: "There are no laps in the session",
@@ -357,7 +459,69 @@ func (sa *StintApp) sendStintData(chatId int64, messageId *int, driverData []mod
 	}
 }
 
-func getStintInlineKeyboard(driver, serverID string, loc *i18n.Localizer) tgbotapi.InlineKeyboardMarkup {
+// buildStintTable renders the laps of a driver for the given info type
+func buildStintTable(driverData []model.StandingHistoryDriverData, infoType string, loc *i18n.Localizer) string {
+	var b bytes.Buffer
+	t := table.NewWriter()
+	t.SetOutputMirror(&b)
+	style := table.StyleRounded
+	style.Options.DrawBorder = false
+	t.SetStyle(style)
+	t.AppendSeparator()
+	switch infoType {
+	case getInlineKeyboardTimes(loc):
+		t.AppendHeader(table.Row{getLapHeader(loc), infoType, getTopSpeedHeader(loc)})
+	case getInlineKeyboardSectors(loc):
+		t.AppendHeader(table.Row{getLapHeader(loc), infoType})
+	}
+	for idx, lapData := range driverData {
+		switch infoType {
+		case getInlineKeyboardTimes(loc):
+			topSpeed := "-"
+			if lapData.TopSpeed > 0 && lapData.LapTime > 0 {
+				topSpeed = fmt.Sprintf("%.1f km/h", lapData.TopSpeed)
+			}
+
+			t.AppendRow([]interface{}{
+				fmt.Sprintf("%d", idx+1),
+				helper.SecondsToMinutes(lapData.LapTime),
+				topSpeed,
+			})
+		case getInlineKeyboardSectors(loc):
+			ls1, ls2, ls3 := lapSectors(lapData)
+			t.AppendRow([]interface{}{
+				fmt.Sprintf("%d", idx+1),
+				fmt.Sprintf("%s %s %s", helper.ToSectorTime(ls1), helper.ToSectorTime(ls2), helper.ToSectorTime(ls3)),
+			})
+		}
+	}
+	t.Render()
+	return b.String()
+}
+
+// lapSectors returns the times of the sectors of the lap or -1 for the
+// sectors without time.
+func lapSectors(lapData model.StandingHistoryDriverData) (float64, float64, float64) {
+	ls1 := lapData.SectorTime1
+	if ls1 <= 0.0 {
+		ls1 = -1.0
+	}
+	ls2 := -1.0
+	if ls1 > 0.0 && lapData.SectorTime2 > 0.0 {
+		ls2 = lapData.SectorTime2 - ls1
+	}
+	ls3 := -1.0
+	if ls2 > 0.0 && lapData.LapTime > 0.0 {
+		ls3 = lapData.LapTime - ls2 - ls1
+	}
+	return ls1, ls2, ls3
+}
+
+func getStintInlineKeyboard(driver, serverID string, following bool, loc *i18n.Localizer) tgbotapi.InlineKeyboardMarkup {
+	followTitle := getInlineKeyboardFollow(loc) + " " + symbolFollow
+	if following {
+		followTitle = getInlineKeyboardUnfollow(loc) + " " + symbolUnfollow
+	}
 	return tgbotapi.NewInlineKeyboardMarkup(
 		tgbotapi.NewInlineKeyboardRow(
 			tgbotapi.NewInlineKeyboardButtonData(getInlineKeyboardTimes(loc)+" "+symbolTimes, fmt.Sprintf("%s:%s:%s:%s", subcommandShowDrivers, serverID, getInlineKeyboardTimes(loc), driver)),
@@ -365,12 +529,17 @@ func getStintInlineKeyboard(driver, serverID string, loc *i18n.Localizer) tgbota
 		),
 		tgbotapi.NewInlineKeyboardRow(
 			tgbotapi.NewInlineKeyboardButtonData(getInlineKeyboardCar(loc)+" "+symbolPhoto, fmt.Sprintf("%s:%s:%s", subcommandShowCars, serverID, driver)),
+			tgbotapi.NewInlineKeyboardButtonData(followTitle, fmt.Sprintf("%s:%s:%s", subcommandFollowDriver, serverID, driver)),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(getInlineKeyboardLapTimesChart(loc)+" "+symbolChart, fmt.Sprintf("%s:%s:%s:%s", subcommandShowChart, serverID, chartLapTimes, helper.ToID(driver))),
+			tgbotapi.NewInlineKeyboardButtonData(getInlineKeyboardCompare(loc)+" "+symbolCompare, fmt.Sprintf("%s:%s:%s", subcommandPickRival, serverID, helper.ToID(driver))),
 		),
 	)
 }
 
-func (sa *StintApp) sendDriversData(chatId int64, messageId *int) error {
-	text, keyboard := sa.driversTextMarkup()
+func (sa *StintApp) sendDriversData(chatId int64, messageId *int, followed map[string]bool, loc *i18n.Localizer) error {
+	text, keyboard := sa.driversTextMarkup(followed, loc)
 
 	var cfg tgbotapi.Chattable
 	if messageId == nil {
@@ -387,17 +556,23 @@ func (sa *StintApp) sendDriversData(chatId int64, messageId *int) error {
 	return err
 }
 
-func (sa *StintApp) driversTextMarkup() (text string, markup tgbotapi.InlineKeyboardMarkup) {
+// driversTextMarkup lists the drivers of the session. The drivers followed by
+// the user are marked with a star.
+func (sa *StintApp) driversTextMarkup(followed map[string]bool, loc *i18n.Localizer) (text string, markup tgbotapi.InlineKeyboardMarkup) {
 	buttons := [][]tgbotapi.InlineKeyboardButton{}
 
 	for idx, driver := range sa.liveStandingHistoryData.DriverNames {
 		if idx%2 == 0 {
 			buttons = append(buttons, []tgbotapi.InlineKeyboardButton{})
 		}
-		buttons[len(buttons)-1] = append(buttons[len(buttons)-1], tgbotapi.NewInlineKeyboardButtonData(driver, fmt.Sprintf("%s:%s:%s:%s", subcommandShowDrivers, sa.liveStandingHistoryData.ServerID, getInlineKeyboardTimes(sa.loc), driver)))
+		title := driver
+		if followed[driver] {
+			title = symbolFollow + " " + driver
+		}
+		buttons[len(buttons)-1] = append(buttons[len(buttons)-1], tgbotapi.NewInlineKeyboardButtonData(title, fmt.Sprintf("%s:%s:%s:%s", subcommandShowDrivers, sa.liveStandingHistoryData.ServerID, getInlineKeyboardTimes(loc), driver)))
 	}
 
-	msg := sa.loc.MustLocalize(&i18n.LocalizeConfig{
+	msg := loc.MustLocalize(&i18n.LocalizeConfig{
 		DefaultMessage: &i18n.Message{
 			ID:    "stint.chooseDriverFromList",
 			Other: "Choose the driver from the list:",
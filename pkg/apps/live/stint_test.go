@@ -0,0 +1,79 @@
+package live
+
+import (
+	"testing"
+
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/helper"
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/model"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestStintAppAcceptCallback(t *testing.T) {
+	tests := []struct {
+		data string
+		want bool
+	}{
+		{"show_drivers:server1:Times:Driver", true},
+		{"show_drivers:server2:Times:Driver", false},
+		{"show_drivers:server1:Times", false},
+		{"show_drivers", false},
+		{"follow_driver:server1:Driver", true},
+		{"follow_driver:server1", false},
+		{"follow_driver", false},
+		{"show_cars:server1:Driver", true},
+		{"show_cars:server1", false},
+		{"show_cars", false},
+		{"compare_driver:server1:123", true},
+		{"compare_driver:server1", false},
+		{"compare_driver:server1:123:456", false},
+		{"compare_driver", false},
+		{"compare_drivers:server1:t:123:456", true},
+		{"compare_drivers:server1:t:123", false},
+		{"compare_drivers:server1:t:123:456:789", false},
+		{"compare_drivers", false},
+		{"show_chart:server1:laps:123", true},
+		{"show_chart:server1:pos", true},
+		{"show_chart:server1:gap", true},
+		{"show_chart:server1:laps:123:456", false},
+		{"show_chart:server1", false},
+		{"show_chart", false},
+		{"", false},
+	}
+
+	sa := &StintApp{serverID: "server1"}
+	for _, tt := range tests {
+		t.Run(tt.data, func(t *testing.T) {
+			got, _ := sa.AcceptCallback(&tgbotapi.CallbackQuery{Data: tt.data})
+			if got != tt.want {
+				t.Errorf("got %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDriverByID(t *testing.T) {
+	history := model.LiveStandingHistoryData{
+		DriverNames: []string{"Driver One", "Driver: Two"},
+	}
+	tests := []struct {
+		name      string
+		id        string
+		want      string
+		wantFound bool
+	}{
+		{"first driver", helper.ToID("Driver One"), "Driver One", true},
+		{"driver with the separator", helper.ToID("Driver: Two"), "Driver: Two", true},
+		{"unknown driver", helper.ToID("Driver Three"), "", false},
+		{"forged ID", "Driver One", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, found := driverByID(history, tt.id)
+			if got != tt.want || found != tt.wantFound {
+				t.Errorf("got (%q, %t), want (%q, %t)", got, found, tt.want, tt.wantFound)
+			}
+		})
+	}
+}
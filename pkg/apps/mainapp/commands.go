@@ -0,0 +1,214 @@
+package mainapp
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/apps/live"
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/locale"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+type botCommand struct {
+	command     string
+	arguments   string
+	description string
+}
+
+// commands returns the commands listed in the start message and registered
+// in Telegram, with the arguments they take.
+func commands(loc *i18n.Localizer) []botCommand {
+	server := loc.MustLocalize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{
+			ID:    "mainapp.argumentServer",
+			Other: "server",
+		},
+	})
+	driver := loc.MustLocalize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{
+			ID:    "mainapp.argumentDriver",
+			Other: "driver",
+		},
+	})
+	view := loc.MustLocalize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{
+			ID:    "mainapp.argumentView",
+			Other: "view",
+		},
+	})
+
+	return []botCommand{
+		{
+			command: menuMenu,
+			description: loc.MustLocalize(&i18n.LocalizeConfig{
+				// MessageID: "mainapp.startMenu",
+				DefaultMessage: &i18n.Message{
+					ID:    "mainapp.startMenu",
+					Other: "Show the bot menu",
+				},
+			}),
+		},
+		{
+			command: live.CommandLive,
+			description: loc.MustLocalize(&i18n.LocalizeConfig{
+				DefaultMessage: &i18n.Message{
+					ID:    "mainapp.startLive",
+					Other: "List the servers",
+				},
+			}),
+		},
+		{
+			command: live.CommandServers,
+			description: loc.MustLocalize(&i18n.LocalizeConfig{
+				DefaultMessage: &i18n.Message{
+					ID:    "mainapp.startServers",
+					Other: "Show the status and the IDs of the servers",
+				},
+			}),
+		},
+		{
+			command:   live.CommandGrid,
+			arguments: fmt.Sprintf("<%s> [%s]", server, view),
+			description: loc.MustLocalize(&i18n.LocalizeConfig{
+				DefaultMessage: &i18n.Message{
+					ID:    "mainapp.startGrid",
+					Other: "Show the standings of a server",
+				},
+			}),
+		},
+		{
+			command:   live.CommandStint,
+			arguments: fmt.Sprintf("<%s> [%s]", server, driver),
+			description: loc.MustLocalize(&i18n.LocalizeConfig{
+				DefaultMessage: &i18n.Message{
+					ID:    "mainapp.startStint",
+					Other: "Show the laps of the drivers of a server",
+				},
+			}),
+		},
+		{
+			command:   live.CommandMap,
+			arguments: fmt.Sprintf("<%s>", server),
+			description: loc.MustLocalize(&i18n.LocalizeConfig{
+				DefaultMessage: &i18n.Message{
+					ID:    "mainapp.startMap",
+					Other: "Show where the cars of a server are on the track",
+				},
+			}),
+		},
+		{
+			command:   live.CommandCar,
+			arguments: fmt.Sprintf("<%s> <%s>", server, driver),
+			description: loc.MustLocalize(&i18n.LocalizeConfig{
+				DefaultMessage: &i18n.Message{
+					ID:    "mainapp.startCar",
+					Other: "Show the car of a driver",
+				},
+			}),
+		},
+		{
+			command: live.CommandNotify,
+			description: loc.MustLocalize(&i18n.LocalizeConfig{
+				DefaultMessage: &i18n.Message{
+					ID:    "mainapp.startNotify",
+					Other: "Configure the notifications",
+				},
+			}),
+		},
+		{
+			command: live.CommandJoin,
+			description: loc.MustLocalize(&i18n.LocalizeConfig{
+				DefaultMessage: &i18n.Message{
+					ID:    "mainapp.startJoin",
+					Other: "Ask the admins to see the members only servers",
+				},
+			}),
+		},
+	}
+}
+
+// adminCommands returns the commands only the admins can use, listed in the
+// start message of the admins.
+func adminCommands(loc *i18n.Localizer) []botCommand {
+	user := loc.MustLocalize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{
+			ID:    "mainapp.argumentUser",
+			Other: "user ID",
+		},
+	})
+
+	return []botCommand{
+		{
+			command: live.CommandRequests,
+			description: loc.MustLocalize(&i18n.LocalizeConfig{
+				DefaultMessage: &i18n.Message{
+					ID:    "mainapp.startRequests",
+					Other: "List the join requests",
+				},
+			}),
+		},
+		{
+			command:   live.CommandApprove,
+			arguments: fmt.Sprintf("<%s>", user),
+			description: loc.MustLocalize(&i18n.LocalizeConfig{
+				DefaultMessage: &i18n.Message{
+					ID:    "mainapp.startApprove",
+					Other: "Let a user or a group see the members only servers",
+				},
+			}),
+		},
+		{
+			command:   live.CommandDeny,
+			arguments: fmt.Sprintf("<%s>", user),
+			description: loc.MustLocalize(&i18n.LocalizeConfig{
+				DefaultMessage: &i18n.Message{
+					ID:    "mainapp.startDeny",
+					Other: "Deny a user or a group the use of the bot",
+				},
+			}),
+		},
+	}
+}
+
+// RegisterCommands sets the commands the Telegram clients suggest in every
+// language of the bot. The default language is used for the rest.
+func RegisterCommands(bot *tgbotapi.BotAPI, locs *locale.Localizers) error {
+	for idx, lang := range locs.Languages() {
+		loc := locs.Get(lang)
+		tgCommands := []tgbotapi.BotCommand{
+			{
+				Command: strings.TrimPrefix(menuStart, "/"),
+				Description: loc.MustLocalize(&i18n.LocalizeConfig{
+					DefaultMessage: &i18n.Message{
+						ID:    "mainapp.startStart",
+						Other: "Give a welcome message",
+					},
+				}),
+			},
+		}
+		for _, c := range commands(loc) {
+			description := c.description
+			if c.arguments != "" {
+				description = fmt.Sprintf("%s: %s", description, c.arguments)
+			}
+			tgCommands = append(tgCommands, tgbotapi.BotCommand{
+				Command:     strings.TrimPrefix(c.command, "/"),
+				Description: description,
+			})
+		}
+
+		cfg := tgbotapi.NewSetMyCommands(tgCommands...)
+		if idx > 0 {
+			cfg = tgbotapi.NewSetMyCommandsWithScopeAndLanguage(tgbotapi.NewBotCommandScopeDefault(), lang, tgCommands...)
+		}
+		_, err := bot.Request(cfg)
+		if err != nil {
+			log.Printf("Error registering the commands in %s: %s\n", lang, err.Error())
+			return err
+		}
+	}
+	return nil
+}
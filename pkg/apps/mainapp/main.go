@@ -6,7 +6,9 @@ import (
 
 	"github.com/oscar-martin/rfactor2telegrambot/pkg/apps"
 	"github.com/oscar-martin/rfactor2telegrambot/pkg/apps/live"
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/locale"
 	"github.com/oscar-martin/rfactor2telegrambot/pkg/menus"
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/results"
 	"github.com/oscar-martin/rfactor2telegrambot/pkg/servers"
 	"github.com/oscar-martin/rfactor2telegrambot/pkg/settings"
 
@@ -19,6 +21,9 @@ const (
 	menuMenu   = "/menu"
 	appName    = "menu"
 	buttonLive = "Live"
+
+	maxInlineResults = 50
+	inlineCacheTime  = 5
 )
 
 var (
@@ -31,19 +36,20 @@ var (
 
 type menuer struct{}
 
-func (m menuer) Menu() tgbotapi.ReplyKeyboardMarkup {
+func (m menuer) Menu(ctx context.Context) tgbotapi.ReplyKeyboardMarkup {
 	return menuKeyboard
 }
 
 type MainApp struct {
 	bot       *tgbotapi.BotAPI
 	accepters []apps.Accepter
-	loc       *i18n.Localizer
+	sm        *settings.Manager
+	locs      *locale.Localizers
 }
 
-func NewMainApp(ctx context.Context, bot *tgbotapi.BotAPI, ss []servers.Server, exitChan chan bool, sm *settings.Manager, loc *i18n.Localizer) (*MainApp, error) {
-	liveAppMenu := menus.NewApplicationMenu(buttonLive, appName, menuer{}, loc)
-	liveApp, err := live.NewLiveApp(ctx, bot, ss, liveAppMenu, sm, loc)
+func NewMainApp(ctx context.Context, bot *tgbotapi.BotAPI, ss []servers.Server, exitChan chan bool, sm *settings.Manager, rm *results.Manager, locs *locale.Localizers) (*MainApp, error) {
+	liveAppMenu := menus.NewApplicationMenu(buttonLive, appName, menuer{}, locs)
+	liveApp, err := live.NewLiveApp(ctx, bot, ss, liveAppMenu, sm, rm, locs)
 	if err != nil {
 		return nil, err
 	}
@@ -52,21 +58,22 @@ func NewMainApp(ctx context.Context, bot *tgbotapi.BotAPI, ss []servers.Server,
 
 	return &MainApp{
 		bot:       bot,
-		loc:       loc,
+		sm:        sm,
+		locs:      locs,
 		accepters: accepters,
 	}, nil
 }
 
 func (m *MainApp) AcceptCommand(command string) (bool, func(ctx context.Context, chatId int64) error) {
 	if command == menuStart {
-		return true, m.renderStart()
+		return true, m.authorize(m.renderStart())
 	} else if command == menuMenu {
-		return true, m.renderMenu()
+		return true, m.authorize(m.renderMenu())
 	}
 	for _, accepter := range m.accepters {
 		accept, handler := accepter.AcceptCommand(command)
 		if accept {
-			return true, handler
+			return true, m.authorize(handler)
 		}
 	}
 
@@ -77,7 +84,7 @@ func (m *MainApp) AcceptCallback(query *tgbotapi.CallbackQuery) (bool, func(ctx
 	for _, accepter := range m.accepters {
 		accept, handler := accepter.AcceptCallback(query)
 		if accept {
-			return true, handler
+			return true, m.authorizeCallback(handler)
 		}
 	}
 
@@ -88,15 +95,80 @@ func (m *MainApp) AcceptButton(button string) (bool, func(ctx context.Context, c
 	for _, accepter := range m.accepters {
 		accept, handler := accepter.AcceptButton(button)
 		if accept {
-			return true, handler
+			return true, m.authorize(handler)
 		}
 	}
 	return false, nil
 }
 
+// isDenied returns whether the admins denied the user of the context or, in
+// groups, the group the use of the bot.
+func (m *MainApp) isDenied(ctx context.Context) bool {
+	user, ok := ctx.Value(live.UserContextKey).(*tgbotapi.User)
+	if !ok {
+		return true
+	}
+	if m.sm.IsDenied(fmt.Sprintf("%d", user.ID)) {
+		return true
+	}
+	chat, ok := ctx.Value(live.ChatContextKey).(*tgbotapi.Chat)
+	return ok && !chat.IsPrivate() && m.sm.IsDenied(fmt.Sprintf("%d", chat.ID))
+}
+
+// authorize wraps the handler so the users denied by the admins are only told
+// so. The handlers of the apps check the access to the servers.
+func (m *MainApp) authorize(handler func(ctx context.Context, chatId int64) error) func(ctx context.Context, chatId int64) error {
+	return func(ctx context.Context, chatId int64) error {
+		if !m.isDenied(ctx) {
+			return handler(ctx, chatId)
+		}
+		msg := tgbotapi.NewMessage(chatId, live.GetDeniedText(m.locs.FromContext(ctx)))
+		_, err := m.bot.Send(msg)
+		return err
+	}
+}
+
+// authorizeCallback is authorize for the inline buttons.
+func (m *MainApp) authorizeCallback(handler func(ctx context.Context, query *tgbotapi.CallbackQuery) error) func(ctx context.Context, query *tgbotapi.CallbackQuery) error {
+	return func(ctx context.Context, query *tgbotapi.CallbackQuery) error {
+		if !m.isDenied(ctx) {
+			return handler(ctx, query)
+		}
+		_, err := m.bot.Request(tgbotapi.NewCallbackWithAlert(query.ID, live.GetDeniedText(m.locs.FromContext(ctx))))
+		return err
+	}
+}
+
+// AnswerInlineQuery answers the inline query with the results of the apps.
+// Denied users get none. Live data gets old soon, so Telegram caches them for a few seconds only.
+// The results depend on the servers the user can see, so they are cached per user.
+func (m *MainApp) AnswerInlineQuery(ctx context.Context, query *tgbotapi.InlineQuery) error {
+	results := []interface{}{}
+	if !m.isDenied(ctx) {
+		for _, accepter := range m.accepters {
+			if querier, ok := accepter.(apps.InlineQuerier); ok {
+				results = append(results, querier.InlineResults(ctx, query.Query)...)
+			}
+		}
+	}
+	// Telegram does not take more results
+	if len(results) > maxInlineResults {
+		results = results[:maxInlineResults]
+	}
+
+	_, err := m.bot.Request(tgbotapi.InlineConfig{
+		InlineQueryID: query.ID,
+		Results:       results,
+		CacheTime:     inlineCacheTime,
+		IsPersonal:    true,
+	})
+	return err
+}
+
 func (m *MainApp) renderStart() func(ctx context.Context, chatId int64) error {
 	return func(ctx context.Context, chatId int64) error {
-		msg1 := m.loc.MustLocalize(&i18n.LocalizeConfig{
+		loc := m.locs.FromContext(ctx)
+		msg1 := loc.MustLocalize(&i18n.LocalizeConfig{
 			// MessageID: "mainapp.helloBot1",
 			DefaultMessage: &i18n.Message{
 				ID:    "mainapp.helloBot1",
@@ -104,25 +176,31 @@ func (m *MainApp) renderStart() func(ctx context.Context, chatId int64) error {
 			},
 		})
 
-		msg2 := m.loc.MustLocalize(&i18n.LocalizeConfig{
+		msg2 := loc.MustLocalize(&i18n.LocalizeConfig{
 			// MessageID: "mainapp.helloBot2",
 			DefaultMessage: &i18n.Message{
 				ID:    "mainapp.helloBot2",
-				Other: "You can use the following command:",
-			},
-		})
-
-		msgStartMenu := m.loc.MustLocalize(&i18n.LocalizeConfig{
-			// MessageID: "mainapp.startMenu",
-			DefaultMessage: &i18n.Message{
-				ID:    "mainapp.startMenu",
-				Other: "Show the bot menu",
+				Other: "You can use the following commands:",
 			},
 		})
 
-		message := fmt.Sprintf("%s\n\n", msg1) + fmt.Sprintf("%s\n\n", msg2) + fmt.Sprintf("%s - %s\n", menuMenu, msgStartMenu)
+		message := fmt.Sprintf("%s\n\n", msg1) + fmt.Sprintf("%s\n\n", msg2)
+		cs := commands(loc)
+		if user, ok := ctx.Value(live.UserContextKey).(*tgbotapi.User); ok && m.sm.IsAdmin(fmt.Sprintf("%d", user.ID)) {
+			cs = append(cs, adminCommands(loc)...)
+		}
+		for _, c := range cs {
+			if c.arguments != "" {
+				message += fmt.Sprintf("%s %s - %s\n", c.command, c.arguments, c.description)
+			} else {
+				message += fmt.Sprintf("%s - %s\n", c.command, c.description)
+			}
+		}
 		msg := tgbotapi.NewMessage(chatId, message)
-		msg.ReplyMarkup = menuKeyboard
+		// reply keyboards would be shown to every member of a group
+		if !live.IsGroupChat(ctx) {
+			msg.ReplyMarkup = menuKeyboard
+		}
 		_, err := m.bot.Send(msg)
 		return err
 	}
@@ -130,7 +208,14 @@ func (m *MainApp) renderStart() func(ctx context.Context, chatId int64) error {
 
 func (m *MainApp) renderMenu() func(ctx context.Context, chatId int64) error {
 	return func(ctx context.Context, chatId int64) error {
-		msgMenuMenu := m.loc.MustLocalize(&i18n.LocalizeConfig{
+		// groups get the servers with inline buttons instead of the menu
+		if live.IsGroupChat(ctx) {
+			if accept, handler := m.AcceptCommand(live.CommandLive); accept {
+				return handler(ctx, chatId)
+			}
+		}
+		loc := m.locs.FromContext(ctx)
+		msgMenuMenu := loc.MustLocalize(&i18n.LocalizeConfig{
 			// MessageID: "mainapp.menuMenu",
 			DefaultMessage: &i18n.Message{
 				ID:    "mainapp.menuMenu",
@@ -0,0 +1,312 @@
+package charts
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"sync"
+
+	"github.com/llgcode/draw2d/draw2dimg"
+	"github.com/llgcode/draw2d/draw2dkit"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gomonobold"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	width        = 1200
+	height       = 700
+	marginLeft   = 110
+	marginRight  = 90
+	marginTop    = 60
+	marginBottom = 70
+	fontSize     = 16.0
+	titleSize    = 22.0
+	yTicks       = 6
+	maxXTicks    = 15
+)
+
+var (
+	backgroundColor = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	axisColor       = color.RGBA{0x39, 0x39, 0x39, 0xff}
+	gridColor       = color.RGBA{0xdd, 0xdd, 0xdd, 0xff}
+	markColor       = color.RGBA{0xf3, 0x9c, 0x12, 0xff}
+
+	faces    map[float64]font.Face
+	facesErr error
+	facesMu  sync.Mutex
+)
+
+// point of a series. Points with a NaN Y break the line.
+type point struct {
+	X float64
+	Y float64
+}
+
+type series struct {
+	name   string
+	color  color.Color
+	points []point
+}
+
+// chart is a line chart. The X axis is always made of laps.
+type chart struct {
+	title  string
+	xLabel string
+	// the series are drawn in order and labeled at their last point
+	series []series
+	// vertical lines at these X values, like the pit laps
+	marks     []float64
+	markLabel string
+	// the lowest values are drawn at the top, like the positions
+	invertY bool
+	// integerY draws a tick for every integer value when they fit
+	integerY bool
+	yFormat  func(float64) string
+}
+
+func face(size float64) (font.Face, error) {
+	facesMu.Lock()
+	defer facesMu.Unlock()
+	if facesErr != nil {
+		return nil, facesErr
+	}
+	if f, found := faces[size]; found {
+		return f, nil
+	}
+	f, err := opentype.Parse(gomonobold.TTF)
+	if err != nil {
+		facesErr = err
+		return nil, err
+	}
+	ff, err := opentype.NewFace(f, &opentype.FaceOptions{Size: size, DPI: 72})
+	if err != nil {
+		facesErr = err
+		return nil, err
+	}
+	if faces == nil {
+		faces = map[float64]font.Face{}
+	}
+	faces[size] = ff
+	return ff, nil
+}
+
+// render draws the chart and returns it encoded as PNG.
+func (c chart) render() ([]byte, error) {
+	textFace, err := face(fontSize)
+	if err != nil {
+		return nil, err
+	}
+	titleFace, err := face(titleSize)
+	if err != nil {
+		return nil, err
+	}
+
+	rect := image.Rect(0, 0, width, height)
+	dest := image.NewRGBA(rect)
+	draw.Draw(dest, rect, image.NewUniform(backgroundColor), image.Point{}, draw.Src)
+	gc := draw2dimg.NewGraphicContext(dest)
+
+	minX, maxX, minY, maxY := c.bounds()
+	plotW := float64(width - marginLeft - marginRight)
+	plotH := float64(height - marginTop - marginBottom)
+	toX := func(x float64) float64 {
+		return marginLeft + (x-minX)/(maxX-minX)*plotW
+	}
+	toY := func(y float64) float64 {
+		f := (y - minY) / (maxY - minY)
+		if !c.invertY {
+			f = 1.0 - f
+		}
+		return marginTop + f*plotH
+	}
+
+	// grid and ticks
+	text := font.Drawer{Dst: dest, Src: image.NewUniform(axisColor), Face: textFace}
+	xStep := math.Max(1.0, math.Ceil((maxX-minX)/maxXTicks))
+	for x := minX; x <= maxX; x += xStep {
+		line(gc, toX(x), marginTop, toX(x), marginTop+plotH, gridColor, 1)
+		label := formatInt(x)
+		drawString(&text, label, toX(x)-textWidth(&text, label)/2, marginTop+plotH+fontSize+6)
+	}
+	for _, y := range c.yTickValues(minY, maxY) {
+		line(gc, marginLeft, toY(y), marginLeft+plotW, toY(y), gridColor, 1)
+		label := c.yFormat(y)
+		drawString(&text, label, marginLeft-textWidth(&text, label)-8, toY(y)+fontSize/3)
+	}
+
+	// axes
+	line(gc, marginLeft, marginTop, marginLeft, marginTop+plotH, axisColor, 2)
+	line(gc, marginLeft, marginTop+plotH, marginLeft+plotW, marginTop+plotH, axisColor, 2)
+	drawString(&text, c.xLabel, marginLeft+plotW/2-textWidth(&text, c.xLabel)/2, height-20)
+
+	// marks
+	for _, x := range c.marks {
+		gc.SetLineDash([]float64{8, 6}, 0)
+		line(gc, toX(x), marginTop, toX(x), marginTop+plotH, markColor, 2)
+		gc.SetLineDash(nil, 0)
+	}
+	if len(c.marks) > 0 && c.markLabel != "" {
+		markText := font.Drawer{Dst: dest, Src: image.NewUniform(markColor), Face: textFace}
+		drawString(&markText, c.markLabel, marginLeft+plotW-textWidth(&markText, c.markLabel), marginTop-10)
+	}
+
+	// series
+	for _, s := range c.series {
+		gc.SetStrokeColor(s.color)
+		gc.SetFillColor(s.color)
+		gc.SetLineWidth(3)
+		drawing := false
+		labeled := false
+		var last point
+		for _, p := range s.points {
+			if math.IsNaN(p.Y) {
+				if drawing {
+					gc.Stroke()
+				}
+				drawing = false
+				continue
+			}
+			if !drawing {
+				gc.MoveTo(toX(p.X), toY(p.Y))
+				drawing = true
+			} else {
+				gc.LineTo(toX(p.X), toY(p.Y))
+			}
+			last = p
+			labeled = true
+		}
+		if drawing {
+			gc.Stroke()
+		}
+		for _, p := range s.points {
+			if !math.IsNaN(p.Y) {
+				draw2dkit.Circle(gc, toX(p.X), toY(p.Y), 4)
+				gc.Fill()
+			}
+		}
+		if s.name != "" && labeled {
+			label := font.Drawer{Dst: dest, Src: image.NewUniform(s.color), Face: textFace}
+			drawString(&label, s.name, toX(last.X)+8, toY(last.Y)+fontSize/3)
+		}
+	}
+
+	title := font.Drawer{Dst: dest, Src: image.NewUniform(axisColor), Face: titleFace}
+	drawString(&title, c.title, marginLeft, marginTop-20)
+
+	buffer := new(bytes.Buffer)
+	err = png.Encode(buffer, dest)
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// bounds returns the ranges of the values of the chart with some room around
+// the Y values.
+func (c chart) bounds() (float64, float64, float64, float64) {
+	minX, maxX := math.Inf(1), math.Inf(-1)
+	minY, maxY := math.Inf(1), math.Inf(-1)
+	for _, s := range c.series {
+		for _, p := range s.points {
+			minX = math.Min(minX, p.X)
+			maxX = math.Max(maxX, p.X)
+			if !math.IsNaN(p.Y) {
+				minY = math.Min(minY, p.Y)
+				maxY = math.Max(maxY, p.Y)
+			}
+		}
+	}
+	for _, x := range c.marks {
+		minX = math.Min(minX, x)
+		maxX = math.Max(maxX, x)
+	}
+	if math.IsInf(minX, 0) {
+		minX, maxX = 0, 1
+	}
+	if math.IsInf(minY, 0) {
+		minY, maxY = 0, 1
+	}
+	if maxX == minX {
+		maxX = minX + 1
+	}
+	if c.integerY {
+		return minX, maxX, minY - 0.5, maxY + 0.5
+	}
+	padding := (maxY - minY) * 0.05
+	if padding == 0 {
+		padding = 1
+	}
+	// positive values, like the gaps, do not get negative ticks
+	lowest := minY - padding
+	if minY >= 0.0 && lowest < 0.0 {
+		lowest = 0.0
+	}
+	return minX, maxX, lowest, maxY + padding
+}
+
+func (c chart) yTickValues(minY, maxY float64) []float64 {
+	ticks := []float64{}
+	if c.integerY {
+		step := math.Max(1.0, math.Ceil((maxY-minY)/20))
+		for y := math.Ceil(minY); y <= maxY; y += step {
+			ticks = append(ticks, y)
+		}
+		return ticks
+	}
+	for i := 0; i <= yTicks; i++ {
+		ticks = append(ticks, minY+float64(i)*(maxY-minY)/yTicks)
+	}
+	return ticks
+}
+
+func line(gc *draw2dimg.GraphicContext, x1, y1, x2, y2 float64, c color.Color, w float64) {
+	gc.SetStrokeColor(c)
+	gc.SetLineWidth(w)
+	gc.MoveTo(x1, y1)
+	gc.LineTo(x2, y2)
+	gc.Stroke()
+}
+
+func drawString(d *font.Drawer, s string, x, y float64) {
+	d.Dot = fixed.P(int(x), int(y))
+	d.DrawString(s)
+}
+
+func textWidth(d *font.Drawer, s string) float64 {
+	return float64(d.MeasureString(s).Ceil())
+}
+
+// seriesColor returns distinct colors for the series.
+func seriesColor(i, n int) color.Color {
+	if n < 1 {
+		n = 1
+	}
+	return hsl(float64(i)*360.0/float64(n), 0.75, 0.45)
+}
+
+func hsl(h, s, l float64) color.Color {
+	c := (1 - math.Abs(2*l-1)) * s
+	x := c * (1 - math.Abs(math.Mod(h/60, 2)-1))
+	m := l - c/2
+	var r, g, b float64
+	switch {
+	case h < 60:
+		r, g, b = c, x, 0
+	case h < 120:
+		r, g, b = x, c, 0
+	case h < 180:
+		r, g, b = 0, c, x
+	case h < 240:
+		r, g, b = 0, x, c
+	case h < 300:
+		r, g, b = x, 0, c
+	default:
+		r, g, b = c, 0, x
+	}
+	return color.RGBA{uint8((r + m) * 255), uint8((g + m) * 255), uint8((b + m) * 255), 0xff}
+}
@@ -0,0 +1,121 @@
+package charts
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/helper"
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/model"
+)
+
+// Labels are the localized texts of the charts.
+type Labels struct {
+	Title string
+	Lap   string
+	Pit   string
+}
+
+// LapTimes draws the lap times of a driver. Laps without time are skipped and
+// the laps the driver pitted are marked.
+func LapTimes(laps []model.StandingHistoryDriverData, labels Labels) ([]byte, error) {
+	s := series{color: seriesColor(0, 1)}
+	marks := []float64{}
+	for idx, lap := range laps {
+		y := math.NaN()
+		if lap.LapTime > 0.0 {
+			y = lap.LapTime
+		}
+		s.points = append(s.points, point{X: float64(idx + 1), Y: y})
+		if lap.Pitting {
+			marks = append(marks, float64(idx+1))
+		}
+	}
+	c := chart{
+		title:     labels.Title,
+		xLabel:    labels.Lap,
+		series:    []series{s},
+		marks:     marks,
+		markLabel: labels.Pit,
+		yFormat:   formatLapTime,
+	}
+	return c.render()
+}
+
+// Positions draws the position of every driver on every lap.
+func Positions(history model.LiveStandingHistoryData, labels Labels) ([]byte, error) {
+	c := chart{
+		title:    labels.Title,
+		xLabel:   labels.Lap,
+		invertY:  true,
+		integerY: true,
+		yFormat: func(y float64) string {
+			return "P" + formatInt(y)
+		},
+	}
+	for i, driver := range history.DriverNames {
+		s := series{
+			name:  helper.GetDriverCodeName(driver),
+			color: seriesColor(i, len(history.DriverNames)),
+		}
+		for idx, lap := range history.DriversData[driver] {
+			s.points = append(s.points, point{X: float64(idx + 1), Y: float64(lap.Position)})
+		}
+		c.series = append(c.series, s)
+	}
+	return c.render()
+}
+
+// GapToLeader draws the time every driver is behind the driver that took the
+// least time to complete the lap. The gap of a driver is not known after a
+// lap without time.
+func GapToLeader(history model.LiveStandingHistoryData, labels Labels) ([]byte, error) {
+	// elapsed time of every driver at the end of every lap
+	elapsed := map[string][]float64{}
+	leader := []float64{}
+	for _, driver := range history.DriverNames {
+		total := 0.0
+		for idx, lap := range history.DriversData[driver] {
+			if lap.LapTime <= 0.0 || math.IsNaN(total) {
+				total = math.NaN()
+			} else {
+				total += lap.LapTime
+			}
+			elapsed[driver] = append(elapsed[driver], total)
+			if idx >= len(leader) {
+				leader = append(leader, math.Inf(1))
+			}
+			if !math.IsNaN(total) && total < leader[idx] {
+				leader[idx] = total
+			}
+		}
+	}
+
+	c := chart{
+		title:   labels.Title,
+		xLabel:  labels.Lap,
+		invertY: true,
+		yFormat: func(y float64) string {
+			return fmt.Sprintf("+%.1fs", y)
+		},
+	}
+	for i, driver := range history.DriverNames {
+		s := series{
+			name:  helper.GetDriverCodeName(driver),
+			color: seriesColor(i, len(history.DriverNames)),
+		}
+		for idx, total := range elapsed[driver] {
+			s.points = append(s.points, point{X: float64(idx + 1), Y: total - leader[idx]})
+		}
+		c.series = append(c.series, s)
+	}
+	return c.render()
+}
+
+func formatLapTime(seconds float64) string {
+	minutes := int(seconds / 60)
+	return fmt.Sprintf("%d:%04.1f", minutes, seconds-float64(minutes*60))
+}
+
+func formatInt(v float64) string {
+	return fmt.Sprintf("%d", int(math.Round(v)))
+}
@@ -0,0 +1,219 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultCheckInterval = 10 * time.Second
+	DefaultDataTimeout   = 5 * time.Second
+	DefaultWebServerAddr = ":8080"
+	DefaultReplaySpeed   = 1.0
+
+	// every user that is not denied sees the public servers
+	VisibilityPublic = "public"
+	// only the admins and the users they approved see the members servers
+	VisibilityMembers = "members"
+
+	watchInterval = 5 * time.Second
+)
+
+// Duration is a time.Duration read from strings like "10s" or "1m30s".
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	err := json.Unmarshal(b, &s)
+	if err != nil {
+		return err
+	}
+	d.Duration, err = time.ParseDuration(s)
+	return err
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+type Config struct {
+	LiveMapDomain    string         `json:"liveMapDomain"`
+	WebServerAddress string         `json:"webServerAddress"`
+	CheckInterval    Duration       `json:"checkInterval"`
+	RecordDir        string         `json:"recordDir"`
+	Servers          []ServerConfig `json:"servers"`
+	// Admins are the Telegram IDs of the users that approve or deny the rest
+	Admins []int64 `json:"admins"`
+}
+
+type ServerConfig struct {
+	ID          string   `json:"id"`
+	URL         string   `json:"url"`
+	Name        string   `json:"name"`
+	LiveMap     *bool    `json:"liveMap"`
+	DataTimeout Duration `json:"dataTimeout"`
+	// Notifications are the notifications enabled by default for the users
+	// that did not configure the server yet. Keys are the session types.
+	Notifications map[string]bool `json:"notifications"`
+	// Replay is a recording that is played instead of connecting to the
+	// server, ReplaySpeed times faster than it was recorded.
+	Replay      string  `json:"replay"`
+	ReplaySpeed float64 `json:"replaySpeed"`
+	// ClassColors are the colors of the car classes on the livemap. Other
+	// classes get a color of the default palette.
+	ClassColors map[string]string `json:"classColors"`
+	// Visibility is VisibilityPublic, the default, or VisibilityMembers
+	Visibility string `json:"visibility"`
+}
+
+// LiveMapEnabled returns whether the livemap is served for the server. It is
+// enabled unless it is explicitly disabled.
+func (sc ServerConfig) LiveMapEnabled() bool {
+	return sc.LiveMap == nil || *sc.LiveMap
+}
+
+// MembersOnly returns whether the server is only shown to the members.
+func (sc ServerConfig) MembersOnly() bool {
+	return sc.Visibility == VisibilityMembers
+}
+
+// Load reads the config file. An empty path returns an empty config with the
+// default values.
+func Load(path string) (Config, error) {
+	cfg := Config{}
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return cfg, err
+		}
+		err = json.Unmarshal(b, &cfg)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+	}
+	cfg.setDefaults()
+	return cfg, nil
+}
+
+func (c *Config) setDefaults() {
+	if c.WebServerAddress == "" {
+		c.WebServerAddress = DefaultWebServerAddr
+	}
+	if c.CheckInterval.Duration <= 0 {
+		c.CheckInterval.Duration = DefaultCheckInterval
+	}
+	for i := range c.Servers {
+		if c.Servers[i].DataTimeout.Duration <= 0 {
+			c.Servers[i].DataTimeout.Duration = DefaultDataTimeout
+		}
+		if c.Servers[i].ReplaySpeed <= 0.0 {
+			c.Servers[i].ReplaySpeed = DefaultReplaySpeed
+		}
+	}
+}
+
+// Validate checks that every server has an unique ID, an URL or a replay and a
+// known visibility and that the livemap domain is set.
+func (c Config) Validate() error {
+	if c.LiveMapDomain == "" {
+		return fmt.Errorf("the livemap domain is not set")
+	}
+	if len(c.Servers) == 0 {
+		return fmt.Errorf("there are no servers")
+	}
+	ids := map[string]bool{}
+	for _, sc := range c.Servers {
+		if sc.ID == "" || (sc.URL == "" && sc.Replay == "") {
+			return fmt.Errorf("invalid server %q: id and url or replay are required", sc.ID)
+		}
+		if strings.ContainsAny(sc.ID, ":;,") {
+			return fmt.Errorf("invalid server %q: id can not contain ':', ';' or ','", sc.ID)
+		}
+		if sc.Visibility != "" && sc.Visibility != VisibilityPublic && sc.Visibility != VisibilityMembers {
+			return fmt.Errorf("invalid server %q: visibility must be %q or %q", sc.ID, VisibilityPublic, VisibilityMembers)
+		}
+		if ids[sc.ID] {
+			return fmt.Errorf("duplicated server %q", sc.ID)
+		}
+		ids[sc.ID] = true
+	}
+	return nil
+}
+
+// ParseAdmins parses the admins in the format <user_id>,<user_id>,...
+func ParseAdmins(admins string) ([]int64, error) {
+	ids := []int64{}
+	for _, adminStr := range strings.Split(admins, ",") {
+		id, err := strconv.ParseInt(strings.TrimSpace(adminStr), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid admin: %s", adminStr)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// ParseServers parses servers in the format
+// <server_id>,<server_url>;<server_id>,<server_url>;...
+func ParseServers(rf2Servers string) ([]ServerConfig, error) {
+	scs := []ServerConfig{}
+	for _, serverStr := range strings.Split(rf2Servers, ";") {
+		serverData := strings.Split(serverStr, ",")
+		if len(serverData) != 2 {
+			return nil, fmt.Errorf("Invalid server data: %s", serverStr)
+		}
+		scs = append(scs, ServerConfig{
+			ID:          serverData[0],
+			URL:         serverData[1],
+			DataTimeout: Duration{DefaultDataTimeout},
+		})
+	}
+	return scs, nil
+}
+
+// Watch checks the config file every few seconds and calls onChange with the
+// new config every time the file is modified. Files that can not be read are
+// logged and ignored so the last valid config is kept.
+func Watch(ctx context.Context, path string, onChange func(Config)) {
+	if path == "" {
+		return
+	}
+	lastModTime := time.Time{}
+	if fi, err := os.Stat(path); err == nil {
+		lastModTime = fi.ModTime()
+	}
+
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			fi, err := os.Stat(path)
+			if err != nil {
+				log.Printf("Error reading config file %s: %s\n", path, err.Error())
+				continue
+			}
+			if fi.ModTime().Equal(lastModTime) {
+				continue
+			}
+			lastModTime = fi.ModTime()
+			cfg, err := Load(path)
+			if err != nil {
+				log.Printf("Error loading config file %s: %s\n", path, err.Error())
+				continue
+			}
+			log.Printf("Config file %s changed. Reloading it\n", path)
+			onChange(cfg)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package fakerf2
+
+import (
+	"context"
+	"encoding/json"
+	"hash/fnv"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	mtStandingHistory = "standingsHistory"
+	mtStandings       = "standings"
+	mtSessionInfo     = "sessionInfo"
+
+	// standingsHistory is bigger and changes once per lap
+	historyEvery = 5
+)
+
+var upgrader = websocket.Upgrader{} // use default options
+
+type message struct {
+	MessageType string `json:"type"`
+	Body        any    `json:"body,omitempty"`
+}
+
+// Server serves the endpoints of an rFactor2 dedicated server used by the bot
+// with the data of a simulation.
+type Server struct {
+	sim       *Simulation
+	interval  time.Duration
+	timeScale float64
+	r         *mux.Router
+}
+
+// NewServer creates a server that sends the simulation data every interval.
+// The simulation runs timeScale times faster than the real time.
+func NewServer(sim *Simulation, interval time.Duration, timeScale float64) *Server {
+	if timeScale <= 0.0 {
+		timeScale = 1.0
+	}
+	s := &Server{
+		sim:       sim,
+		interval:  interval,
+		timeScale: timeScale,
+		r:         mux.NewRouter(),
+	}
+	s.r.HandleFunc("/websocket/controlpanel", s.websocketHandler())
+	s.r.HandleFunc("/rest/race/selection", s.selectionHandler())
+	s.r.HandleFunc("/rest/race/track/{id}/trackmap", s.trackmapHandler())
+	s.r.HandleFunc("/rest/race/car/{id}/image", s.carImageHandler())
+	return s
+}
+
+// Run advances the simulation until the context is done.
+func (s *Server) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	last := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case t := <-ticker.C:
+			s.sim.Advance(time.Duration(float64(t.Sub(last)) * s.timeScale))
+			last = t
+		}
+	}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.r.ServeHTTP(w, r)
+}
+
+func (s *Server) websocketHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			log.Print("upgrade:", err)
+			return
+		}
+		defer c.Close()
+		log.Printf("client connected: %s", r.RemoteAddr)
+
+		// the client does not send anything, but reading detects when it leaves
+		closed := make(chan struct{})
+		go func() {
+			defer close(closed)
+			for {
+				if _, _, err := c.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}()
+
+		t := time.NewTicker(s.interval)
+		defer t.Stop()
+		count := 0
+		for {
+			select {
+			case <-closed:
+				log.Printf("client disconnected: %s", r.RemoteAddr)
+				return
+			case <-t.C:
+				if s.sim.Loading() {
+					continue
+				}
+				messages := []message{
+					{MessageType: mtSessionInfo, Body: s.sim.SessionInfo()},
+					{MessageType: mtStandings, Body: s.sim.Standings()},
+				}
+				if count%historyEvery == 0 {
+					messages = append(messages, message{MessageType: mtStandingHistory, Body: s.sim.StandingsHistory()})
+				}
+				count++
+				for _, m := range messages {
+					err := c.WriteJSON(m)
+					if err != nil {
+						log.Println("write:", err)
+						return
+					}
+				}
+			}
+		}
+	}
+}
+
+func (s *Server) selectionHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, s.sim.SelectedSession())
+	}
+}
+
+func (s *Server) trackmapHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		track := s.sim.Track()
+		if mux.Vars(r)["id"] != track.ID {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, track.AIW())
+	}
+}
+
+// carImageHandler serves a plain image with a color of its own for every car.
+func (s *Server) carImageHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(mux.Vars(r)["id"]))
+		sum := h.Sum32()
+		c := color.RGBA{uint8(sum), uint8(sum >> 8), uint8(sum >> 16), 0xff}
+
+		rect := image.Rect(0, 0, 256, 128)
+		if r.URL.Query().Get("type") == "IMAGE_SMALL" {
+			rect = image.Rect(0, 0, 64, 32)
+		}
+		img := image.NewRGBA(rect)
+		draw.Draw(img, rect, &image.Uniform{c}, image.Point{}, draw.Src)
+
+		w.Header().Set("Content-Type", "image/png")
+		err := png.Encode(w, img)
+		if err != nil {
+			log.Println("encode:", err)
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		log.Println("encode:", err)
+	}
+}
@@ -0,0 +1,528 @@
+package fakerf2
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/model"
+)
+
+const (
+	gamePhaseGreenFlag   = 5
+	gamePhaseSessionOver = 8
+
+	finishStatusNone     = "FSTAT_NONE"
+	finishStatusFinished = "FSTAT_FINISHED"
+
+	// time the results are shown before the next session is loaded
+	sessionOverTime = 20 * time.Second
+)
+
+// Sessions are run in this order and start over after the race.
+var Sessions = []string{"PRACTICE1", "QUAL1", "WARMUP", "RACE1"}
+
+var carClasses = []struct {
+	name    string
+	vehicle string
+	pace    float64
+}{
+	{"GT3", "Fake GT3", 1.0},
+	{"GTE", "Fake GTE", 0.97},
+	{"LMP2", "Fake LMP2", 0.9},
+}
+
+var driverNames = []string{
+	"Ayrton Fake", "Alain Mock", "Nigel Stub", "Niki Dummy", "Jim Sample", "Graham Test",
+	"Jackie Double", "Emerson Proxy", "Gilles Placeholder", "Mika Sim", "Kimi Replica", "Fernando Bot",
+	"Michael Virtual", "Damon Synthetic", "Jenson Model", "Sebastian Copy", "Lewis Imitation", "Max Pretend",
+	"Charles Fixture", "Lando Spoof",
+}
+
+// Options configure the simulation.
+type Options struct {
+	Cars          int
+	Classes       int
+	LapTime       time.Duration
+	SessionLength time.Duration
+	RaceLaps      int
+	PitEvery      int
+	PitStopTime   time.Duration
+	// LoadingTime is the time no data is sent between sessions, as rFactor2
+	// does while the next session is loaded
+	LoadingTime time.Duration
+	ServerName  string
+	Seed        int64
+}
+
+type car struct {
+	slotID      int
+	driverName  string
+	vehicleName string
+	carClass    string
+	carID       string
+	carNumber   string
+	pace        float64
+	lapTarget   float64
+	lapDistance float64
+	laps        int
+	lapStartET  float64
+	sector      int
+	currS1      float64
+	currS2      float64
+	lastS1      float64
+	lastS2      float64
+	lastLap     float64
+	bestS1      float64
+	bestS2      float64
+	bestLap     float64
+	bestLapS1   float64
+	bestLapS2   float64
+	pitstops    int
+	nextPitLap  int
+	pitTime     float64
+	pitLap      bool
+	finished    bool
+	finishOrder int
+	finishET    float64
+	position    int
+	velocity    float64
+	history     []model.StandingHistoryDriverData
+}
+
+// Simulation moves the cars around the track and runs the sessions.
+type Simulation struct {
+	opts         Options
+	track        *Track
+	rnd          *rand.Rand
+	cars         []*car
+	sessionIndex int
+	et           float64
+	gamePhase    int
+	overTime     float64
+	finishes     int
+	loadingUntil time.Time
+	mu           sync.Mutex
+}
+
+func NewSimulation(opts Options, track *Track) *Simulation {
+	sim := &Simulation{
+		opts:  opts,
+		track: track,
+		rnd:   rand.New(rand.NewSource(opts.Seed)),
+	}
+	sim.startSession(0)
+	return sim
+}
+
+// Track returns the track of the simulation.
+func (sim *Simulation) Track() *Track {
+	return sim.track
+}
+
+func (sim *Simulation) session() string {
+	return Sessions[sim.sessionIndex]
+}
+
+func (sim *Simulation) isRace() bool {
+	return sim.session() == "RACE1"
+}
+
+func (sim *Simulation) startSession(index int) {
+	sim.sessionIndex = index % len(Sessions)
+	sim.et = 0.0
+	sim.gamePhase = gamePhaseGreenFlag
+	sim.overTime = 0.0
+	sim.finishes = 0
+	sim.loadingUntil = time.Now().Add(sim.opts.LoadingTime)
+
+	classes := sim.opts.Classes
+	if classes <= 0 || classes > len(carClasses) {
+		classes = 1
+	}
+	sim.cars = []*car{}
+	for i := 0; i < sim.opts.Cars; i++ {
+		class := carClasses[i%classes]
+		name := driverNames[i%len(driverNames)]
+		if i >= len(driverNames) {
+			name = fmt.Sprintf("%s %d", name, i/len(driverNames)+1)
+		}
+		c := &car{
+			slotID:      i,
+			driverName:  name,
+			vehicleName: fmt.Sprintf("%s #%d", class.vehicle, i+1),
+			carClass:    class.name,
+			carID:       fmt.Sprintf("FAKE_%s_%d", class.name, i+1),
+			carNumber:   strconv.Itoa(i + 1),
+			pace:        sim.opts.LapTime.Seconds() * class.pace * (1.0 + 0.04*sim.rnd.Float64()),
+			bestS1:      -1.0,
+			bestS2:      -1.0,
+			bestLap:     -1.0,
+			position:    i + 1,
+			nextPitLap:  sim.nextPitLap(0),
+		}
+		// the first lap starts when the car crosses the line
+		c.laps = -1
+		if sim.isRace() {
+			// grid slots behind the line
+			c.lapDistance = sim.track.Length - float64(i+1)*8.0
+		} else {
+			// cars leave the pits spread around the track
+			c.lapDistance = float64(i) * sim.track.Length / float64(sim.opts.Cars)
+		}
+		c.lapTarget = sim.lapTime(c)
+		sim.cars = append(sim.cars, c)
+	}
+	sim.updatePositions()
+}
+
+func (sim *Simulation) nextPitLap(lap int) int {
+	if sim.opts.PitEvery <= 0 {
+		return math.MaxInt
+	}
+	return lap + sim.opts.PitEvery + sim.rnd.Intn(3)
+}
+
+func (sim *Simulation) lapTime(c *car) float64 {
+	return c.pace * (1.0 + 0.01*sim.rnd.NormFloat64())
+}
+
+// Loading returns whether the next session is being loaded, so no data must be
+// sent.
+func (sim *Simulation) Loading() bool {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+	return time.Now().Before(sim.loadingUntil)
+}
+
+// Advance moves the simulation dt forward.
+func (sim *Simulation) Advance(dt time.Duration) {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+
+	if time.Now().Before(sim.loadingUntil) {
+		return
+	}
+	seconds := dt.Seconds()
+	sim.et += seconds
+
+	if sim.gamePhase == gamePhaseSessionOver {
+		sim.overTime += seconds
+		if sim.overTime >= sessionOverTime.Seconds() {
+			sim.startSession(sim.sessionIndex + 1)
+		}
+		return
+	}
+
+	for _, c := range sim.cars {
+		sim.advanceCar(c, seconds)
+	}
+	sim.updatePositions()
+
+	allFinished := true
+	for _, c := range sim.cars {
+		allFinished = allFinished && c.finished
+	}
+	if allFinished {
+		sim.gamePhase = gamePhaseSessionOver
+	}
+}
+
+func (sim *Simulation) advanceCar(c *car, seconds float64) {
+	if c.finished {
+		c.velocity = 0.0
+		return
+	}
+	if c.pitTime > 0.0 {
+		c.pitTime -= seconds
+		c.velocity = 0.0
+		return
+	}
+
+	speed := sim.track.Length / c.lapTarget
+	// cars are faster on the straights
+	c.velocity = speed * (1.0 + 0.15*math.Sin(6*math.Pi*c.lapDistance/sim.track.Length))
+	c.lapDistance += speed * seconds
+	elapsed := sim.et - c.lapStartET
+
+	if c.sector == 0 && c.lapDistance >= sim.track.Length/3 && c.laps >= 0 {
+		c.currS1 = elapsed
+		c.sector = 1
+	}
+	if c.sector == 1 && c.lapDistance >= 2*sim.track.Length/3 {
+		c.currS2 = elapsed
+		c.sector = 2
+	}
+	if c.lapDistance < sim.track.Length {
+		return
+	}
+
+	// the car crossed the line
+	overshoot := (c.lapDistance - sim.track.Length) / speed
+	c.lapDistance -= sim.track.Length
+	lapStartET := sim.et - overshoot
+	if c.laps >= 0 && c.sector == 2 {
+		sim.completeLap(c, lapStartET-c.lapStartET)
+	}
+	c.laps++
+	c.lapStartET = lapStartET
+	c.sector = 0
+	c.currS1 = 0.0
+	c.currS2 = 0.0
+	c.lapTarget = sim.lapTime(c)
+
+	if (sim.isRace() && (c.laps >= sim.opts.RaceLaps || sim.finishes > 0)) ||
+		(!sim.isRace() && sim.et >= sim.opts.SessionLength.Seconds()) {
+		sim.finishes++
+		c.finished = true
+		c.finishOrder = sim.finishes
+		c.finishET = lapStartET
+		c.velocity = 0.0
+		return
+	}
+	if c.laps >= c.nextPitLap {
+		c.pitstops++
+		c.pitTime = sim.opts.PitStopTime.Seconds()
+		c.pitLap = true
+		c.nextPitLap = sim.nextPitLap(c.laps)
+	}
+}
+
+func (sim *Simulation) completeLap(c *car, lapTime float64) {
+	c.lastS1 = c.currS1
+	c.lastS2 = c.currS2
+	c.lastLap = lapTime
+	s2 := c.currS2 - c.currS1
+	if c.bestS1 <= 0.0 || c.currS1 < c.bestS1 {
+		c.bestS1 = c.currS1
+	}
+	if c.bestS2 <= 0.0 || s2 < c.bestS2 {
+		c.bestS2 = s2
+	}
+	if c.bestLap <= 0.0 || lapTime < c.bestLap {
+		c.bestLap = lapTime
+		c.bestLapS1 = c.currS1
+		c.bestLapS2 = c.currS2
+	}
+	c.history = append(c.history, model.StandingHistoryDriverData{
+		Position:     c.position,
+		DriverName:   c.driverName,
+		SlotID:       c.slotID,
+		LapTime:      lapTime,
+		SectorTime1:  c.currS1,
+		SectorTime2:  c.currS2,
+		TotalLaps:    float64(c.laps + 1),
+		VehicleName:  c.vehicleName,
+		FinishStatus: finishStatusNone,
+		Pitting:      c.pitLap,
+		CarClass:     c.carClass,
+	})
+	c.pitLap = false
+}
+
+func (sim *Simulation) progress(c *car) float64 {
+	if c.finished {
+		return float64(c.laps) * sim.track.Length
+	}
+	return float64(c.laps)*sim.track.Length + c.lapDistance
+}
+
+func (sim *Simulation) updatePositions() {
+	sorted := append([]*car{}, sim.cars...)
+	if sim.isRace() {
+		sort.SliceStable(sorted, func(i, j int) bool {
+			pi, pj := sim.progress(sorted[i]), sim.progress(sorted[j])
+			if pi == pj && sorted[i].finished && sorted[j].finished {
+				return sorted[i].finishOrder < sorted[j].finishOrder
+			}
+			return pi > pj
+		})
+	} else {
+		sort.SliceStable(sorted, func(i, j int) bool {
+			bi, bj := sorted[i].bestLap, sorted[j].bestLap
+			if bi > 0.0 && bj > 0.0 {
+				return bi < bj
+			}
+			return bi > 0.0
+		})
+	}
+	for i, c := range sorted {
+		c.position = i + 1
+	}
+}
+
+// SessionInfo returns the session as sent in the sessionInfo messages.
+func (sim *Simulation) SessionInfo() model.SessionInfo {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+
+	endEventTime := sim.opts.SessionLength.Seconds()
+	maximumLaps := math.MaxInt32
+	if sim.isRace() {
+		endEventTime = 0.0
+		maximumLaps = sim.opts.RaceLaps
+	}
+	completion := 0.0
+	if sim.isRace() && sim.opts.RaceLaps > 0 {
+		for _, c := range sim.cars {
+			if c.position == 1 {
+				completion = math.Max(0.0, sim.progress(c)/sim.track.Length/float64(sim.opts.RaceLaps))
+			}
+		}
+	}
+	return model.SessionInfo{
+		TrackName:        sim.track.Name,
+		Session:          sim.session(),
+		CurrentEventTime: sim.et,
+		EndEventTime:     endEventTime,
+		MaximumLaps:      maximumLaps,
+		LapDistance:      sim.track.Length,
+		NumberOfVehicles: len(sim.cars),
+		GamePhase:        sim.gamePhase,
+		YellowFlagState:  "NONE",
+		SectorFlag:       []string{"GREEN", "GREEN", "GREEN"},
+		InRealtime:       true,
+		AmbientTemp:      22.0,
+		TrackTemp:        30.0,
+		GameMode:         "MULTIPLAYER",
+		MaxPlayers:       len(sim.cars),
+		ServerName:       sim.opts.ServerName,
+		RaceCompletion:   model.RaceCompletion{LapsCompletion: completion},
+	}
+}
+
+// Standings returns the cars as sent in the standings messages.
+func (sim *Simulation) Standings() []model.StandingDriverData {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+
+	byPosition := make([]*car, len(sim.cars))
+	for _, c := range sim.cars {
+		byPosition[c.position-1] = c
+	}
+
+	standings := []model.StandingDriverData{}
+	for i, c := range byPosition {
+		x, z := sim.track.Position(c.lapDistance)
+		pitting := c.pitTime > 0.0
+		pitState := "NONE"
+		if pitting {
+			x, z = sim.track.PitPosition(c.lapDistance)
+			pitState = "STOPPED"
+		}
+		finishStatus := finishStatusNone
+		if c.finished {
+			finishStatus = finishStatusFinished
+		}
+		sector := []string{"SECTOR1", "SECTOR2", "SECTOR3"}[c.sector]
+
+		sd := model.StandingDriverData{
+			SlotID:             c.slotID,
+			DriverName:         c.driverName,
+			VehicleName:        c.vehicleName,
+			LapsCompleted:      max(c.laps, 0),
+			Sector:             sector,
+			FinishStatus:       finishStatus,
+			LapDistance:        c.lapDistance,
+			BestSectorTime1:    c.bestS1,
+			BestSectorTime2:    c.bestS2,
+			BestLapTime:        c.bestLap,
+			LastSectorTime1:    c.lastS1,
+			LastSectorTime2:    c.lastS2,
+			LastLapTime:        c.lastLap,
+			CurrentSectorTime1: c.currS1,
+			CurrentSectorTime2: c.currS2,
+			Pitstops:           c.pitstops,
+			InControl:          2,
+			Pitting:            pitting,
+			Position:           c.position,
+			CarClass:           c.carClass,
+			LapStartET:         c.lapStartET,
+			CarPosition:        model.CarPosition{X: x, Z: z},
+			CarVelocity:        model.CarVelocity{Velocity: c.velocity},
+			PitState:           pitState,
+			ServerScored:       true,
+			TimeIntoLap:        sim.et - c.lapStartET,
+			EstimatedLapTime:   c.lapTarget,
+			Flag:               "GREEN",
+			CountLapFlag:       "COUNT_LAP_AND_TIME",
+			BestLapSectorTime1: c.bestLapS1,
+			BestLapSectorTime2: c.bestLapS2,
+			VehicleFilename:    c.vehicleName,
+			CarID:              c.carID,
+			CarNumber:          c.carNumber,
+			FullTeamName:       fmt.Sprintf("Fake Racing %s", c.carNumber),
+			FuelFraction:       1.0 - math.Mod(float64(max(c.laps, 0)), 10.0)/10.0,
+		}
+		if i > 0 {
+			sd.TimeBehindNext, sd.LapsBehindNext = sim.gap(byPosition[i-1], c)
+			sd.TimeBehindLeader, sd.LapsBehindLeader = sim.gap(byPosition[0], c)
+		}
+		standings = append(standings, sd)
+	}
+	return standings
+}
+
+// gap returns the time and laps the car is behind the other car.
+func (sim *Simulation) gap(ahead, c *car) (float64, float64) {
+	if !sim.isRace() {
+		if ahead.bestLap > 0.0 && c.bestLap > 0.0 {
+			return c.bestLap - ahead.bestLap, 0.0
+		}
+		return 0.0, 0.0
+	}
+	distance := sim.progress(ahead) - sim.progress(c)
+	if ahead.finished && c.finished && distance == 0.0 {
+		return c.finishET - ahead.finishET, 0.0
+	}
+	return distance / sim.track.Length * c.pace, math.Floor(distance / sim.track.Length)
+}
+
+// StandingsHistory returns the laps of the cars as sent in the
+// standingsHistory messages, keyed by slot.
+func (sim *Simulation) StandingsHistory() map[string][]model.StandingHistoryDriverData {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+
+	history := map[string][]model.StandingHistoryDriverData{}
+	for _, c := range sim.cars {
+		laps := append([]model.StandingHistoryDriverData{}, c.history...)
+		if c.finished && len(laps) > 0 {
+			laps[len(laps)-1].FinishStatus = finishStatusFinished
+		}
+		history[strconv.Itoa(c.slotID)] = laps
+	}
+	return history
+}
+
+// SelectedSession returns the data served in /rest/race/selection.
+func (sim *Simulation) SelectedSession() model.SelectedSessionData {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+
+	ssd := model.SelectedSessionData{
+		Series: model.Series{
+			ShortName: "FAKE",
+			Name:      "Fake Series",
+		},
+		Track: model.Track{
+			ID:        sim.track.ID,
+			ShortName: sim.track.ID,
+			Name:      sim.track.Name,
+			Length:    fmt.Sprintf("%.0f m", sim.track.Length),
+			Owned:     true,
+		},
+	}
+	if len(sim.cars) > 0 {
+		ssd.Car = model.Car{
+			ID:    sim.cars[0].carID,
+			Name:  sim.cars[0].vehicleName,
+			Owned: true,
+		}
+	}
+	return ssd
+}
@@ -0,0 +1,106 @@
+package fakerf2
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/layout"
+)
+
+const (
+	aiwTypeTrack   = 0
+	aiwTypePitLane = 1
+
+	trackPointStep = 10.0
+	pitLaneLength  = 400.0
+	pitLaneOffset  = 15.0
+)
+
+// Track is a synthetic closed track. Distances are in meters from the
+// start/finish line.
+type Track struct {
+	ID     string
+	Name   string
+	Length float64
+	points []layout.Data
+}
+
+// NewTrack builds a track of the given length with a few corners of
+// different radius.
+func NewTrack(length float64) *Track {
+	// sample the curve densely to measure it and resample it every few meters
+	const samples = 4000
+	curve := make([]layout.Data, samples+1)
+	total := 0.0
+	distances := make([]float64, samples+1)
+	for i := 0; i <= samples; i++ {
+		theta := 2 * math.Pi * float64(i) / samples
+		r := 1.0 + 0.25*math.Sin(2*theta) + 0.1*math.Cos(3*theta)
+		curve[i] = layout.Data{Type: aiwTypeTrack, X: r * math.Cos(theta), Z: 0.7 * r * math.Sin(theta)}
+		if i > 0 {
+			total += math.Hypot(curve[i].X-curve[i-1].X, curve[i].Z-curve[i-1].Z)
+			distances[i] = total
+		}
+	}
+	scale := length / total
+
+	points := []layout.Data{}
+	j := 0
+	for d := 0.0; d < length; d += trackPointStep {
+		for j < samples-1 && distances[j+1]*scale < d {
+			j++
+		}
+		f := (d - distances[j]*scale) / ((distances[j+1] - distances[j]) * scale)
+		points = append(points, layout.Data{
+			Type: aiwTypeTrack,
+			X:    (curve[j].X + f*(curve[j+1].X-curve[j].X)) * scale,
+			Z:    (curve[j].Z + f*(curve[j+1].Z-curve[j].Z)) * scale,
+		})
+	}
+
+	return &Track{
+		ID:     fmt.Sprintf("FAKE_%.0f", length),
+		Name:   fmt.Sprintf("Fake Circuit %.1f km", length/1000.0),
+		Length: length,
+		points: points,
+	}
+}
+
+// Position returns the coordinates of the point at the given distance of the
+// track.
+func (t *Track) Position(distance float64) (float64, float64) {
+	distance = math.Mod(distance, t.Length)
+	if distance < 0.0 {
+		distance += t.Length
+	}
+	i := int(distance / trackPointStep)
+	f := (distance - float64(i)*trackPointStep) / trackPointStep
+	p1 := t.points[i%len(t.points)]
+	p2 := t.points[(i+1)%len(t.points)]
+	return p1.X + f*(p2.X-p1.X), p1.Z + f*(p2.Z-p1.Z)
+}
+
+// PitPosition returns the coordinates of the pit lane next to the given
+// distance of the track.
+func (t *Track) PitPosition(distance float64) (float64, float64) {
+	x, z := t.Position(distance)
+	nx, nz := t.Position(distance + trackPointStep)
+	dx, dz := nx-x, nz-z
+	norm := math.Hypot(dx, dz)
+	if norm == 0.0 {
+		return x, z
+	}
+	// the pit lane runs on the inner side of the track
+	return x - dz/norm*pitLaneOffset, z + dx/norm*pitLaneOffset
+}
+
+// AIW returns the layout of the track and its pit lane as served by rFactor2.
+func (t *Track) AIW() layout.AIW {
+	aiw := layout.AIW{}
+	aiw = append(aiw, t.points...)
+	for d := -pitLaneLength / 2; d <= pitLaneLength/2; d += trackPointStep {
+		x, z := t.PitPosition(d)
+		aiw = append(aiw, layout.Data{Type: aiwTypePitLane, X: x, Z: z})
+	}
+	return aiw
+}
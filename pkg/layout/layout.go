@@ -102,7 +102,7 @@ func BuildLayoutPNG(track string, aiw AIW) error {
 	dest := image.NewRGBA(rect)
 	gc := draw2dimg.NewGraphicContext(dest)
 
-	drawImage(gc, aiw, minX, maxX, offsetX, minZ, maxZ, offsetZ, maxType, rotate, width, height, rect, ScalePNG, false)
+	drawImage(gc, aiw, Sectors{}, minX, maxX, offsetX, minZ, maxZ, offsetZ, maxType, rotate, width, height, rect, ScalePNG, false)
 	return draw2dimg.SaveToPngFile(track, dest)
 }
 
@@ -129,7 +129,7 @@ func BuildLayoutSVG(track string, aiw AIW) error {
 	dest := draw2dsvg.NewSvg()
 	gc := draw2dsvg.NewGraphicContext(dest)
 
-	drawImage(gc, aiw, minX, maxX, offsetX, minZ, maxZ, offsetZ, 1, rotate, width, height, rect, ScaleSVG, true)
+	drawImage(gc, aiw, Sectors{}, minX, maxX, offsetX, minZ, maxZ, offsetZ, 1, rotate, width, height, rect, ScaleSVG, true)
 	err := draw2dsvg.SaveToSvgFile(track, dest)
 	if err != nil {
 		return err
@@ -177,7 +177,7 @@ func invertY(gc draw2d.GraphicContext, rect image.Rectangle, factor float64) {
 	gc.Scale(1.0, -1.0)
 }
 
-func drawImage(gc draw2d.GraphicContext, aiw AIW, minX, maxX, offsetX, minZ, maxZ, offsetZ float64, maxType int, rotate bool, width, height float64, rect image.Rectangle, scale float64, applyStrokeScale bool) {
+func drawImage(gc draw2d.GraphicContext, aiw AIW, sectors Sectors, minX, maxX, offsetX, minZ, maxZ, offsetZ float64, maxType int, rotate bool, width, height float64, rect image.Rectangle, scale float64, applyStrokeScale bool) {
 	// Draw shapes boxes
 	for i := maxType; i >= 100; i-- {
 		aiwFiltered := AIW{}
@@ -199,6 +199,8 @@ func drawImage(gc draw2d.GraphicContext, aiw AIW, minX, maxX, offsetX, minZ, max
 		}
 		drawType(gc, aiwFiltered, minX, maxX, offsetX, minZ, maxZ, offsetZ, i, rotate, width, height, rect, scale, applyStrokeScale)
 	}
+
+	drawMarkers(gc, aiw, sectors, offsetX, offsetZ, rotate, width, height, rect, scale, applyStrokeScale)
 }
 
 func drawType(gc draw2d.GraphicContext, aiw AIW, minX, maxX, offsetX, minZ, maxZ, offsetZ float64, t int, rotate bool, width, height float64, rect image.Rectangle, scale float64, applyStrokeScale bool) {
@@ -232,14 +234,19 @@ func drawType(gc draw2d.GraphicContext, aiw AIW, minX, maxX, offsetX, minZ, maxZ
 	if t == 0 {
 		gc.LineTo(initX, initZ)
 	}
-	invertY(gc, rect, scale)
+	transform(gc, rotate, width, height, rect)
+
+	gc.Stroke()
+	gc.Restore()
+}
+
+// transform flips and rotates the path so it fits the image.
+func transform(gc draw2d.GraphicContext, rotate bool, width, height float64, rect image.Rectangle) {
+	invertY(gc, rect, 0.0)
 
 	if rotate {
 		gc.Rotate(math.Pi / 2)
 		f := width / height
 		gc.Translate(0, -f*float64(rect.Max.Y))
 	}
-
-	gc.Stroke()
-	gc.Restore()
 }
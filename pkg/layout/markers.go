@@ -0,0 +1,148 @@
+package layout
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/llgcode/draw2d"
+	"github.com/llgcode/draw2d/draw2dkit"
+)
+
+const (
+	typeTrack   = 0
+	typePitLane = 1
+
+	// sizes in pixels of the markers before the stroke scale is applied
+	lineMarkerLength = 30.0
+	lineMarkerWidth  = 8.0
+	pitMarkerRadius  = 12.0
+	arrowLength      = 40.0
+	// distance in waypoints from the start/finish line to the direction arrow
+	arrowWaypoints = 10
+)
+
+var (
+	startFinishColor = color.RGBA{0xe0, 0x00, 0x00, 0xff}
+	sectorColor      = color.RGBA{0xff, 0xc0, 0x00, 0xff}
+	pitEntryColor    = color.RGBA{0x00, 0xa0, 0x00, 0xff}
+	pitExitColor     = color.RGBA{0x00, 0x60, 0xe0, 0xff}
+	arrowColor       = color.RGBA{0xe0, 0x00, 0x00, 0xff}
+)
+
+// Sectors are the fractions of the lap where the second and the third sectors
+// start. Unknown boundaries are zero.
+type Sectors [2]float64
+
+// point is a waypoint in the coordinates of the image before it is flipped
+// and rotated.
+type point struct {
+	x, z float64
+}
+
+// drawMarkers draws the start/finish line, the sector boundaries, the pit
+// entry and exit and the driving direction. The track waypoints start at the
+// start/finish line and follow the driving direction. The trackmap has no
+// sector data, so only the known boundaries of sectors are drawn.
+func drawMarkers(gc draw2d.GraphicContext, aiw AIW, sectors Sectors, offsetX, offsetZ float64, rotate bool, width, height float64, rect image.Rectangle, scale float64, applyStrokeScale bool) {
+	strokeScale := 1.0
+	if applyStrokeScale && scale > 0.0 {
+		strokeScale = scale
+	}
+	track := waypoints(aiw, typeTrack, offsetX, offsetZ, scale)
+	if len(track) < 2 {
+		return
+	}
+
+	// distance of every waypoint to the start/finish line
+	distances := make([]float64, len(track))
+	for i := 1; i < len(track); i++ {
+		distances[i] = distances[i-1] + math.Hypot(track[i].x-track[i-1].x, track[i].z-track[i-1].z)
+	}
+	lapLength := distances[len(distances)-1] + math.Hypot(track[0].x-track[len(track)-1].x, track[0].z-track[len(track)-1].z)
+	for _, fraction := range sectors {
+		if fraction <= 0.0 || fraction >= 1.0 {
+			continue
+		}
+		i := 0
+		for i < len(track)-1 && distances[i] < fraction*lapLength {
+			i++
+		}
+		drawLineMarker(gc, track, i, sectorColor, strokeScale, rotate, width, height, rect)
+	}
+	drawLineMarker(gc, track, 0, startFinishColor, strokeScale, rotate, width, height, rect)
+
+	if len(track) > arrowWaypoints+1 {
+		drawArrow(gc, track, arrowWaypoints, strokeScale, rotate, width, height, rect)
+	}
+
+	pitLane := waypoints(aiw, typePitLane, offsetX, offsetZ, scale)
+	if len(pitLane) > 0 {
+		drawCircleMarker(gc, pitLane[0], pitEntryColor, strokeScale, rotate, width, height, rect)
+		drawCircleMarker(gc, pitLane[len(pitLane)-1], pitExitColor, strokeScale, rotate, width, height, rect)
+	}
+}
+
+func waypoints(aiw AIW, t int, offsetX, offsetZ, scale float64) []point {
+	points := []point{}
+	for _, data := range aiw {
+		if data.Type == t {
+			points = append(points, point{x: data.X*(1.0-scale) + offsetX, z: data.Z*(1.0-scale) + offsetZ})
+		}
+	}
+	return points
+}
+
+// direction returns the unit vector of the track at the waypoint.
+func direction(track []point, i int) (float64, float64) {
+	next := track[(i+1)%len(track)]
+	dx, dz := next.x-track[i].x, next.z-track[i].z
+	length := math.Hypot(dx, dz)
+	if length == 0.0 {
+		return 1.0, 0.0
+	}
+	return dx / length, dz / length
+}
+
+// drawLineMarker draws a line across the track at the waypoint.
+func drawLineMarker(gc draw2d.GraphicContext, track []point, i int, c color.Color, strokeScale float64, rotate bool, width, height float64, rect image.Rectangle) {
+	gc.Save()
+	dx, dz := direction(track, i)
+	// normal of the track
+	nx, nz := -dz, dx
+	l := lineMarkerLength * strokeScale
+	gc.SetStrokeColor(c)
+	gc.SetLineWidth(lineMarkerWidth * strokeScale)
+	gc.MoveTo(track[i].x-nx*l, track[i].z-nz*l)
+	gc.LineTo(track[i].x+nx*l, track[i].z+nz*l)
+	transform(gc, rotate, width, height, rect)
+	gc.Stroke()
+	gc.Restore()
+}
+
+// drawArrow draws a triangle on the track at the waypoint pointing to the
+// driving direction.
+func drawArrow(gc draw2d.GraphicContext, track []point, i int, strokeScale float64, rotate bool, width, height float64, rect image.Rectangle) {
+	gc.Save()
+	dx, dz := direction(track, i)
+	nx, nz := -dz, dx
+	l := arrowLength * strokeScale
+	p := track[i]
+	gc.SetFillColor(arrowColor)
+	gc.MoveTo(p.x+dx*l/2, p.z+dz*l/2)
+	gc.LineTo(p.x-dx*l/2+nx*l/3, p.z-dz*l/2+nz*l/3)
+	gc.LineTo(p.x-dx*l/2-nx*l/3, p.z-dz*l/2-nz*l/3)
+	gc.Close()
+	transform(gc, rotate, width, height, rect)
+	gc.Fill()
+	gc.Restore()
+}
+
+func drawCircleMarker(gc draw2d.GraphicContext, p point, c color.Color, strokeScale float64, rotate bool, width, height float64, rect image.Rectangle) {
+	gc.Save()
+	gc.SetFillColor(c)
+	draw2dkit.Circle(gc, p.x, p.z, pitMarkerRadius*strokeScale)
+	transform(gc, rotate, width, height, rect)
+	gc.Fill()
+	gc.Restore()
+}
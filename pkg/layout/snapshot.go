@@ -0,0 +1,126 @@
+package layout
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"sync"
+
+	"github.com/llgcode/draw2d"
+	"github.com/llgcode/draw2d/draw2dimg"
+	"github.com/llgcode/draw2d/draw2dkit"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gomonobold"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	snapshotCarRadius = 14.0
+	snapshotFontSize  = 22.0
+)
+
+var (
+	snapshotCarColor    = color.RGBA{0xee, 0xee, 0xee, 0xff}
+	snapshotLeaderColor = color.RGBA{0xe7, 0xe7, 0x72, 0xff}
+	snapshotStrokeColor = color.RGBA{0x11, 0x11, 0x11, 0xff}
+
+	snapshotLabelBackground = image.NewUniform(color.RGBA{0xff, 0xff, 0xff, 0xd0})
+
+	snapshotFace     font.Face
+	snapshotFaceErr  error
+	snapshotFaceOnce sync.Once
+)
+
+// SnapshotCar is a car drawn on a snapshot at the coordinates of the track.
+type SnapshotCar struct {
+	X      float64
+	Z      float64
+	Code   string
+	Leader bool
+}
+
+// TransformPosition converts the coordinates of a point of the track to the
+// coordinates of the image described by the metadata.
+func TransformPosition(gc draw2d.GraphicContext, metadata SvgMetadata, x, z, scale float64) (float64, float64) {
+	gc.Save()
+	gc.MoveTo(x*(1.0-scale)+metadata.OffsetX, z*(1.0-scale)+metadata.OffsetZ)
+	transform(gc, metadata.Rotate, metadata.Width, metadata.Height, metadata.Rect)
+	px, pz := gc.LastPoint()
+	lp := []float64{px, pz}
+	m := gc.GetMatrixTransform()
+	m.Transform(lp)
+	gc.Restore()
+	return lp[0], lp[1]
+}
+
+// BuildSnapshotPNG draws the track like BuildLayoutPNG with the known sector
+// boundaries and the cars on it and returns the image encoded as PNG. The cars
+// are drawn in order, so the last ones are on top.
+func BuildSnapshotPNG(aiw AIW, sectors Sectors, cars []SnapshotCar) ([]byte, error) {
+	snapshotFaceOnce.Do(func() {
+		f, err := opentype.Parse(gomonobold.TTF)
+		if err != nil {
+			snapshotFaceErr = err
+			return
+		}
+		snapshotFace, snapshotFaceErr = opentype.NewFace(f, &opentype.FaceOptions{Size: snapshotFontSize, DPI: 72})
+	})
+	if snapshotFaceErr != nil {
+		return nil, snapshotFaceErr
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	minX, maxX, offsetX, minZ, maxZ, offsetZ, maxType, rotate, rect := getTrackSize(aiw, ScalePNG)
+	width := float64(rect.Max.X)
+	height := float64(rect.Max.Y)
+
+	// photos sent to Telegram have no transparency
+	dest := image.NewRGBA(rect)
+	draw.Draw(dest, rect, image.White, image.Point{}, draw.Src)
+	gc := draw2dimg.NewGraphicContext(dest)
+
+	drawImage(gc, aiw, sectors, minX, maxX, offsetX, minZ, maxZ, offsetZ, maxType, rotate, width, height, rect, ScalePNG, false)
+
+	metadata := SvgMetadata{
+		OffsetX: offsetX,
+		OffsetZ: offsetZ,
+		Rotate:  rotate,
+		Width:   width,
+		Height:  height,
+		Rect:    rect,
+	}
+	drawer := font.Drawer{Dst: dest, Src: image.Black, Face: snapshotFace}
+	for _, car := range cars {
+		x, y := TransformPosition(gc, metadata, car.X, car.Z, ScalePNG)
+		fill := snapshotCarColor
+		if car.Leader {
+			fill = snapshotLeaderColor
+		}
+		gc.Save()
+		gc.SetFillColor(fill)
+		gc.SetStrokeColor(snapshotStrokeColor)
+		gc.SetLineWidth(2)
+		draw2dkit.Circle(gc, x, y, snapshotCarRadius)
+		gc.FillStroke()
+		gc.Restore()
+
+		// the code is written next to the car on a box, so it can be read over
+		// the track
+		drawer.Dot = fixed.P(int(x+snapshotCarRadius+4), int(y+snapshotFontSize/3))
+		bounds, _ := drawer.BoundString(car.Code)
+		box := image.Rect(bounds.Min.X.Floor()-2, bounds.Min.Y.Floor()-2, bounds.Max.X.Ceil()+2, bounds.Max.Y.Ceil()+2)
+		draw.Draw(dest, box, snapshotLabelBackground, image.Point{}, draw.Over)
+		drawer.DrawString(car.Code)
+	}
+
+	buffer := new(bytes.Buffer)
+	err := png.Encode(buffer, dest)
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
@@ -0,0 +1,50 @@
+package livemap
+
+import (
+	"hash/fnv"
+
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/model"
+)
+
+// classPalette colors the classes without a configured color. A class always
+// gets the same color.
+var classPalette = []string{
+	"#E74C3C", // red
+	"#3498DB", // blue
+	"#2ECC71", // green
+	"#F39C12", // orange
+	"#9B59B6", // purple
+	"#1ABC9C", // teal
+	"#EC70AB", // pink
+	"#95A5A6", // grey
+}
+
+// SetClassColors sets the colors of the car classes configured for the
+// server.
+func (lm *LiveMap) SetClassColors(classColors map[string]string) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	lm.classColors = classColors
+}
+
+// carClassColors returns the color of every class of the cars. It must be
+// called with the lock held.
+func (lm *LiveMap) carClassColors(carsPosition []model.CarPosition) map[string]string {
+	colors := map[string]string{}
+	for _, carPosition := range carsPosition {
+		if carPosition.CarClass == "" {
+			continue
+		}
+		if _, found := colors[carPosition.CarClass]; found {
+			continue
+		}
+		color, found := lm.classColors[carPosition.CarClass]
+		if !found {
+			h := fnv.New32a()
+			h.Write([]byte(carPosition.CarClass))
+			color = classPalette[h.Sum32()%uint32(len(classPalette))]
+		}
+		colors[carPosition.CarClass] = color
+	}
+	return colors
+}
@@ -0,0 +1,154 @@
+package livemap
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/metrics"
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/model"
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/pubsub"
+)
+
+const (
+	eventPositions = "positions"
+	eventStandings = "standings"
+	eventSession   = "session"
+
+	// comments are sent periodically so proxies do not close idle streams
+	eventsKeepAliveInterval = 15 * time.Second
+)
+
+// StandingsDelta is the data of the standings event. It contains the drivers
+// whose data changed since the previous event and the drivers that left. The
+// first event of a stream contains every driver.
+type StandingsDelta struct {
+	Drivers []model.StandingDriverData `json:"drivers"`
+	Removed []string                   `json:"removed"`
+}
+
+// eventsHandler streams the car positions, the standings and the session info
+// of the server as Server-Sent Events.
+func (lm *LiveMap) eventsHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rc := http.NewResponseController(w)
+		// the stream is kept open, so the write timeout of the webserver does
+		// not apply
+		err := rc.SetWriteDeadline(time.Time{})
+		if err != nil {
+			log.Printf("Error disabling write deadline for events: %s\n", err.Error())
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		// nginx buffers the responses unless it is told not to
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		err = rc.Flush()
+		if err != nil {
+			log.Println("events:", err)
+			return
+		}
+
+		metrics.LiveMapClients.WithLabelValues(lm.serverId).Inc()
+		defer metrics.LiveMapClients.WithLabelValues(lm.serverId).Dec()
+
+		ctx := r.Context()
+		positionsChan := pubsub.CarsPositionPubSub.SubscribeContext(ctx, pubsub.PubSubCarsPositionPreffix+lm.serverId)
+		standingChan := pubsub.LiveStandingDataPubSub.SubscribeContext(ctx, pubsub.PubSubDriversSessionPreffix+lm.serverId)
+		sessionInfoChan := pubsub.LiveSessionInfoDataPubSub.SubscribeContext(ctx, pubsub.PubSubSessionInfoPreffix+lm.serverId)
+
+		keepAlive := time.NewTicker(eventsKeepAliveInterval)
+		defer keepAlive.Stop()
+
+		sentDrivers := map[string][]byte{}
+		var sentSession []byte
+		for {
+			var err error
+			select {
+			case <-ctx.Done():
+				return
+			case <-keepAlive.C:
+				_, err = fmt.Fprint(w, ": keepalive\n\n")
+				if err == nil {
+					err = rc.Flush()
+				}
+			case carsPosition, ok := <-positionsChan:
+				if !ok {
+					return
+				}
+				positions, running := lm.transformCarsPosition(carsPosition)
+				if !running {
+					continue
+				}
+				data, _ := json.Marshal(positions)
+				err = writeEvent(w, rc, eventPositions, data)
+			case lsd, ok := <-standingChan:
+				if !ok {
+					return
+				}
+				delta := buildStandingsDelta(sentDrivers, lsd.Drivers)
+				if len(delta.Drivers) == 0 && len(delta.Removed) == 0 {
+					continue
+				}
+				data, _ := json.Marshal(delta)
+				err = writeEvent(w, rc, eventStandings, data)
+			case lsid, ok := <-sessionInfoChan:
+				if !ok {
+					return
+				}
+				data, _ := json.Marshal(lsid)
+				if bytes.Equal(data, sentSession) {
+					continue
+				}
+				sentSession = data
+				err = writeEvent(w, rc, eventSession, data)
+			}
+			if err != nil {
+				log.Println("events:", err)
+				return
+			}
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, rc *http.ResponseController, event string, data []byte) error {
+	_, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+	if err != nil {
+		return err
+	}
+	return rc.Flush()
+}
+
+// buildStandingsDelta compares the drivers with the ones already sent, which
+// are updated.
+func buildStandingsDelta(sent map[string][]byte, drivers []model.StandingDriverData) StandingsDelta {
+	delta := StandingsDelta{
+		Drivers: []model.StandingDriverData{},
+		Removed: []string{},
+	}
+	present := map[string]bool{}
+	for _, driver := range drivers {
+		present[driver.DriverName] = true
+		data, err := json.Marshal(driver)
+		if err != nil {
+			continue
+		}
+		if bytes.Equal(data, sent[driver.DriverName]) {
+			continue
+		}
+		sent[driver.DriverName] = data
+		delta.Drivers = append(delta.Drivers, driver)
+	}
+	for name := range sent {
+		if !present[name] {
+			delete(sent, name)
+			delta.Removed = append(delta.Removed, name)
+		}
+	}
+	return delta
+}
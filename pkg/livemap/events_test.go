@@ -0,0 +1,73 @@
+package livemap
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/model"
+)
+
+func TestBuildStandingsDelta(t *testing.T) {
+	driver := func(name string, laps int) model.StandingDriverData {
+		return model.StandingDriverData{DriverName: name, LapsCompleted: laps}
+	}
+	names := func(drivers []model.StandingDriverData) []string {
+		names := []string{}
+		for _, d := range drivers {
+			names = append(names, d.DriverName)
+		}
+		return names
+	}
+
+	// every step is built with the drivers sent in the previous ones
+	steps := []struct {
+		name        string
+		drivers     []model.StandingDriverData
+		wantDrivers []string
+		wantRemoved []string
+	}{
+		{
+			name:        "first event has every driver",
+			drivers:     []model.StandingDriverData{driver("A", 1), driver("B", 1)},
+			wantDrivers: []string{"A", "B"},
+			wantRemoved: []string{},
+		},
+		{
+			name:        "unchanged drivers are not sent",
+			drivers:     []model.StandingDriverData{driver("A", 1), driver("B", 1)},
+			wantDrivers: []string{},
+			wantRemoved: []string{},
+		},
+		{
+			name:        "changed drivers are sent",
+			drivers:     []model.StandingDriverData{driver("A", 2), driver("B", 1)},
+			wantDrivers: []string{"A"},
+			wantRemoved: []string{},
+		},
+		{
+			name:        "drivers that left are removed",
+			drivers:     []model.StandingDriverData{driver("B", 1), driver("C", 0)},
+			wantDrivers: []string{"C"},
+			wantRemoved: []string{"A"},
+		},
+		{
+			name:        "empty standings remove everyone",
+			drivers:     []model.StandingDriverData{},
+			wantDrivers: []string{},
+			wantRemoved: []string{"B", "C"},
+		},
+	}
+
+	sent := map[string][]byte{}
+	for _, step := range steps {
+		delta := buildStandingsDelta(sent, step.drivers)
+		if got := names(delta.Drivers); !reflect.DeepEqual(got, step.wantDrivers) {
+			t.Errorf("%s: got drivers %v, want %v", step.name, got, step.wantDrivers)
+		}
+		sort.Strings(delta.Removed)
+		if !reflect.DeepEqual(delta.Removed, step.wantRemoved) {
+			t.Errorf("%s: got removed %v, want %v", step.name, delta.Removed, step.wantRemoved)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package livemap
+
+import (
+	"fmt"
+
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/helper"
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/model"
+)
+
+// sector colors as used by the styles of the livemap page
+const (
+	sectorSessionBest  = "purple"
+	sectorPersonalBest = "green"
+	sectorSlower       = "yellow"
+)
+
+// LeaderboardRow is a row of the timing tower shown next to the track.
+type LeaderboardRow struct {
+	Position     int       `json:"pos"`
+	Driver       string    `json:"dri"`
+	Class        string    `json:"cls"`
+	Gap          string    `json:"gap"`
+	Interval     string    `json:"int"`
+	Sectors      [3]string `json:"sectors"`
+	SectorColors [3]string `json:"sectorColors"`
+	Pitting      bool      `json:"pit"`
+	Leader       bool      `json:"leader"`
+}
+
+// buildLeaderboard builds the timing tower from the drivers sorted by
+// position. The sectors of the last lap are compared against the best sectors
+// of the session and of the driver.
+func buildLeaderboard(drivers []model.StandingDriverData) []LeaderboardRow {
+	sessionBest := [3]float64{}
+	for _, driver := range drivers {
+		for i, s := range []float64{driver.BestSectorTime1, driver.BestSectorTime2, driver.BestSectorTime3} {
+			if s > 0.0 && (sessionBest[i] <= 0.0 || s < sessionBest[i]) {
+				sessionBest[i] = s
+			}
+		}
+	}
+
+	rows := make([]LeaderboardRow, 0, len(drivers))
+	for idx, driver := range drivers {
+		row := LeaderboardRow{
+			Position: driver.Position,
+			Driver:   helper.GetDriverCodeName(driver.DriverName),
+			Class:    driver.CarClass,
+			Pitting:  driver.Pitting || driver.InGarageStall,
+			Leader:   idx == 0,
+		}
+		if idx > 0 {
+			row.Gap = formatGap(driver.TimeBehindLeader, driver.LapsBehindLeader)
+			row.Interval = formatGap(driver.TimeBehindNext, driver.LapsBehindNext)
+		}
+
+		personalBest := [3]float64{driver.BestSectorTime1, driver.BestSectorTime2, driver.BestSectorTime3}
+		for i, s := range lastLapSectors(driver) {
+			row.Sectors[i] = helper.ToSectorTime(s)
+			row.SectorColors[i] = sectorColor(s, sessionBest[i], personalBest[i])
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func lastLapSectors(driver model.StandingDriverData) [3]float64 {
+	ls1 := driver.LastSectorTime1
+	ls2 := -1.0
+	if ls1 > 0.0 && driver.LastSectorTime2 > 0.0 {
+		ls2 = driver.LastSectorTime2 - ls1
+	}
+	ls3 := -1.0
+	if ls2 > 0.0 && driver.LastLapTime > 0.0 {
+		ls3 = driver.LastLapTime - ls2 - ls1
+	}
+	return [3]float64{ls1, ls2, ls3}
+}
+
+func sectorColor(sector, sessionBest, personalBest float64) string {
+	if sector <= 0.0 {
+		return ""
+	}
+	if sessionBest <= 0.0 || sector <= sessionBest {
+		return sectorSessionBest
+	}
+	if personalBest <= 0.0 || sector <= personalBest {
+		return sectorPersonalBest
+	}
+	return sectorSlower
+}
+
+func formatGap(seconds, laps float64) string {
+	if laps >= 1.0 {
+		return fmt.Sprintf("+%dL", int(laps))
+	}
+	if seconds <= 0.0 {
+		return "-"
+	}
+	return fmt.Sprintf("+%.3f", seconds)
+}
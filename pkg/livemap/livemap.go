@@ -7,13 +7,13 @@ import (
 	"html/template"
 	"image"
 	"log"
-	"math"
 	"net/http"
 	"os"
 	"sync"
 	"time"
 
 	"github.com/oscar-martin/rfactor2telegrambot/pkg/layout"
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/metrics"
 	"github.com/oscar-martin/rfactor2telegrambot/pkg/model"
 	"github.com/oscar-martin/rfactor2telegrambot/pkg/pubsub"
 	"github.com/oscar-martin/rfactor2telegrambot/pkg/resources"
@@ -46,6 +46,10 @@ type LiveMap struct {
 	svgMetadata         layout.SvgMetadata
 	carsPositionChan    <-chan []model.CarPosition
 	carsPosition        []model.CarPosition
+	standingChan        <-chan model.LiveStandingData
+	leaderboard         []LeaderboardRow
+	classColors         map[string]string
+	trails              map[string][]TrailPoint
 	loc                 *i18n.Localizer
 	mu                  sync.Mutex
 }
@@ -57,47 +61,84 @@ func NewLiveMap(r *mux.Router, serverId, path string, loc *i18n.Localizer) *Live
 		path:             path,
 		carsPositionChan: pubsub.CarsPositionPubSub.Subscribe(pubsub.PubSubCarsPositionPreffix + serverId),
 		carsPosition:     []model.CarPosition{},
+		standingChan:     pubsub.LiveStandingDataPubSub.Subscribe(pubsub.PubSubDriversSessionPreffix + serverId),
+		leaderboard:      []LeaderboardRow{},
+		trails:           map[string][]TrailPoint{},
 		loc:              loc,
 		mu:               sync.Mutex{},
 	}
 
 	go lm.updateCarsPosition()
+	go lm.updateLeaderboard()
 
 	lm.addHandlers(r, path)
 	return lm
 }
 
 func (lm *LiveMap) GetPath() string {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
 	return lm.path
 }
 
+// Move adds the handlers of the livemap to the router of the new path. The
+// router of the old path must not be served anymore.
+func (lm *LiveMap) Move(r *mux.Router, path string) {
+	lm.mu.Lock()
+	lm.path = path
+	lm.mu.Unlock()
+	lm.addHandlers(r, path)
+}
+
 func (lm *LiveMap) updateCarsPosition() {
 	for carsPosition := range lm.carsPositionChan {
-		lm.mu.Lock()
-		if !lm.sessionRunning {
-			lm.mu.Unlock()
+		transformedCarsPosition, running := lm.transformCarsPosition(carsPosition)
+		if !running {
 			continue
 		}
-		transformedCarsPosition := make([]model.CarPosition, len(carsPosition))
-		for i, carPosition := range carsPosition {
-			if lm.gc != nil {
-				transformedCarsPosition[i] = carPosition
-				p := lm.transformPosition(carPosition.X, carPosition.Z, layout.ScaleSVG)
-				transformedCarsPosition[i].X = p.X
-				transformedCarsPosition[i].Z = p.Z
-			}
-		}
+		lm.mu.Lock()
 		lm.carsPosition = transformedCarsPosition
 		lm.mu.Unlock()
 	}
 }
 
+func (lm *LiveMap) updateLeaderboard() {
+	for lsd := range lm.standingChan {
+		leaderboard := buildLeaderboard(lsd.Drivers)
+		lm.mu.Lock()
+		lm.leaderboard = leaderboard
+		lm.updateTrails(lsd.Drivers)
+		lm.mu.Unlock()
+	}
+}
+
+// transformCarsPosition converts the positions to the coordinates of the track
+// image. It returns false when no session is running.
+func (lm *LiveMap) transformCarsPosition(carsPosition []model.CarPosition) ([]model.CarPosition, bool) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	if !lm.sessionRunning {
+		return nil, false
+	}
+	transformedCarsPosition := make([]model.CarPosition, len(carsPosition))
+	for i, carPosition := range carsPosition {
+		if lm.gc != nil {
+			transformedCarsPosition[i] = carPosition
+			p := lm.transformPosition(carPosition.X, carPosition.Z, layout.ScaleSVG)
+			transformedCarsPosition[i].X = p.X
+			transformedCarsPosition[i].Z = p.Z
+		}
+	}
+	return transformedCarsPosition, true
+}
+
 func (lm *LiveMap) StartSession(ssd model.SelectedSessionData, svgTrackResource resources.Resource) {
 	lm.mu.Lock()
 	defer lm.mu.Unlock()
 
 	lm.selectedSessionData = ssd
 	lm.svgTrackResource = svgTrackResource
+	lm.trails = map[string][]TrailPoint{}
 	svgPath := lm.svgTrackResource.FilePath()
 
 	// open the svg file and read the three last lines
@@ -157,6 +198,8 @@ func (lm *LiveMap) websocketHandler() func(w http.ResponseWriter, r *http.Reques
 			return
 		}
 		defer c.Close()
+		metrics.LiveMapClients.WithLabelValues(lm.serverId).Inc()
+		defer metrics.LiveMapClients.WithLabelValues(lm.serverId).Dec()
 		mt, message, err := c.ReadMessage()
 		if err != nil {
 			log.Println("read:", err)
@@ -168,7 +211,12 @@ func (lm *LiveMap) websocketHandler() func(w http.ResponseWriter, r *http.Reques
 			select {
 			case <-t.C:
 				lm.mu.Lock()
-				bytes, err := json.Marshal(lm.carsPosition)
+				bytes, err := json.Marshal(liveMapMessage{
+					Positions:   lm.carsPosition,
+					Leaderboard: lm.leaderboard,
+					ClassColors: lm.carClassColors(lm.carsPosition),
+					Trails:      lm.shortTrails(),
+				})
 				lm.mu.Unlock()
 				if err != nil {
 					log.Println("marshal:", err)
@@ -188,12 +236,23 @@ func (lm *LiveMap) websocketHandler() func(w http.ResponseWriter, r *http.Reques
 	}
 }
 
+// liveMapMessage is the data sent to the livemap page through the websocket.
+type liveMapMessage struct {
+	Positions   []model.CarPosition     `json:"positions"`
+	Leaderboard []LeaderboardRow        `json:"leaderboard"`
+	ClassColors map[string]string       `json:"classColors"`
+	Trails      map[string][]TrailPoint `json:"trails"`
+}
+
 type Data struct {
 	WebSocketURL string
 	TrackURL     string
 	Width        int
 	Height       int
 	Scale        float64
+	LineURL      string
+	TrailsLabel  string
+	LineHint     string
 }
 
 func (lm *LiveMap) livemapHandler(serverId string) func(w http.ResponseWriter, r *http.Request) {
@@ -225,6 +284,19 @@ func (lm *LiveMap) livemapHandler(serverId string) func(w http.ResponseWriter, r
 			Width:        int(lm.svgMetadata.Width),
 			Height:       int(lm.svgMetadata.Height),
 			Scale:        (1.0 - layout.ScaleSVG),
+			LineURL:      serverId + "/line",
+			TrailsLabel: lm.loc.MustLocalize(&i18n.LocalizeConfig{
+				DefaultMessage: &i18n.Message{
+					ID:    "livemap.trails",
+					Other: "Trails",
+				},
+			}),
+			LineHint: lm.loc.MustLocalize(&i18n.LocalizeConfig{
+				DefaultMessage: &i18n.Message{
+					ID:    "livemap.racingLineHint",
+					Other: "Click a driver to show its racing line colored by speed",
+				},
+			}),
 		}
 		_ = homeTemplate.Execute(w, e)
 	}
@@ -233,30 +305,13 @@ func (lm *LiveMap) livemapHandler(serverId string) func(w http.ResponseWriter, r
 func (lm *LiveMap) addHandlers(r *mux.Router, serverId string) {
 	r.HandleFunc("/livemap", lm.websocketHandler())
 	r.HandleFunc("/live", lm.livemapHandler(serverId))
-}
-
-// Flips the image around the Y axis.
-func invertY(gc draw2d.GraphicContext, rect image.Rectangle, factor float64) {
-	height := rect.Max.Y
-	gc.Translate(0, float64(height))
-	gc.Scale(1.0, -1.0)
+	r.HandleFunc("/events", lm.eventsHandler())
+	r.HandleFunc("/line", lm.racingLineHandler())
 }
 
 func (lm *LiveMap) transformPosition(dataX, dataZ float64, factor float64) Point {
-	lm.gc.Save()
-	lm.gc.MoveTo(dataX*(1.0-factor)+lm.svgMetadata.OffsetX, dataZ*(1.0-factor)+lm.svgMetadata.OffsetZ)
-	invertY(lm.gc, lm.svgMetadata.Rect, factor)
-	if lm.svgMetadata.Rotate {
-		lm.gc.Rotate(math.Pi / 2)
-		f := lm.svgMetadata.Width / lm.svgMetadata.Height
-		lm.gc.Translate(0, -f*float64(lm.svgMetadata.Rect.Max.Y))
-	}
-	x, y := lm.gc.LastPoint()
-	lp := []float64{x, y}
-	m := lm.gc.GetMatrixTransform()
-	m.Transform(lp)
-	lm.gc.Restore()
-	return Point{X: lp[0], Y: 0.0, Z: lp[1], Type: 0}
+	x, z := layout.TransformPosition(lm.gc, lm.svgMetadata, dataX, dataZ, factor)
+	return Point{X: x, Y: 0.0, Z: z, Type: 0}
 }
 
 var homeTemplate = template.Must(template.New("").Parse(`
@@ -266,21 +321,60 @@ var homeTemplate = template.Must(template.New("").Parse(`
   <meta charset="UTF-8">
   <meta name="viewport" content="width=device-width, initial-scale=1.0">
   <title>rFactor2 LiveMap</title>
+  <style>
+    body { display: flex; align-items: flex-start; gap: 16px; }
+    #leaderboard { border-collapse: collapse; font-family: monospace; font-size: 14px; background: #222222; color: #EEEEEE; }
+    #leaderboard td { padding: 2px 6px; text-align: right; }
+    #leaderboard td.driver { text-align: left; font-weight: bold; }
+    #leaderboard tr.leader { border-left: 4px solid #E7E772; font-weight: bold; }
+    #leaderboard td.purple { color: #B23AEE; }
+    #leaderboard td.green { color: #32CD32; }
+    #leaderboard td.yellow { color: #FFD700; }
+    #leaderboard .pit { background: #EEEEEE; color: #222222; padding: 0 3px; }
+    #classFilter { margin-bottom: 8px; font-family: monospace; font-size: 14px; }
+    #classFilter label { margin-right: 8px; }
+    #options { margin-bottom: 8px; font-family: monospace; font-size: 14px; }
+    #leaderboard tr.selected { outline: 2px solid #3498DB; }
+    #classFilter .swatch { display: inline-block; width: 10px; height: 10px; margin-right: 4px; border: 1px solid #111111; }
+  </style>
 </head>
 <body>
 
   <!-- SVG container -->
 	<svg id="svgContainer" width="{{ .Width }}" height="{{ .Height }}" xmlns="http://www.w3.org/2000/svg"></svg>
 
+  <div>
+    <!-- Trails and racing line -->
+    <div id="options">
+      <label><input type="checkbox" id="trailsToggle" checked>{{ .TrailsLabel }}</label>
+      <div>{{ .LineHint }}</div>
+    </div>
+
+    <!-- Class filter -->
+    <div id="classFilter"></div>
+
+    <!-- Timing tower -->
+    <table id="leaderboard"><tbody id="leaderboardBody"></tbody></table>
+  </div>
+
   <script>
     const trackUrl = '{{ .TrackURL }}';
     const wsUrl = '{{ .WebSocketURL }}';
+    const lineUrl = '{{ .LineURL }}';
 
     // SVG container element
     const svgContainer = document.getElementById('svgContainer');
 
 		const cars = new Map();
 
+		// classes not shown on the map and the timing tower
+		const hiddenClasses = new Set();
+		const filterClasses = new Set();
+
+		// driver whose racing line is shown
+		var selectedDriver = null;
+		const trailsToggle = document.getElementById('trailsToggle');
+
     // WebSocket connection
     const socket = new WebSocket(wsUrl);
 
@@ -293,7 +387,11 @@ var homeTemplate = template.Must(template.New("").Parse(`
     // Listen for messages from the server
     socket.addEventListener('message', (event) => {
       // Parse the received JSON data
-      const driversData = JSON.parse(event.data);
+      const message = JSON.parse(event.data);
+			const driversData = message.positions;
+
+			updateClassFilter(message.classColors);
+			drawLeaderboard(message.leaderboard);
 
 			const driversAlive = new Set();
 
@@ -313,12 +411,16 @@ var homeTemplate = template.Must(template.New("").Parse(`
 				} else {
 					carElements = cars.get(id);
 				}
-				if (i < driversData.length - 1) {
-					drawCar(carElements, x, y, '#EEEEEE', '#393939');
-				} else {
-					// leader
-					drawCar(carElements, x, y, '#E7E772', '#393939');
+				// the leader is the last one
+				const leader = i == driversData.length - 1;
+				var color = leader ? '#E7E772' : '#EEEEEE';
+				if (data.cls && message.classColors[data.cls]) {
+					color = message.classColors[data.cls];
 				}
+				carElements.title.textContent = data.num ? '#' + data.num + ' ' + data.cls : data.cls;
+				carElements.car.style.display = hiddenClasses.has(data.cls) ? 'none' : '';
+				drawCar(carElements, x, y, color, '#393939', leader);
+				drawTrail(carElements, trailsToggle.checked ? message.trails[id] : null, color);
 				i++;
 			}
 
@@ -347,7 +449,12 @@ var homeTemplate = template.Must(template.New("").Parse(`
 			const carElement = document.createElementNS('http://www.w3.org/2000/svg', 'g');
 			const circleElement = document.createElementNS('http://www.w3.org/2000/svg', 'circle');
 			const textElement = document.createElementNS('http://www.w3.org/2000/svg', 'text');
+			const titleElement = document.createElementNS('http://www.w3.org/2000/svg', 'title');
+			const trailElement = document.createElementNS('http://www.w3.org/2000/svg', 'g');
 
+			carElement.setAttribute('class', 'car');
+			carElement.style.cursor = 'pointer';
+			carElement.addEventListener('click', () => selectDriver(id));
 			textElement.setAttribute('text-anchor', 'middle');
 			textElement.setAttribute('dy', '.3em');
 			textElement.setAttribute('stroke-width', '2px');
@@ -356,16 +463,96 @@ var homeTemplate = template.Must(template.New("").Parse(`
 			circleElement.setAttribute('r', 25); // Radius, adjust as needed
 			circleElement.setAttribute('stroke', '#111111'); // Color, adjust as needed
 			circleElement.setAttribute('stroke-width', '2px');
+			// the trail is drawn below the car
+			carElement.appendChild(trailElement);
 			carElement.appendChild(circleElement);
 			carElement.appendChild(textElement);
+			carElement.appendChild(titleElement);
 
 			svgContainer.appendChild(carElement);
 
-			return {circle: circleElement, text: textElement, car: carElement};
+			return {circle: circleElement, text: textElement, title: titleElement, trail: trailElement, car: carElement};
+		}
+
+		// Draws the last positions of the car fading out
+		function drawTrail(carElements, points, color) {
+			const trailElement = carElements.trail;
+			trailElement.replaceChildren();
+			if (!points) {
+				return;
+			}
+			for (let i = 1; i < points.length; i++) {
+				const line = document.createElementNS('http://www.w3.org/2000/svg', 'line');
+				line.setAttribute('x1', points[i - 1].x);
+				line.setAttribute('y1', points[i - 1].z);
+				line.setAttribute('x2', points[i].x);
+				line.setAttribute('y2', points[i].z);
+				line.setAttribute('stroke', color);
+				line.setAttribute('stroke-width', '8px');
+				line.setAttribute('stroke-linecap', 'round');
+				line.setAttribute('opacity', i / points.length);
+				trailElement.appendChild(line);
+			}
+		}
+
+		// Shows the racing line of the driver or hides it if it is already shown
+		function selectDriver(id) {
+			selectedDriver = selectedDriver == id ? null : id;
+			drawRacingLine();
+		}
+
+		async function drawRacingLine() {
+			var lineElement = document.getElementById('racingLine');
+			if (lineElement == null) {
+				lineElement = document.createElementNS('http://www.w3.org/2000/svg', 'g');
+				lineElement.id = 'racingLine';
+			}
+			// below the cars and above the track
+			svgContainer.insertBefore(lineElement, svgContainer.querySelector('g.car'));
+			if (selectedDriver == null) {
+				lineElement.replaceChildren();
+				return;
+			}
+			try {
+				const response = await fetch(lineUrl + '?driver=' + encodeURIComponent(selectedDriver));
+				if (!response.ok) {
+					throw new Error(` + "`Failed to fetch racing line: ${response.statusText}`" + `);
+				}
+				const points = await response.json();
+				var minSpeed = Infinity;
+				var maxSpeed = 0;
+				for (const point of points) {
+					minSpeed = Math.min(minSpeed, point.speed);
+					maxSpeed = Math.max(maxSpeed, point.speed);
+				}
+				lineElement.replaceChildren();
+				for (let i = 1; i < points.length; i++) {
+					// from blue (slowest) to red (fastest)
+					const f = maxSpeed > minSpeed ? (points[i].speed - minSpeed) / (maxSpeed - minSpeed) : 1;
+					const line = document.createElementNS('http://www.w3.org/2000/svg', 'line');
+					line.setAttribute('x1', points[i - 1].x);
+					line.setAttribute('y1', points[i - 1].z);
+					line.setAttribute('x2', points[i].x);
+					line.setAttribute('y2', points[i].z);
+					line.setAttribute('stroke', ` + "`hsl(${240 - 240 * f}, 100%, 50%)`" + `);
+					line.setAttribute('stroke-width', '6px');
+					line.setAttribute('stroke-linecap', 'round');
+					lineElement.appendChild(line);
+				}
+			} catch (error) {
+				console.error(error.message);
+			}
 		}
 
+		// the racing line is refreshed while it is shown
+		setInterval(() => {
+			if (selectedDriver != null) {
+				drawRacingLine();
+			}
+		}, 2000);
+
     // Function to draw a circle on the SVG
-    function drawCar(carElements, x, y, bColor, fColor) {
+    function drawCar(carElements, x, y, bColor, fColor, leader) {
 			const circleElement = carElements.circle;
 			const textElement = carElements.text;
 			const carElement = carElements.car;
@@ -376,8 +563,84 @@ var homeTemplate = template.Must(template.New("").Parse(`
 			circleElement.setAttribute('cx', x);
       circleElement.setAttribute('cy', y);
 			circleElement.setAttribute('fill', bColor);
+			// the leader is ringed as its color may be the one of its class
+			circleElement.setAttribute('stroke', leader ? '#E7E772' : '#111111');
+			circleElement.setAttribute('stroke-width', leader ? '6px' : '2px');
     }
 
+		// Draws the timing tower: position, driver, gap to leader, interval and sectors
+		function drawLeaderboard(rows) {
+			const body = document.getElementById('leaderboardBody');
+			body.replaceChildren();
+			for (const row of rows) {
+				if (hiddenClasses.has(row.cls)) {
+					continue;
+				}
+				const tr = document.createElement('tr');
+				if (row.leader) {
+					tr.classList.add('leader');
+				}
+				if (row.dri == selectedDriver) {
+					tr.classList.add('selected');
+				}
+				tr.style.cursor = 'pointer';
+				tr.addEventListener('click', () => selectDriver(row.dri));
+				addCell(tr, row.pos, '');
+				const driverCell = addCell(tr, row.dri + ' ', 'driver');
+				if (row.pit) {
+					const pit = document.createElement('span');
+					pit.className = 'pit';
+					pit.textContent = 'PIT';
+					driverCell.appendChild(pit);
+				}
+				addCell(tr, row.gap, '');
+				addCell(tr, row.int, '');
+				for (let i = 0; i < 3; i++) {
+					addCell(tr, row.sectors[i], row.sectorColors[i]);
+				}
+				body.appendChild(tr);
+			}
+		}
+
+		// Adds a toggle for every class not seen before
+		function updateClassFilter(classColors) {
+			const filter = document.getElementById('classFilter');
+			for (const [cls, color] of Object.entries(classColors)) {
+				if (filterClasses.has(cls)) {
+					continue;
+				}
+				filterClasses.add(cls);
+				const label = document.createElement('label');
+				const checkbox = document.createElement('input');
+				checkbox.type = 'checkbox';
+				checkbox.checked = true;
+				checkbox.addEventListener('change', () => {
+					if (checkbox.checked) {
+						hiddenClasses.delete(cls);
+					} else {
+						hiddenClasses.add(cls);
+					}
+				});
+				const swatch = document.createElement('span');
+				swatch.className = 'swatch';
+				swatch.style.background = color;
+				label.appendChild(checkbox);
+				label.appendChild(swatch);
+				label.appendChild(document.createTextNode(cls));
+				filter.appendChild(label);
+			}
+		}
+
+		function addCell(tr, text, className) {
+			const td = document.createElement('td');
+			td.textContent = text;
+			if (className) {
+				td.className = className;
+			}
+			tr.appendChild(td);
+			return td;
+		}
+
     // Function to download and display the SVG
     async function downloadAndDisplaySVG(url) {
       try {
@@ -0,0 +1,91 @@
+package livemap
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/helper"
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/layout"
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/model"
+)
+
+const (
+	// points kept for every car, about a couple of laps
+	trailHistoryPoints = 1500
+	// points of the trail drawn behind every car
+	trailPoints = 10
+)
+
+// TrailPoint is a position of a car in the coordinates of the track image and
+// its speed in km/h.
+type TrailPoint struct {
+	X     float64 `json:"x"`
+	Z     float64 `json:"z"`
+	Speed float64 `json:"speed"`
+}
+
+// updateTrails adds the current position of every driver to its trail. The
+// trails of the drivers that left are removed. It must be called with the
+// lock held.
+func (lm *LiveMap) updateTrails(drivers []model.StandingDriverData) {
+	if !lm.sessionRunning || lm.gc == nil {
+		return
+	}
+	present := map[string]bool{}
+	for _, driver := range drivers {
+		code := helper.GetDriverCodeName(driver.DriverName)
+		present[code] = true
+		p := lm.transformPosition(driver.CarPosition.X, driver.CarPosition.Z, layout.ScaleSVG)
+		trail := lm.trails[code]
+		// stopped cars do not add points
+		if len(trail) > 0 && trail[len(trail)-1].X == p.X && trail[len(trail)-1].Z == p.Z {
+			continue
+		}
+		trail = append(trail, TrailPoint{X: p.X, Z: p.Z, Speed: driver.CarVelocity.Velocity * 3.6})
+		// the oldest points are discarded once in a while instead of on every
+		// update
+		if len(trail) > 2*trailHistoryPoints {
+			trail = append([]TrailPoint{}, trail[len(trail)-trailHistoryPoints:]...)
+		}
+		lm.trails[code] = trail
+	}
+	for code := range lm.trails {
+		if !present[code] {
+			delete(lm.trails, code)
+		}
+	}
+}
+
+// shortTrails returns the last points of every trail. It must be called with
+// the lock held.
+func (lm *LiveMap) shortTrails() map[string][]TrailPoint {
+	trails := map[string][]TrailPoint{}
+	for code, trail := range lm.trails {
+		if len(trail) > trailPoints {
+			trail = trail[len(trail)-trailPoints:]
+		}
+		trails[code] = trail
+	}
+	return trails
+}
+
+// racingLineHandler returns the whole trail of the driver whose code is in the
+// driver query parameter.
+func (lm *LiveMap) racingLineHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lm.mu.Lock()
+		trail := lm.trails[r.URL.Query().Get("driver")]
+		if len(trail) > trailHistoryPoints {
+			trail = trail[len(trail)-trailHistoryPoints:]
+		}
+		line := append([]TrailPoint{}, trail...)
+		lm.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		err := json.NewEncoder(w).Encode(line)
+		if err != nil {
+			log.Printf("Error writing racing line: %s\n", err.Error())
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package locale
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"path/filepath"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"golang.org/x/text/language"
+)
+
+// MessageFiles matches the translation files loaded at startup.
+const MessageFiles = "active.*.json"
+
+type contextKey struct{}
+
+// Localizers has a localizer for every language with a translation file.
+// English is the default language and the one of the messages missing in the
+// rest of the languages.
+type Localizers struct {
+	languages  []string
+	matcher    language.Matcher
+	localizers map[string]*i18n.Localizer
+}
+
+// NewLocalizers loads the translation files matching the pattern.
+func NewLocalizers(pattern string) (*Localizers, error) {
+	bundle := i18n.NewBundle(language.English)
+	bundle.RegisterUnmarshalFunc("json", json.Unmarshal)
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		_, err := bundle.LoadMessageFile(file)
+		if err != nil {
+			log.Printf("Error loading translation file %s: %s\n", file, err.Error())
+			return nil, err
+		}
+	}
+
+	// the default language goes first so the matcher falls back to it
+	tags := []language.Tag{language.English}
+	for _, tag := range bundle.LanguageTags() {
+		if tag != language.English {
+			tags = append(tags, tag)
+		}
+	}
+	l := &Localizers{
+		matcher:    language.NewMatcher(tags),
+		localizers: map[string]*i18n.Localizer{},
+	}
+	for _, tag := range tags {
+		l.languages = append(l.languages, tag.String())
+		l.localizers[tag.String()] = i18n.NewLocalizer(bundle, tag.String())
+	}
+	return l, nil
+}
+
+// Languages returns the codes of the languages, the default one first.
+func (l *Localizers) Languages() []string {
+	return l.languages
+}
+
+// Has returns whether there is a translation for the language.
+func (l *Localizers) Has(lang string) bool {
+	_, found := l.localizers[lang]
+	return found
+}
+
+// Default returns the localizer of the default language.
+func (l *Localizers) Default() *i18n.Localizer {
+	return l.localizers[l.languages[0]]
+}
+
+// Get returns the localizer of the language or the default one if there is no
+// translation for it.
+func (l *Localizers) Get(lang string) *i18n.Localizer {
+	if loc, found := l.localizers[lang]; found {
+		return loc
+	}
+	return l.Default()
+}
+
+// Match returns the language with translation closest to the code sent by the
+// Telegram clients, like "es" or "en-US".
+func (l *Localizers) Match(code string) string {
+	_, idx, confidence := l.matcher.Match(language.Make(code))
+	if confidence == language.No {
+		return l.languages[0]
+	}
+	return l.languages[idx]
+}
+
+// Matches returns whether the text is the one returned by localize in any
+// language. Buttons are matched this way, as the keyboard of a user may have
+// been sent before the user changed the language.
+func (l *Localizers) Matches(text string, localize func(loc *i18n.Localizer) string) bool {
+	for _, lang := range l.languages {
+		if text == localize(l.localizers[lang]) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewContext returns a copy of the context with the localizer of the user.
+func NewContext(ctx context.Context, loc *i18n.Localizer) context.Context {
+	return context.WithValue(ctx, contextKey{}, loc)
+}
+
+// FromContext returns the localizer of the user of the context or the default
+// one if there is none.
+func (l *Localizers) FromContext(ctx context.Context) *i18n.Localizer {
+	if loc, ok := ctx.Value(contextKey{}).(*i18n.Localizer); ok {
+		return loc
+	}
+	return l.Default()
+}
+
+// Name returns the name of the language in that language.
+func (l *Localizers) Name(lang string) string {
+	return l.Get(lang).MustLocalize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{
+			ID:    "locale.name",
+			Other: "English",
+		},
+	})
+}
@@ -1,32 +1,38 @@
 package menus
 
 import (
+	"context"
+
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/locale"
+
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/nicksnyder/go-i18n/v2/i18n"
 )
 
+// Menuer returns the menu for the user of the context, in its language and
+// with the entries it can see.
 type Menuer interface {
-	Menu() tgbotapi.ReplyKeyboardMarkup
+	Menu(ctx context.Context) tgbotapi.ReplyKeyboardMarkup
 }
 
 type ApplicationMenu struct {
 	Name       string
 	From       string
 	prevMenuer Menuer
-	loc        *i18n.Localizer
+	locs       *locale.Localizers
 }
 
-func NewApplicationMenu(name, from string, prevMenuer Menuer, loc *i18n.Localizer) ApplicationMenu {
+func NewApplicationMenu(name, from string, prevMenuer Menuer, locs *locale.Localizers) ApplicationMenu {
 	return ApplicationMenu{
 		Name:       name,
 		From:       from,
 		prevMenuer: prevMenuer,
-		loc:        loc,
+		locs:       locs,
 	}
 }
 
-func (am *ApplicationMenu) ButtonBackTo() string {
-	buttonBackTo := am.loc.MustLocalize(&i18n.LocalizeConfig{
+func (am *ApplicationMenu) ButtonBackTo(loc *i18n.Localizer) string {
+	buttonBackTo := loc.MustLocalize(&i18n.LocalizeConfig{
 		// MessageID: "menus.backTo",
 		DefaultMessage: &i18n.Message{
 			ID:    "menus.backTo",
@@ -37,6 +43,12 @@ func (am *ApplicationMenu) ButtonBackTo() string {
 	return buttonBackTo + " " + am.From
 }
 
-func (am *ApplicationMenu) PrevMenu() tgbotapi.ReplyKeyboardMarkup {
-	return am.prevMenuer.Menu()
+// IsButtonBackTo returns whether the button is the back button in any
+// language.
+func (am *ApplicationMenu) IsButtonBackTo(button string) bool {
+	return am.locs.Matches(button, am.ButtonBackTo)
+}
+
+func (am *ApplicationMenu) PrevMenu(ctx context.Context) tgbotapi.ReplyKeyboardMarkup {
+	return am.prevMenuer.Menu(ctx)
 }
@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "rf2bot"
+
+var (
+	WebSocketRunning = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "websocket_running",
+		Help:      "Whether the bot is connected to the websocket of the server.",
+	}, []string{"server"})
+	ReceivingData = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "receiving_data",
+		Help:      "Whether the server is sending session data.",
+	}, []string{"server"})
+	MessagesReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_received_total",
+		Help:      "Messages received from the servers by type.",
+	}, []string{"server", "type"})
+	WebSocketConnections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "websocket_connections_total",
+		Help:      "Attempts to connect to the websocket of the servers by result.",
+	}, []string{"server", "result"})
+	PublishLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "pubsub_publish_seconds",
+		Help:      "Time taken to deliver a message to every subscriber of a topic.",
+		Buckets:   []float64{.0001, .001, .01, .1, .5, 1, 5},
+	}, []string{"topic"})
+	PubSubDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "pubsub_dropped_total",
+		Help:      "Messages dropped because a subscriber of the topic was too slow.",
+	}, []string{"topic"})
+	LiveMapClients = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "livemap_clients",
+		Help:      "Browsers connected to the livemap of the server.",
+	}, []string{"server"})
+	TelegramErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "telegram_errors_total",
+		Help:      "Requests to the Telegram API that failed by method.",
+	}, []string{"method"})
+	NotificationsSent = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "notifications_sent_total",
+		Help:      "Notifications sent to Telegram users by type.",
+	}, []string{"type"})
+)
+
+// HTTPClient counts the failed requests to the Telegram API. It is meant to
+// be set as the client of the bot.
+type HTTPClient struct {
+	Client *http.Client
+}
+
+func (c HTTPClient) Do(req *http.Request) (*http.Response, error) {
+	// the method is the last element of the path: /bot<token>/<method>
+	method := req.URL.Path[strings.LastIndex(req.URL.Path, "/")+1:]
+	resp, err := c.Client.Do(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		TelegramErrors.WithLabelValues(method).Inc()
+	}
+	return resp, err
+}
@@ -1,7 +1,5 @@
 package model
 
-import "fmt"
-
 type LiveStandingData struct {
 	ServerName string               `json:"serverName"`
 	ServerID   string               `json:"serverId"`
@@ -107,6 +105,8 @@ type CarPosition struct {
 	Y               float64 `json:"y"`
 	X               float64 `json:"x"`
 	DriverShortName string  `json:"dri,omitempty"`
+	CarClass        string  `json:"cls,omitempty"`
+	CarNumber       string  `json:"num,omitempty"`
 }
 
 type CarVelocity struct {
@@ -177,6 +177,14 @@ type SessionInfo struct {
 	RaceCompletion     RaceCompletion `json:"raceCompletion"`
 }
 
+// ServerDefinition is a server configured in the bot.
+type ServerDefinition struct {
+	ID          string `json:"id"`
+	URL         string `json:"url"`
+	Name        string `json:"name"`
+	MembersOnly bool   `json:"membersOnly"`
+}
+
 type ServerStarted struct {
 	ServerName  string  `json:"serverName"`
 	ServerID    string  `json:"serverId"`
@@ -185,8 +193,12 @@ type ServerStarted struct {
 	EventTime   float64 `json:"eventTime"`
 }
 
-func (ss ServerStarted) String() string {
-	return fmt.Sprintf("  ▸ Servidor: %s\n  ▸ Sesión: %s\n  ▸ Circuito: %s", ss.ServerName, ss.SessionType, ss.TrackName)
+type SessionFinished struct {
+	ServerName  string           `json:"serverName"`
+	ServerID    string           `json:"serverId"`
+	SessionType string           `json:"sessionType"`
+	TrackName   string           `json:"trackName"`
+	Standing    LiveStandingData `json:"standing"`
 }
 
 // Series struct represents the "series" part of the JSON.
@@ -0,0 +1,241 @@
+package notification
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"time"
+
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/helper"
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/model"
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/pubsub"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+const (
+	driverEventPersonalBest = iota
+	driverEventPassed
+	driverEventPitting
+	driverEventEntered
+	driverEventLeft
+)
+
+const (
+	// the events of the same kind of a driver are notified once per interval,
+	// so a battle for a position does not flood the chats
+	driverEventInterval = time.Minute
+	// batches of events of a server waiting to be sent. New batches are
+	// dropped while the queue is full
+	driverEventsQueue = 16
+)
+
+type driverEvent struct {
+	kind     int
+	driver   model.StandingDriverData
+	passedBy string
+}
+
+// driverEvents are the events of a server found in a standing.
+type driverEvents struct {
+	serverID   string
+	serverName string
+	events     []driverEvent
+}
+
+// WatchDrivers compares the consecutive standings of the server and notifies
+// the users following a driver when it sets a personal best, gets passed,
+// pits or enters or leaves the server. Servers already watched are ignored.
+func (m *Manager) WatchDrivers(serverID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.watching[serverID] {
+		return
+	}
+	m.watching[serverID] = true
+
+	sessionInfoChan := pubsub.LiveSessionInfoDataPubSub.Subscribe(pubsub.PubSubSessionInfoPreffix + serverID)
+	standingChan := pubsub.LiveStandingDataPubSub.Subscribe(pubsub.PubSubDriversSessionPreffix + serverID)
+
+	eventsChan := make(chan driverEvents, driverEventsQueue)
+
+	go m.driversWatcher(sessionInfoChan, standingChan, eventsChan)
+	go m.driverEventsSender(eventsChan)
+}
+
+func (m *Manager) driversWatcher(sessionInfoChan <-chan model.LiveSessionInfoData, standingChan <-chan model.LiveStandingData, eventsChan chan<- driverEvents) {
+	session := ""
+	var prev *model.LiveStandingData
+	lastSent := map[string]time.Time{}
+	handleStanding := func(lsd model.LiveStandingData) {
+		// the server publishes empty data when it is reset
+		if len(lsd.Drivers) == 0 {
+			prev = nil
+			return
+		}
+		if prev != nil {
+			events := throttleDriverEvents(diffStandings(*prev, lsd), lastSent, time.Now())
+			if len(events) > 0 {
+				// do not block the publisher while sending the messages
+				select {
+				case eventsChan <- driverEvents{serverID: lsd.ServerID, serverName: lsd.ServerName, events: events}:
+				default:
+					log.Printf("Dropping driver events of server %s: too many pending messages\n", lsd.ServerID)
+				}
+			}
+		}
+		prev = &lsd
+	}
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case lsid := <-sessionInfoChan:
+			// positions and best laps start over in a new session
+			if lsid.SessionInfo.Session != session {
+				// the standings buffered before the change belong to the
+				// previous session
+				pubsub.Drain(standingChan, handleStanding)
+				session = lsid.SessionInfo.Session
+				prev = nil
+			}
+		case lsd := <-standingChan:
+			handleStanding(lsd)
+		}
+	}
+}
+
+// driverEventsSender sends the events of a server in the order they were
+// found.
+func (m *Manager) driverEventsSender(eventsChan <-chan driverEvents) {
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case de := <-eventsChan:
+			m.handleDriverEvents(de.serverID, de.serverName, de.events)
+		}
+	}
+}
+
+// throttleDriverEvents drops the events of a driver whose kind was already
+// notified less than driverEventInterval ago.
+func throttleDriverEvents(events []driverEvent, lastSent map[string]time.Time, now time.Time) []driverEvent {
+	throttled := []driverEvent{}
+	for _, event := range events {
+		key := fmt.Sprintf("%d:%s", event.kind, event.driver.DriverName)
+		if now.Sub(lastSent[key]) < driverEventInterval {
+			continue
+		}
+		lastSent[key] = now
+		throttled = append(throttled, event)
+	}
+	return throttled
+}
+
+// diffStandings returns the events of the drivers between two consecutive
+// standings of the same session.
+func diffStandings(prev, curr model.LiveStandingData) []driverEvent {
+	events := []driverEvent{}
+	prevDrivers := map[string]model.StandingDriverData{}
+	for _, d := range prev.Drivers {
+		prevDrivers[d.DriverName] = d
+	}
+	currDrivers := map[string]model.StandingDriverData{}
+	byPosition := map[int]string{}
+	for _, d := range curr.Drivers {
+		currDrivers[d.DriverName] = d
+		byPosition[d.Position] = d.DriverName
+	}
+
+	for _, d := range curr.Drivers {
+		p, found := prevDrivers[d.DriverName]
+		if !found {
+			events = append(events, driverEvent{kind: driverEventEntered, driver: d})
+			continue
+		}
+		if d.BestLapTime > 0.0 && (p.BestLapTime <= 0.0 || d.BestLapTime < p.BestLapTime) {
+			events = append(events, driverEvent{kind: driverEventPersonalBest, driver: d})
+		}
+		if p.Position > 0 && d.Position > p.Position {
+			events = append(events, driverEvent{kind: driverEventPassed, driver: d, passedBy: byPosition[d.Position-1]})
+		}
+		if d.Pitting && !p.Pitting {
+			events = append(events, driverEvent{kind: driverEventPitting, driver: d})
+		}
+	}
+	for _, p := range prev.Drivers {
+		if _, found := currDrivers[p.DriverName]; !found {
+			events = append(events, driverEvent{kind: driverEventLeft, driver: p})
+		}
+	}
+	return events
+}
+
+func (m *Manager) handleDriverEvents(serverID, serverName string, events []driverEvent) {
+	for _, event := range events {
+		receipients, err := m.lister.ListUsersFollowingDriver(event.driver.DriverName)
+		if err != nil {
+			log.Printf("Error listing users following driver %s: %s", event.driver.DriverName, err.Error())
+			continue
+		}
+		err = m.send(notificationFollowedDriver, m.canSeeServer(receipients, serverID), func(loc *i18n.Localizer) (string, string) {
+			subject := loc.MustLocalize(&i18n.LocalizeConfig{
+				DefaultMessage: &i18n.Message{
+					ID:    "notification.followedDriver",
+					Other: "Followed driver in %s:",
+				},
+			})
+			return fmt.Sprintf(subject, html.EscapeString(serverName)), driverEventMessage(event, loc)
+		})
+		if err != nil {
+			log.Printf("Error notifying users: %s", err.Error())
+		}
+	}
+}
+
+func driverEventMessage(event driverEvent, loc *i18n.Localizer) string {
+	driverName := html.EscapeString(event.driver.DriverName)
+	switch event.kind {
+	case driverEventPersonalBest:
+		message := loc.MustLocalize(&i18n.LocalizeConfig{
+			DefaultMessage: &i18n.Message{
+				ID:    "notification.driverPersonalBest",
+				Other: "⏱ %s set a personal best: %s",
+			},
+		})
+		return fmt.Sprintf(message, driverName, helper.SecondsToMinutes(event.driver.BestLapTime))
+	case driverEventPassed:
+		message := loc.MustLocalize(&i18n.LocalizeConfig{
+			DefaultMessage: &i18n.Message{
+				ID:    "notification.driverPassed",
+				Other: "⬇️ %s was passed by %s and is now P%d",
+			},
+		})
+		return fmt.Sprintf(message, driverName, html.EscapeString(event.passedBy), event.driver.Position)
+	case driverEventPitting:
+		message := loc.MustLocalize(&i18n.LocalizeConfig{
+			DefaultMessage: &i18n.Message{
+				ID:    "notification.driverPitting",
+				Other: "🔧 %s is pitting from P%d",
+			},
+		})
+		return fmt.Sprintf(message, driverName, event.driver.Position)
+	case driverEventEntered:
+		message := loc.MustLocalize(&i18n.LocalizeConfig{
+			DefaultMessage: &i18n.Message{
+				ID:    "notification.driverEntered",
+				Other: "➡️ %s entered the server",
+			},
+		})
+		return fmt.Sprintf(message, driverName)
+	default:
+		message := loc.MustLocalize(&i18n.LocalizeConfig{
+			DefaultMessage: &i18n.Message{
+				ID:    "notification.driverLeft",
+				Other: "⬅️ %s left the server",
+			},
+		})
+		return fmt.Sprintf(message, driverName)
+	}
+}
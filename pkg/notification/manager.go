@@ -2,10 +2,17 @@ package notification
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"html"
 	"log"
 	"strconv"
 	"strings"
+	"sync"
 
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/helper"
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/locale"
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/metrics"
 	"github.com/oscar-martin/rfactor2telegrambot/pkg/model"
 	"github.com/oscar-martin/rfactor2telegrambot/pkg/pubsub"
 	"github.com/oscar-martin/rfactor2telegrambot/pkg/settings"
@@ -21,34 +28,53 @@ const (
 	TypeQual     = "qual1"
 	TypeWarnup   = "warmup"
 	TypeRace     = "race1"
+
+	podiumPositions = 3
+
+	notificationSessionStarted = "session_started"
+	notificationRaceFinished   = "race_finished"
+	notificationFollowedDriver = "followed_driver"
 )
 
+var podiumSymbols = []string{"🥇", "🥈", "🥉"}
+
 type Lister interface {
-	ListUsersForSessionStarted(sessionType string) ([]settings.TelegramUser, error)
+	ListUsersForSessionStarted(serverID, sessionType string) ([]settings.TelegramUser, error)
+	ListUsersForRaceFinished(serverID string) ([]settings.TelegramUser, error)
+	ListUsersFollowingDriver(driverName string) ([]settings.TelegramUser, error)
+	StoredLanguage(userID string) (string, error)
+	CanSeeServer(userID, serverID string) bool
 }
 
 type Manager struct {
-	ctx    context.Context
-	lister Lister
-	bot    *tgbotapi.BotAPI
-	loc    *i18n.Localizer
+	ctx      context.Context
+	lister   Lister
+	bot      *tgbotapi.BotAPI
+	locs     *locale.Localizers
+	watching map[string]bool
+	mu       sync.Mutex
 }
 
-func NewManager(ctx context.Context, bot *tgbotapi.BotAPI, lister Lister, loc *i18n.Localizer) *Manager {
+func NewManager(ctx context.Context, bot *tgbotapi.BotAPI, lister Lister, locs *locale.Localizers) *Manager {
 	return &Manager{
-		ctx:    ctx,
-		bot:    bot,
-		lister: lister,
-		loc:    loc,
+		ctx:      ctx,
+		bot:      bot,
+		lister:   lister,
+		locs:     locs,
+		watching: map[string]bool{},
 	}
 }
 
 func (m *Manager) Start(exitChan <-chan bool) {
 	startedChan := pubsub.FirstDriverEnteredPubSub.Subscribe(pubsub.PubSubFirstDriverEnteredPreffix)
+	finishedChan := pubsub.SessionFinishedPubSub.Subscribe(pubsub.PubSubSessionFinishedPreffix)
 	for {
 		select {
 		case <-exitChan:
 			return
+		case finishedSession := <-finishedChan:
+			log.Printf("Race finished: %s -> %s\n", finishedSession.ServerName, finishedSession.SessionType)
+			m.handleRaceFinishedNotification(finishedSession)
 		case newSession := <-startedChan:
 			sessionType := strings.ToLower(newSession.SessionType)
 			if isSessionToBeNotified(sessionType) {
@@ -71,46 +97,186 @@ func (m *Manager) Start(exitChan <-chan bool) {
 }
 
 func (m *Manager) handleNotification(newSession model.ServerStarted, sessionType string) {
-	receipients, err := m.lister.ListUsersForSessionStarted(sessionType)
+	receipients, err := m.lister.ListUsersForSessionStarted(newSession.ServerID, sessionType)
 	log.Printf("Sending notification for %s -> %s to %d telegram users\n", newSession.ServerName, sessionType, len(receipients))
 	if err != nil {
 		log.Printf("Error listing users for session started: %s", err.Error())
 		return
 	}
-	err = m.sendNotification(receipients, newSession)
+	err = m.sendNotification(m.canSeeServer(receipients, newSession.ServerID), newSession)
 	if err != nil {
 		log.Printf("Error notifying users: %s", err.Error())
 	}
 }
 
-func (m *Manager) sendNotification(tusers []settings.TelegramUser, newSession model.ServerStarted) error {
-	if len(tusers) == 0 {
-		return nil
+func (m *Manager) handleRaceFinishedNotification(finishedSession model.SessionFinished) {
+	receipients, err := m.lister.ListUsersForRaceFinished(finishedSession.ServerID)
+	log.Printf("Sending race finished notification for %s to %d telegram users\n", finishedSession.ServerName, len(receipients))
+	if err != nil {
+		log.Printf("Error listing users for race finished: %s", err.Error())
+		return
 	}
 
-	tg := Telegram{}
-	tg.SetClient(m.bot)
+	err = m.send(notificationRaceFinished, m.canSeeServer(receipients, finishedSession.ServerID), func(loc *i18n.Localizer) (string, string) {
+		subject := loc.MustLocalize(&i18n.LocalizeConfig{
+			DefaultMessage: &i18n.Message{
+				ID:    "notification.raceFinished",
+				Other: "Race finished:",
+			},
+		})
+		return subject, raceFinishedMessage(finishedSession, loc)
+	})
+	if err != nil {
+		log.Printf("Error notifying users: %s", err.Error())
+	}
+}
 
-	for _, tuser := range tusers {
-		chatId, _ := strconv.ParseInt(tuser.ChatID, 0, 64)
-		tg.AddReceivers(chatId)
+func raceFinishedMessage(finishedSession model.SessionFinished, loc *i18n.Localizer) string {
+	serverText := loc.MustLocalize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{
+			ID:    "notification.server",
+			Other: "Server",
+		},
+	})
+	trackText := loc.MustLocalize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{
+			ID:    "notification.track",
+			Other: "Track",
+		},
+	})
+	classWinnersText := loc.MustLocalize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{
+			ID:    "notification.classWinners",
+			Other: "Class winners",
+		},
+	})
+	fastestLapText := loc.MustLocalize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{
+			ID:    "notification.fastestLap",
+			Other: "Fastest lap",
+		},
+	})
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("  ▸ %s: %s\n  ▸ %s: %s\n\n", serverText, html.EscapeString(finishedSession.ServerName), trackText, html.EscapeString(finishedSession.TrackName)))
+
+	drivers := finishedSession.Standing.Drivers
+	for idx := 0; idx < len(drivers) && idx < podiumPositions; idx++ {
+		sb.WriteString(fmt.Sprintf("%s %s (%s)\n", podiumSymbols[idx], html.EscapeString(drivers[idx].DriverName), html.EscapeString(drivers[idx].CarClass)))
 	}
 
-	n := notify.NewWithServices(tg)
+	// drivers are sorted by position so the first driver found for every class is its winner
+	classes := []string{}
+	classWinners := map[string]model.StandingDriverData{}
+	var fastestLap *model.StandingDriverData
+	for idx := range drivers {
+		if _, found := classWinners[drivers[idx].CarClass]; !found {
+			classes = append(classes, drivers[idx].CarClass)
+			classWinners[drivers[idx].CarClass] = drivers[idx]
+		}
+		if drivers[idx].BestLapTime > 0.0 && (fastestLap == nil || drivers[idx].BestLapTime < fastestLap.BestLapTime) {
+			fastestLap = &drivers[idx]
+		}
+	}
+	if len(classes) > 1 {
+		sb.WriteString(fmt.Sprintf("\n%s:\n", classWinnersText))
+		for _, class := range classes {
+			sb.WriteString(fmt.Sprintf("  ▸ %s: %s\n", html.EscapeString(class), html.EscapeString(classWinners[class].DriverName)))
+		}
+	}
+	if fastestLap != nil {
+		sb.WriteString(fmt.Sprintf("\n⏱ %s: %s (%s)\n", fastestLapText, html.EscapeString(fastestLap.DriverName), helper.SecondsToMinutes(fastestLap.BestLapTime)))
+	}
+	return sb.String()
+}
+
+func (m *Manager) sendNotification(tusers []settings.TelegramUser, newSession model.ServerStarted) error {
+	return m.send(notificationSessionStarted, tusers, func(loc *i18n.Localizer) (string, string) {
+		subject := loc.MustLocalize(&i18n.LocalizeConfig{
+			// MessageID: "notification.sessionStarted",
+			DefaultMessage: &i18n.Message{
+				ID:    "notification.sessionStarted",
+				Other: "New session started:",
+			},
+		})
+		return subject, sessionStartedMessage(newSession, loc)
+	})
+}
 
-	msg := m.loc.MustLocalize(&i18n.LocalizeConfig{
-		// MessageID: "notification.sessionStarted",
+func sessionStartedMessage(newSession model.ServerStarted, loc *i18n.Localizer) string {
+	serverText := loc.MustLocalize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{
+			ID:    "notification.server",
+			Other: "Server",
+		},
+	})
+	sessionText := loc.MustLocalize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{
+			ID:    "notification.session",
+			Other: "Session",
+		},
+	})
+	trackText := loc.MustLocalize(&i18n.LocalizeConfig{
 		DefaultMessage: &i18n.Message{
-			ID:    "notification.sessionStarted",
-			Other: "New session started:",
+			ID:    "notification.track",
+			Other: "Track",
 		},
 	})
+	return fmt.Sprintf("  ▸ %s: %s\n  ▸ %s: %s\n  ▸ %s: %s", serverText, html.EscapeString(newSession.ServerName), sessionText, html.EscapeString(newSession.SessionType), trackText, html.EscapeString(newSession.TrackName))
+}
 
-	err := n.Send(m.ctx, msg, newSession.String())
-	if err != nil {
-		return err
+// canSeeServer returns the users that can see the server, so the members only
+// servers are not notified to the rest.
+func (m *Manager) canSeeServer(tusers []settings.TelegramUser, serverID string) []settings.TelegramUser {
+	users := []settings.TelegramUser{}
+	for _, tuser := range tusers {
+		if m.lister.CanSeeServer(tuser.ID, serverID) {
+			users = append(users, tuser)
+		}
+	}
+	return users
+}
+
+// send sends the notification to every user in its language. build returns the
+// subject and the message of the notification in the language of the
+// localizer.
+func (m *Manager) send(notificationType string, tusers []settings.TelegramUser, build func(loc *i18n.Localizer) (string, string)) error {
+	if len(tusers) == 0 {
+		return nil
+	}
+
+	byLanguage := map[string][]settings.TelegramUser{}
+	for _, tuser := range tusers {
+		lang, err := m.lister.StoredLanguage(tuser.ID)
+		if err != nil {
+			log.Printf("Error reading the language of user %s: %s", tuser.ID, err.Error())
+		}
+		byLanguage[lang] = append(byLanguage[lang], tuser)
+	}
+
+	// a failing language group must not keep the others from being notified
+	var errs []error
+	for lang, users := range byLanguage {
+		tg := Telegram{}
+		tg.SetClient(m.bot)
+
+		for _, tuser := range users {
+			chatId, _ := strconv.ParseInt(tuser.ChatID, 0, 64)
+			tg.AddReceivers(chatId)
+		}
+
+		n := notify.NewWithServices(tg)
+
+		subject, message := build(m.locs.Get(lang))
+		err := n.Send(m.ctx, subject, message)
+		if err != nil {
+			log.Printf("Error sending %s notification in %q: %s", notificationType, lang, err.Error())
+			errs = append(errs, err)
+			continue
+		}
+		metrics.NotificationsSent.WithLabelValues(notificationType).Add(float64(len(users)))
 	}
-	return nil
+	return errors.Join(errs...)
 }
 
 func isTestDay(sessionType string) bool {
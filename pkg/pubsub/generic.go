@@ -1,32 +1,242 @@
 package pubsub
 
 import (
+	"context"
 	"sync"
+	"time"
+
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/metrics"
+)
+
+// Policy is what Publish does when the buffer of a subscriber is full.
+type Policy int
+
+const (
+	// Block waits until the subscriber reads the message.
+	Block Policy = iota
+	// DropOldest discards the oldest message of the buffer to make room for
+	// the new one.
+	DropOldest
+	// DropNewest discards the new message.
+	DropNewest
 )
 
+type subscribeOptions struct {
+	buffer int
+}
+
+type SubscribeOption func(*subscribeOptions)
+
+// WithBuffer sets the size of the channel of the subscription. Subscriptions
+// to topics that drop messages have a buffer of at least one message.
+func WithBuffer(size int) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.buffer = size
+	}
+}
+
+type subscription[T any] struct {
+	ch     chan T
+	done   chan struct{}
+	closed bool
+	mu     sync.Mutex
+}
+
+type topicPolicy struct {
+	policy Policy
+	buffer int
+}
+
 type PubSub[T any] struct {
-	mu   sync.Mutex
-	subs map[string][]chan T
+	mu     sync.Mutex
+	subs   map[string][]*subscription[T]
+	topics map[string]topicPolicy
+	policy Policy
+	buffer int
 }
 
+// NewPubSub creates a PubSub whose subscribers are unbuffered and block the
+// publisher.
 func NewPubSub[T any]() *PubSub[T] {
+	return NewPubSubWithPolicy[T](Block, 0)
+}
+
+// NewPubSubWithPolicy creates a PubSub with the policy and default buffer size
+// of its subscriptions.
+func NewPubSubWithPolicy[T any](policy Policy, buffer int) *PubSub[T] {
 	return &PubSub[T]{
-		subs: make(map[string][]chan T),
+		subs:   make(map[string][]*subscription[T]),
+		topics: make(map[string]topicPolicy),
+		policy: policy,
+		buffer: buffer,
+	}
+}
+
+// SetTopicPolicy overrides the policy and default buffer size of the PubSub for
+// the topic. The buffer only applies to the subscriptions made afterwards.
+func (ps *PubSub[T]) SetTopicPolicy(topic string, policy Policy, buffer int) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.topics[topic] = topicPolicy{policy: policy, buffer: buffer}
+}
+
+// topicPolicy returns the policy of the topic or the one of the PubSub. It must
+// be called with the mutex locked.
+func (ps *PubSub[T]) topicPolicy(topic string) topicPolicy {
+	if tp, found := ps.topics[topic]; found {
+		return tp
 	}
+	return topicPolicy{policy: ps.policy, buffer: ps.buffer}
 }
 
-func (ps *PubSub[T]) Subscribe(topic string) <-chan T {
+// Subscribe returns a channel that receives the messages of the topic until
+// it is unsubscribed.
+func (ps *PubSub[T]) Subscribe(topic string, opts ...SubscribeOption) <-chan T {
 	ps.mu.Lock()
 	defer ps.mu.Unlock()
-	ch := make(chan T)
-	ps.subs[topic] = append(ps.subs[topic], ch)
+	tp := ps.topicPolicy(topic)
+	o := subscribeOptions{buffer: tp.buffer}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if tp.policy != Block && o.buffer < 1 {
+		o.buffer = 1
+	}
+	sub := &subscription[T]{
+		ch:   make(chan T, o.buffer),
+		done: make(chan struct{}),
+	}
+	ps.subs[topic] = append(ps.subs[topic], sub)
+	return sub.ch
+}
+
+// SubscribeWithCancel subscribes to the topic and returns the function that
+// unsubscribes it.
+func (ps *PubSub[T]) SubscribeWithCancel(topic string, opts ...SubscribeOption) (<-chan T, func()) {
+	ch := ps.Subscribe(topic, opts...)
+	return ch, func() {
+		ps.Unsubscribe(topic, ch)
+	}
+}
+
+// SubscribeContext subscribes to the topic until the context is done.
+func (ps *PubSub[T]) SubscribeContext(ctx context.Context, topic string, opts ...SubscribeOption) <-chan T {
+	ch, cancel := ps.SubscribeWithCancel(topic, opts...)
+	go func() {
+		<-ctx.Done()
+		cancel()
+	}()
 	return ch
 }
 
+// Unsubscribe stops sending messages to the channel and closes it. A publisher
+// blocked on the channel gives up.
+func (ps *PubSub[T]) Unsubscribe(topic string, ch <-chan T) {
+	ps.mu.Lock()
+	var sub *subscription[T]
+	subs := ps.subs[topic]
+	for i, s := range subs {
+		if s.ch == ch {
+			sub = s
+			ps.subs[topic] = append(subs[:i:i], subs[i+1:]...)
+			break
+		}
+	}
+	if len(ps.subs[topic]) == 0 {
+		delete(ps.subs, topic)
+	}
+	ps.mu.Unlock()
+
+	if sub == nil {
+		return
+	}
+	close(sub.done)
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	sub.closed = true
+	close(sub.ch)
+}
+
+// Publish sends the message to every subscriber of the topic following the
+// policy of the topic. The subscribers are not locked while the message is
+// sent, so they can unsubscribe meanwhile.
 func (ps *PubSub[T]) Publish(topic string, data T) {
+	start := time.Now()
+	defer func() {
+		metrics.PublishLatency.WithLabelValues(topic).Observe(time.Since(start).Seconds())
+	}()
+
 	ps.mu.Lock()
-	defer ps.mu.Unlock()
-	for _, ch := range ps.subs[topic] {
-		ch <- data
+	subs := append([]*subscription[T]{}, ps.subs[topic]...)
+	policy := ps.topicPolicy(topic).policy
+	ps.mu.Unlock()
+
+	for _, sub := range subs {
+		if !sub.send(data, policy) {
+			metrics.PubSubDropped.WithLabelValues(topic).Inc()
+		}
+	}
+}
+
+// Drain calls f with every message already buffered in the channel without
+// waiting for new ones. Topics that drop messages are buffered, so a subscriber
+// that also listens to an event topic drains them before handling the event to
+// see the data published before it.
+func Drain[T any](ch <-chan T, f func(T)) {
+	for {
+		select {
+		case data, ok := <-ch:
+			if !ok {
+				return
+			}
+			f(data)
+		default:
+			return
+		}
+	}
+}
+
+// send returns false when a message is dropped.
+func (sub *subscription[T]) send(data T, policy Policy) bool {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	if sub.closed {
+		return true
+	}
+	// subscriptions made before the topic started dropping messages may be
+	// unbuffered, so there is no old message to discard
+	if policy == DropOldest && cap(sub.ch) == 0 {
+		policy = DropNewest
+	}
+
+	switch policy {
+	case DropNewest:
+		select {
+		case sub.ch <- data:
+			return true
+		default:
+			return false
+		}
+	case DropOldest:
+		delivered := true
+		for {
+			select {
+			case sub.ch <- data:
+				return delivered
+			default:
+			}
+			// the subscriber may read the oldest message meanwhile
+			select {
+			case <-sub.ch:
+				delivered = false
+			default:
+			}
+		}
+	default:
+		select {
+		case sub.ch <- data:
+		case <-sub.done:
+		}
+		return true
 	}
 }
@@ -0,0 +1,225 @@
+package pubsub
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPublishPolicies(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   Policy
+		buffer   int
+		messages []int
+		want     []int
+	}{
+		{
+			name:     "drop oldest keeps the last messages",
+			policy:   DropOldest,
+			buffer:   2,
+			messages: []int{1, 2, 3, 4},
+			want:     []int{3, 4},
+		},
+		{
+			name:     "drop newest keeps the first messages",
+			policy:   DropNewest,
+			buffer:   2,
+			messages: []int{1, 2, 3, 4},
+			want:     []int{1, 2},
+		},
+		{
+			name:     "drop policies buffer at least one message",
+			policy:   DropOldest,
+			buffer:   0,
+			messages: []int{1, 2},
+			want:     []int{2},
+		},
+		{
+			name:     "block keeps every message that fits",
+			policy:   Block,
+			buffer:   3,
+			messages: []int{1, 2, 3},
+			want:     []int{1, 2, 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ps := NewPubSubWithPolicy[int](tt.policy, tt.buffer)
+			ch := ps.Subscribe("topic")
+			for _, m := range tt.messages {
+				ps.Publish("topic", m)
+			}
+
+			got := []int{}
+			Drain(ch, func(m int) {
+				got = append(got, m)
+			})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetTopicPolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		topic    string
+		messages []int
+		want     []int
+	}{
+		{
+			name:     "the topic uses its own policy",
+			topic:    "live",
+			messages: []int{1, 2, 3},
+			want:     []int{2, 3},
+		},
+		{
+			name:     "other topics use the default policy",
+			topic:    "other",
+			messages: []int{1, 2, 3},
+			want:     []int{1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ps := NewPubSubWithPolicy[int](DropNewest, 1)
+			ps.SetTopicPolicy("live", DropOldest, 2)
+			ch := ps.Subscribe(tt.topic)
+			for _, m := range tt.messages {
+				ps.Publish(tt.topic, m)
+			}
+
+			got := []int{}
+			Drain(ch, func(m int) {
+				got = append(got, m)
+			})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithBuffer(t *testing.T) {
+	ps := NewPubSubWithPolicy[int](DropNewest, 5)
+	ch := ps.Subscribe("topic", WithBuffer(1))
+	if cap(ch) != 1 {
+		t.Errorf("got a buffer of %d, want 1", cap(ch))
+	}
+}
+
+func TestDrain(t *testing.T) {
+	tests := []struct {
+		name   string
+		buffer []int
+		close  bool
+		want   []int
+	}{
+		{
+			name: "empty channel",
+			want: []int{},
+		},
+		{
+			name:   "buffered messages",
+			buffer: []int{1, 2},
+			want:   []int{1, 2},
+		},
+		{
+			name:   "closed channel",
+			buffer: []int{1},
+			close:  true,
+			want:   []int{1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch := make(chan int, 2)
+			for _, m := range tt.buffer {
+				ch <- m
+			}
+			if tt.close {
+				close(ch)
+			}
+
+			got := []int{}
+			Drain(ch, func(m int) {
+				got = append(got, m)
+			})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnsubscribeReleasesBlockedPublisher(t *testing.T) {
+	ps := NewPubSub[int]()
+	ch := ps.Subscribe("topic")
+
+	published := make(chan struct{})
+	go func() {
+		defer close(published)
+		ps.Publish("topic", 1)
+	}()
+
+	// the publisher is blocked as nobody reads the channel
+	select {
+	case <-published:
+		t.Fatal("publish did not block")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	ps.Unsubscribe("topic", ch)
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		t.Fatal("publish is still blocked after unsubscribing")
+	}
+	if _, ok := <-ch; ok {
+		t.Error("the channel is not closed")
+	}
+}
+
+func TestSubscribeContext(t *testing.T) {
+	ps := NewPubSub[int]()
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := ps.SubscribeContext(ctx, "topic")
+	cancel()
+
+	select {
+	case _, ok := <-ch:
+		if ok {
+			t.Error("unexpected message")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the channel is not closed when the context is done")
+	}
+}
+
+func TestSetTopicPolicyAfterSubscribe(t *testing.T) {
+	ps := NewPubSub[int]()
+	ch := ps.Subscribe("topic")
+	ps.SetTopicPolicy("topic", DropOldest, 2)
+
+	// the unbuffered subscription can not drop old messages, so the new one
+	// is dropped instead of blocking the publisher
+	published := make(chan struct{})
+	go func() {
+		defer close(published)
+		ps.Publish("topic", 1)
+	}()
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		t.Fatal("publish blocked")
+	}
+	if cap(ch) != 0 {
+		t.Errorf("got a buffer of %d, want 0", cap(ch))
+	}
+}
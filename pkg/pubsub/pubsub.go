@@ -15,16 +15,28 @@ const (
 	PubSubSessionStoppedPreffix      = "sessionStopped_"
 	PubSubSelectedSessionDataPreffix = "selectedSessionData_"
 	PubSubCarsPositionPreffix        = "carsPosition_"
+	PubSubSessionFinishedPreffix     = "sessionFinished_"
+	PubSubServersChangedPreffix      = "serversChanged_"
 )
 
+// liveDataBuffer is the number of messages a slow subscriber of live data can
+// fall behind before the oldest ones are dropped.
+const liveDataBuffer = 32
+
 var (
-	LiveSessionInfoDataPubSub = NewPubSub[model.LiveSessionInfoData]()
-	LiveStandingDataPubSub    = NewPubSub[model.LiveStandingData]()
-	LiveStandingHistoryPubSub = NewPubSub[model.LiveStandingHistoryData]()
+	// live data is sent several times per second, so a stuck subscriber only
+	// misses old data instead of stopping the server
+	LiveSessionInfoDataPubSub = NewPubSubWithPolicy[model.LiveSessionInfoData](DropOldest, liveDataBuffer)
+	LiveStandingDataPubSub    = NewPubSubWithPolicy[model.LiveStandingData](DropOldest, liveDataBuffer)
+	LiveStandingHistoryPubSub = NewPubSubWithPolicy[model.LiveStandingHistoryData](DropOldest, liveDataBuffer)
+	CarsPositionPubSub        = NewPubSubWithPolicy[[]model.CarPosition](DropOldest, liveDataBuffer)
+
+	// events are never dropped
 	TrackThumbnailPubSub      = NewPubSub[resources.Resource]()
 	SessionStartedPubSub      = NewPubSub[model.ServerStarted]()
 	SessionStoppedPubSub      = NewPubSub[string]()
 	FirstDriverEnteredPubSub  = NewPubSub[model.ServerStarted]()
 	SelectedSessionDataPubSub = NewPubSub[model.SelectedSessionData]()
-	CarsPositionPubSub        = NewPubSub[[]model.CarPosition]()
+	SessionFinishedPubSub     = NewPubSub[model.SessionFinished]()
+	ServersChangedPubSub      = NewPubSub[[]model.ServerDefinition]()
 )
@@ -13,6 +13,10 @@ import (
 
 const (
 	ResourcesDir = "./resources"
+	// track maps built before the markers were drawn used the track_ prefix
+	// and the ones with sectors of equal length the trackmap_ prefix. They are
+	// not reused
+	trackPrefix = "tracklayout_"
 )
 
 func init() {
@@ -40,7 +44,7 @@ func BuildTrackThumbnail(ctx context.Context, url, id string) (Resource, error)
 		endpoint:  "rest/race/track/%s/trackmap",
 		serverUrl: url,
 		builder:   pngBuilderForTrack,
-		prefix:    "track_",
+		prefix:    trackPrefix,
 		suffix:    ".png",
 		_type:     "track",
 	}
@@ -53,7 +57,7 @@ func BuildTrackSvg(ctx context.Context, url, id string) (Resource, error) {
 		endpoint:  "rest/race/track/%s/trackmap",
 		serverUrl: url,
 		builder:   svgBuilderForTrack,
-		prefix:    "track_",
+		prefix:    trackPrefix,
 		suffix:    ".svg",
 		_type:     "svg-track",
 	}
@@ -61,6 +65,31 @@ func BuildTrackSvg(ctx context.Context, url, id string) (Resource, error) {
 	return r.build(ctx, id)
 }
 
+// TrackLayout returns the waypoints of the track. They are stored the first
+// time they are fetched.
+func TrackLayout(ctx context.Context, url, id string) (layout.AIW, error) {
+	r := Resource{
+		endpoint:  "rest/race/track/%s/trackmap",
+		serverUrl: url,
+		builder:   jsonBuilderForTrack,
+		prefix:    trackPrefix,
+		suffix:    ".json",
+		_type:     "json-track",
+	}
+
+	resource, err := r.build(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(resource.FilePath())
+	if err != nil {
+		return nil, err
+	}
+	var layoutData layout.AIW
+	err = json.Unmarshal(b, &layoutData)
+	return layoutData, err
+}
+
 func BuildSmallCarThumbnail(ctx context.Context, url, id string) (Resource, error) {
 	r := Resource{
 		endpoint:  "rest/race/car/%s/image?type=IMAGE_SMALL",
@@ -91,6 +120,10 @@ func (r Resource) buildFilePath(id string) string {
 	return fmt.Sprintf("%s/%s%s%s", ResourcesDir, r.prefix, id, r.suffix)
 }
 
+func (r Resource) ID() string {
+	return r.id
+}
+
 func (r Resource) IsZero() bool {
 	return r.id == ""
 }
@@ -188,6 +221,34 @@ func svgBuilderForTrack(ctx context.Context, url, filePath string) error {
 	return nil
 }
 
+func jsonBuilderForTrack(ctx context.Context, url, filePath string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	response, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("error getting track layout: %s (%s)", response.Status, url)
+	}
+
+	// the waypoints are checked before they are stored
+	var layoutData layout.AIW
+	err = json.NewDecoder(response.Body).Decode(&layoutData)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(layoutData)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filePath, b, 0644)
+}
+
 // create a pngBuilder from a http call
 func pngBuilderForCar(ctx context.Context, url, filePath string) error {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
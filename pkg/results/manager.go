@@ -0,0 +1,319 @@
+package results
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/model"
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/pubsub"
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/settings"
+
+	_ "modernc.org/sqlite"
+)
+
+// MaxSessionsPerServer is the number of finished sessions kept for every
+// server. Older sessions are deleted when a new one is stored.
+const MaxSessionsPerServer = 50
+
+// Server is a server with stored sessions.
+type Server struct {
+	ID   string
+	Name string
+}
+
+// Session identifies a finished session stored in the database.
+type Session struct {
+	ID          int64
+	ServerID    string
+	ServerName  string
+	TrackName   string
+	SessionType string
+	FinishedAt  time.Time
+}
+
+// SessionResult is a finished session along with the last standing and
+// standing history snapshots received before it was stopped.
+type SessionResult struct {
+	Session
+	Standing model.LiveStandingData
+	History  model.LiveStandingHistoryData
+}
+
+type Manager struct {
+	db        *sql.DB
+	recording map[string]bool
+	mu        sync.Mutex
+}
+
+// NewManager opens the bot database (shared with the settings manager) and
+// creates the results tables if they do not exist yet.
+func NewManager() (*Manager, error) {
+	return openManager(settings.DbName)
+}
+
+func openManager(dbName string) (*Manager, error) {
+	// wait for locks as the settings manager uses the same database file
+	db, err := sql.Open("sqlite", dbName+"?_pragma=busy_timeout(5000)")
+	if err != nil {
+		log.Printf("error opening database: %s\n", err)
+		return nil, err
+	}
+
+	for _, stmt := range []string{buildCreateSessionsTable(), buildCreateSessionResultsTable(), buildCreateSessionLapsTable()} {
+		_, err = db.Exec(stmt)
+		if err != nil {
+			log.Printf("error init database: %s\n", err)
+			return nil, err
+		}
+	}
+
+	return &Manager{
+		db:        db,
+		recording: map[string]bool{},
+		mu:        sync.Mutex{},
+	}, nil
+}
+
+func (m *Manager) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.db.Close()
+}
+
+// Record keeps the last data received for the server and stores it as a
+// finished session every time the server signals the session was stopped.
+// Servers already being recorded are ignored.
+func (m *Manager) Record(ctx context.Context, serverID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.recording[serverID] {
+		return
+	}
+	m.recording[serverID] = true
+
+	sessionInfoChan := pubsub.LiveSessionInfoDataPubSub.Subscribe(pubsub.PubSubSessionInfoPreffix + serverID)
+	standingChan := pubsub.LiveStandingDataPubSub.Subscribe(pubsub.PubSubDriversSessionPreffix + serverID)
+	historyChan := pubsub.LiveStandingHistoryPubSub.Subscribe(pubsub.PubSubStintDataPreffix + serverID)
+	stoppedChan := pubsub.SessionStoppedPubSub.Subscribe(pubsub.PubSubSessionStoppedPreffix)
+
+	go m.recorder(ctx, serverID, sessionInfoChan, standingChan, historyChan, stoppedChan)
+}
+
+func (m *Manager) recorder(ctx context.Context, serverID string,
+	sessionInfoChan <-chan model.LiveSessionInfoData,
+	standingChan <-chan model.LiveStandingData,
+	historyChan <-chan model.LiveStandingHistoryData,
+	stoppedChan <-chan string) {
+	var sessionInfo model.LiveSessionInfoData
+	var standing model.LiveStandingData
+	var history model.LiveStandingHistoryData
+	// the server publishes empty data when it is reset, so only the non-empty
+	// snapshots are kept
+	keepSessionInfo := func(lsid model.LiveSessionInfoData) {
+		if lsid.SessionInfo.Session != "" {
+			sessionInfo = lsid
+		}
+	}
+	keepStanding := func(lsd model.LiveStandingData) {
+		if len(lsd.Drivers) > 0 {
+			standing = lsd
+		}
+	}
+	keepHistory := func(lshd model.LiveStandingHistoryData) {
+		if len(lshd.DriverNames) > 0 {
+			history = lshd
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case lsid := <-sessionInfoChan:
+			keepSessionInfo(lsid)
+		case lsd := <-standingChan:
+			keepStanding(lsd)
+		case lshd := <-historyChan:
+			keepHistory(lshd)
+		case id := <-stoppedChan:
+			if id != serverID {
+				continue
+			}
+			// the live data is buffered and the stop event is not, so the
+			// last snapshots may still be waiting in the channels
+			pubsub.Drain(sessionInfoChan, keepSessionInfo)
+			pubsub.Drain(standingChan, keepStanding)
+			pubsub.Drain(historyChan, keepHistory)
+			if len(standing.Drivers) == 0 {
+				continue
+			}
+			sr := SessionResult{
+				Session: Session{
+					ServerID:    serverID,
+					ServerName:  standing.ServerName,
+					TrackName:   sessionInfo.SessionInfo.TrackName,
+					SessionType: sessionInfo.SessionInfo.Session,
+					FinishedAt:  time.Now(),
+				},
+				Standing: standing,
+				History:  history,
+			}
+			// do not block the publisher of the stop event while the session
+			// is stored
+			go m.saveSession(sr)
+			sessionInfo = model.LiveSessionInfoData{}
+			standing = model.LiveStandingData{}
+			history = model.LiveStandingHistoryData{}
+		}
+	}
+}
+
+func (m *Manager) saveSession(sr SessionResult) {
+	sessionID, err := m.SaveSession(sr)
+	if err != nil {
+		log.Printf("Error saving results for server %s: %s\n", sr.ServerID, err.Error())
+		return
+	}
+	log.Printf("Results saved for server %s. Session: %s (%d)\n", sr.ServerID, sr.SessionType, sessionID)
+}
+
+// SaveSession stores the final classification and every lap of the session
+// and returns the ID of the new session.
+func (m *Manager) SaveSession(sr SessionResult) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tx, err := m.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	res, err := tx.Exec(buildInsertSessionCommand(), sr.ServerID, sr.ServerName, sr.TrackName, sr.SessionType, sr.FinishedAt.Unix())
+	if err != nil {
+		return 0, err
+	}
+	sessionID, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, d := range sr.Standing.Drivers {
+		data, err := json.Marshal(d)
+		if err != nil {
+			return 0, err
+		}
+		_, err = tx.Exec(buildInsertSessionResultCommand(), sessionID, d.Position, d.DriverName, d.VehicleName, d.CarClass, d.CarNumber,
+			d.LapsCompleted, d.BestLapTime, d.Pitstops, d.FinishStatus, d.TimeBehindLeader, d.LapsBehindLeader, string(data))
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	for _, driverName := range sr.History.DriverNames {
+		for idx, l := range sr.History.DriversData[driverName] {
+			_, err = tx.Exec(buildInsertSessionLapCommand(), sessionID, driverName, idx+1, l.Position, l.SlotID, l.LapTime, l.SectorTime1, l.SectorTime2,
+				l.TotalLaps, l.VehicleName, l.FinishStatus, boolToInt(l.Pitting), l.CarClass, l.TopSpeed, l.CarId)
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	for _, stmt := range buildDeleteOldSessionsCommands() {
+		_, err = tx.Exec(stmt, sr.ServerID, MaxSessionsPerServer)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return sessionID, tx.Commit()
+}
+
+// ListServers returns the servers with at least one stored session.
+func (m *Manager) ListServers() ([]Server, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	query, read := buildSelectServersCommand()
+	rows, err := m.db.Query(query)
+	if err != nil {
+		return []Server{}, err
+	}
+	return read(rows)
+}
+
+// ListSessions returns a page of the stored sessions for the server (newest
+// first) along with the total number of stored sessions for it.
+func (m *Manager) ListSessions(serverID string, offset, limit int) ([]Session, int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	total := 0
+	err := m.db.QueryRow(buildCountSessionsCommand(), serverID).Scan(&total)
+	if err != nil {
+		return []Session{}, total, err
+	}
+
+	query, read := buildSelectSessionsCommand()
+	rows, err := m.db.Query(query, serverID, limit, offset)
+	if err != nil {
+		return []Session{}, total, err
+	}
+	sessions, err := read(rows)
+	return sessions, total, err
+}
+
+// GetSession reads a stored session and rebuilds its standing and standing
+// history snapshots.
+func (m *Manager) GetSession(sessionID int64) (SessionResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sr := SessionResult{}
+	query, readSession := buildSelectSessionCommand()
+	session, err := readSession(m.db.QueryRow(query, sessionID))
+	if err != nil {
+		return sr, err
+	}
+	sr.Session = session
+
+	query, readResults := buildSelectSessionResultsCommand()
+	rows, err := m.db.Query(query, sessionID)
+	if err != nil {
+		return sr, err
+	}
+	drivers, err := readResults(rows)
+	if err != nil {
+		return sr, err
+	}
+
+	query, readLaps := buildSelectSessionLapsCommand()
+	rows, err = m.db.Query(query, sessionID)
+	if err != nil {
+		return sr, err
+	}
+	driverNames, driversData, err := readLaps(rows)
+	if err != nil {
+		return sr, err
+	}
+
+	sr.Standing = model.LiveStandingData{
+		ServerName: session.ServerName,
+		ServerID:   session.ServerID,
+		Drivers:    drivers,
+	}
+	sr.History = model.LiveStandingHistoryData{
+		ServerName:  session.ServerName,
+		ServerID:    session.ServerID,
+		DriverNames: driverNames,
+		DriversData: driversData,
+	}
+	return sr, nil
+}
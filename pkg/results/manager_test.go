@@ -0,0 +1,111 @@
+package results
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/model"
+)
+
+func TestSaveSessionPrunesOldSessions(t *testing.T) {
+	tests := []struct {
+		name      string
+		saved     int
+		wantKept  int
+		wantFirst bool
+	}{
+		{"below the limit", 3, 3, true},
+		{"at the limit", MaxSessionsPerServer, MaxSessionsPerServer, true},
+		{"over the limit", MaxSessionsPerServer + 2, MaxSessionsPerServer, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := openManager(filepath.Join(t.TempDir(), "test.db"))
+			if err != nil {
+				t.Fatalf("error opening the database: %s", err)
+			}
+			defer m.Close()
+
+			// the sessions of other servers are never pruned
+			_, err = m.SaveSession(testSession("server2", time.Now()))
+			if err != nil {
+				t.Fatalf("error saving the session: %s", err)
+			}
+
+			ids := []int64{}
+			for i := 0; i < tt.saved; i++ {
+				id, err := m.SaveSession(testSession("server1", time.Now().Add(time.Duration(i)*time.Minute)))
+				if err != nil {
+					t.Fatalf("error saving the session: %s", err)
+				}
+				ids = append(ids, id)
+			}
+
+			_, total, err := m.ListSessions("server1", 0, 1)
+			if err != nil {
+				t.Fatalf("error listing the sessions: %s", err)
+			}
+			if total != tt.wantKept {
+				t.Errorf("got %d sessions, want %d", total, tt.wantKept)
+			}
+			_, total, err = m.ListSessions("server2", 0, 1)
+			if err != nil {
+				t.Fatalf("error listing the sessions: %s", err)
+			}
+			if total != 1 {
+				t.Errorf("got %d sessions of the other server, want 1", total)
+			}
+
+			// the laps and results of the pruned sessions are deleted too
+			for _, table := range []string{"session_laps", "session_results"} {
+				rows := 0
+				err = m.db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&rows)
+				if err != nil {
+					t.Fatalf("error counting the rows of %s: %s", table, err)
+				}
+				if rows != tt.wantKept+1 {
+					t.Errorf("got %d rows in %s, want %d", rows, table, tt.wantKept+1)
+				}
+			}
+
+			sr, err := m.GetSession(ids[0])
+			if (err == nil) != tt.wantFirst {
+				t.Errorf("got error %v reading the first session, want it kept %t", err, tt.wantFirst)
+			}
+			if tt.wantFirst && len(sr.History.DriversData["Driver"]) != 1 {
+				t.Errorf("got laps %v, want the stored lap", sr.History.DriversData)
+			}
+
+			last, err := m.GetSession(ids[len(ids)-1])
+			if err != nil {
+				t.Fatalf("error reading the last session: %s", err)
+			}
+			if len(last.Standing.Drivers) != 1 {
+				t.Errorf("got drivers %v, want the stored driver", last.Standing.Drivers)
+			}
+		})
+	}
+}
+
+func testSession(serverID string, finishedAt time.Time) SessionResult {
+	return SessionResult{
+		Session: Session{
+			ServerID:    serverID,
+			ServerName:  serverID,
+			TrackName:   "Track",
+			SessionType: "RACE1",
+			FinishedAt:  finishedAt,
+		},
+		Standing: model.LiveStandingData{
+			Drivers: []model.StandingDriverData{{DriverName: "Driver", Position: 1}},
+		},
+		History: model.LiveStandingHistoryData{
+			DriverNames: []string{"Driver"},
+			DriversData: map[string][]model.StandingHistoryDriverData{
+				"Driver": {{Position: 1, LapTime: 90}},
+			},
+		},
+	}
+}
@@ -0,0 +1,199 @@
+package results
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/model"
+)
+
+func buildCreateSessionsTable() string {
+	return `CREATE TABLE IF NOT EXISTS sessions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		serverid TEXT NOT NULL,
+		servername TEXT NOT NULL,
+		track TEXT NOT NULL,
+		session TEXT NOT NULL,
+		finishedat INTEGER NOT NULL);`
+}
+
+func buildCreateSessionResultsTable() string {
+	return `CREATE TABLE IF NOT EXISTS session_results (
+		sessionid INTEGER NOT NULL,
+		position INTEGER NOT NULL,
+		drivername TEXT NOT NULL,
+		vehiclename TEXT NOT NULL,
+		carclass TEXT NOT NULL,
+		carnumber TEXT NOT NULL,
+		lapscompleted INTEGER NOT NULL,
+		bestlaptime REAL NOT NULL,
+		pitstops INTEGER NOT NULL,
+		finishstatus TEXT NOT NULL,
+		timebehindleader REAL NOT NULL,
+		lapsbehindleader REAL NOT NULL,
+		data TEXT NOT NULL);`
+}
+
+func buildCreateSessionLapsTable() string {
+	return `CREATE TABLE IF NOT EXISTS session_laps (
+		sessionid INTEGER NOT NULL,
+		drivername TEXT NOT NULL,
+		lap INTEGER NOT NULL,
+		position INTEGER NOT NULL,
+		slotid INTEGER NOT NULL,
+		laptime REAL NOT NULL,
+		sectortime1 REAL NOT NULL,
+		sectortime2 REAL NOT NULL,
+		totallaps REAL NOT NULL,
+		vehiclename TEXT NOT NULL,
+		finishstatus TEXT NOT NULL,
+		pitting INTEGER NOT NULL,
+		carclass TEXT NOT NULL,
+		topspeed REAL NOT NULL,
+		carid TEXT NOT NULL);`
+}
+
+func buildInsertSessionCommand() string {
+	return `INSERT INTO sessions (serverid, servername, track, session, finishedat) VALUES (?, ?, ?, ?, ?)`
+}
+
+func buildInsertSessionResultCommand() string {
+	fields := "sessionid, position, drivername, vehiclename, carclass, carnumber, lapscompleted, bestlaptime, pitstops, finishstatus, timebehindleader, lapsbehindleader, data"
+	return `INSERT INTO session_results (` + fields + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+}
+
+func buildInsertSessionLapCommand() string {
+	fields := "sessionid, drivername, lap, position, slotid, laptime, sectortime1, sectortime2, totallaps, vehiclename, finishstatus, pitting, carclass, topspeed, carid"
+	return `INSERT INTO session_laps (` + fields + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+}
+
+func buildSelectSessionCommand() (string, func(*sql.Row) (Session, error)) {
+	fields := "id, serverid, servername, track, session, finishedat"
+	return `SELECT ` + fields + ` FROM sessions WHERE id = ?`, processSelectSessionRow
+}
+
+func processSelectSessionRow(row *sql.Row) (Session, error) {
+	var s Session
+	var finishedAt int64
+	err := row.Scan(&s.ID, &s.ServerID, &s.ServerName, &s.TrackName, &s.SessionType, &finishedAt)
+	if err != nil {
+		return s, err
+	}
+	s.FinishedAt = time.Unix(finishedAt, 0)
+	return s, nil
+}
+
+func buildCountSessionsCommand() string {
+	return `SELECT COUNT(*) FROM sessions WHERE serverid = ?`
+}
+
+func buildSelectSessionsCommand() (string, func(*sql.Rows) ([]Session, error)) {
+	fields := "id, serverid, servername, track, session, finishedat"
+	return `SELECT ` + fields + ` FROM sessions WHERE serverid = ? ORDER BY id DESC LIMIT ? OFFSET ?`, processSelectSessionsRows
+}
+
+func processSelectSessionsRows(rows *sql.Rows) ([]Session, error) {
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		var s Session
+		var finishedAt int64
+		err := rows.Scan(&s.ID, &s.ServerID, &s.ServerName, &s.TrackName, &s.SessionType, &finishedAt)
+		if err != nil {
+			return sessions, err
+		}
+		s.FinishedAt = time.Unix(finishedAt, 0)
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+func buildSelectServersCommand() (string, func(*sql.Rows) ([]Server, error)) {
+	// the name of the server is taken from its latest session
+	return `SELECT serverid, servername FROM sessions WHERE id IN (SELECT MAX(id) FROM sessions GROUP BY serverid) ORDER BY serverid`, processSelectServersRows
+}
+
+func processSelectServersRows(rows *sql.Rows) ([]Server, error) {
+	defer rows.Close()
+
+	servers := []Server{}
+	for rows.Next() {
+		var s Server
+		err := rows.Scan(&s.ID, &s.Name)
+		if err != nil {
+			return servers, err
+		}
+		servers = append(servers, s)
+	}
+	return servers, rows.Err()
+}
+
+func buildDeleteOldSessionsCommands() []string {
+	oldSessions := `SELECT id FROM sessions WHERE serverid = ? ORDER BY id DESC LIMIT -1 OFFSET ?`
+	return []string{
+		`DELETE FROM session_laps WHERE sessionid IN (` + oldSessions + `)`,
+		`DELETE FROM session_results WHERE sessionid IN (` + oldSessions + `)`,
+		`DELETE FROM sessions WHERE id IN (` + oldSessions + `)`,
+	}
+}
+
+func buildSelectSessionResultsCommand() (string, func(*sql.Rows) ([]model.StandingDriverData, error)) {
+	return `SELECT data FROM session_results WHERE sessionid = ? ORDER BY position`, processSelectSessionResultsRows
+}
+
+func processSelectSessionResultsRows(rows *sql.Rows) ([]model.StandingDriverData, error) {
+	defer rows.Close()
+
+	drivers := []model.StandingDriverData{}
+	for rows.Next() {
+		var data string
+		err := rows.Scan(&data)
+		if err != nil {
+			return drivers, err
+		}
+		var driver model.StandingDriverData
+		err = json.Unmarshal([]byte(data), &driver)
+		if err != nil {
+			return drivers, err
+		}
+		drivers = append(drivers, driver)
+	}
+	return drivers, rows.Err()
+}
+
+func buildSelectSessionLapsCommand() (string, func(*sql.Rows) ([]string, map[string][]model.StandingHistoryDriverData, error)) {
+	fields := "drivername, position, slotid, laptime, sectortime1, sectortime2, totallaps, vehiclename, finishstatus, pitting, carclass, topspeed, carid"
+	// laps are inserted in standing order, so rowid keeps the driver names sorted
+	return `SELECT ` + fields + ` FROM session_laps WHERE sessionid = ? ORDER BY rowid`, processSelectSessionLapsRows
+}
+
+func processSelectSessionLapsRows(rows *sql.Rows) ([]string, map[string][]model.StandingHistoryDriverData, error) {
+	defer rows.Close()
+
+	driverNames := []string{}
+	driversData := map[string][]model.StandingHistoryDriverData{}
+	for rows.Next() {
+		var lap model.StandingHistoryDriverData
+		var pitting int
+		err := rows.Scan(&lap.DriverName, &lap.Position, &lap.SlotID, &lap.LapTime, &lap.SectorTime1, &lap.SectorTime2, &lap.TotalLaps,
+			&lap.VehicleName, &lap.FinishStatus, &pitting, &lap.CarClass, &lap.TopSpeed, &lap.CarId)
+		if err != nil {
+			return driverNames, driversData, err
+		}
+		lap.Pitting = pitting == 1
+		if _, found := driversData[lap.DriverName]; !found {
+			driverNames = append(driverNames, lap.DriverName)
+		}
+		driversData[lap.DriverName] = append(driversData[lap.DriverName], lap)
+	}
+	return driverNames, driversData, rows.Err()
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
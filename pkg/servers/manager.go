@@ -2,11 +2,15 @@ package servers
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"log"
+	"maps"
 	"sync"
 	"time"
 
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/config"
 	"github.com/oscar-martin/rfactor2telegrambot/pkg/livemap"
 	"github.com/oscar-martin/rfactor2telegrambot/pkg/model"
 	"github.com/oscar-martin/rfactor2telegrambot/pkg/pubsub"
@@ -17,26 +21,39 @@ import (
 	"github.com/nicksnyder/go-i18n/v2/i18n"
 )
 
+const liveMapTokenBytes = 16
+
 var (
 	ButtonLive = "Live"
 )
 
 type Manager struct {
 	ctx     context.Context
-	servers []Server
-	bot     *tgbotapi.BotAPI
-	loc     *i18n.Localizer
+	servers []*Server
+	// every server ever configured, so a removed server that is added again
+	// reuses its channels, goroutines and livemap
+	known        map[string]*Server
+	ws           *webserver.Manager
+	liveMapCount int
+	bot          *tgbotapi.BotAPI
+	loc          *i18n.Localizer
+	mu           sync.Mutex
 }
 
 func NewManager(ctx context.Context, bot *tgbotapi.BotAPI, servers []Server, ws *webserver.Manager, loc *i18n.Localizer) (*Manager, error) {
 	m := &Manager{
-		ctx:     ctx,
-		bot:     bot,
-		servers: servers,
-		loc:     loc,
+		ctx:   ctx,
+		bot:   bot,
+		known: map[string]*Server{},
+		ws:    ws,
+		loc:   loc,
+	}
+
+	for i := range servers {
+		m.servers = append(m.servers, &servers[i])
 	}
 
-	err := m.initializeServers(ws)
+	err := m.initializeServers()
 	return m, err
 }
 
@@ -56,106 +73,244 @@ func (sm *Manager) doSync(t time.Time) {
 	sm.checkServersOnline()
 }
 
-func (sm *Manager) initializeServers(ws *webserver.Manager) error {
-	// set up the goroutine to publish live data
-	for i := range sm.servers {
-		sm.servers[i].Name = sm.servers[i].ID
-		sm.servers[i].BestSectorsForDriver = make(map[string]Sectors)
-		sm.servers[i].BestLapForDriver = make(map[string]int)
-		sm.servers[i].TopSpeedForDriver = make(map[string]map[int]float64)
-		sm.servers[i].LiveSessionInfoDataChan = make(chan model.LiveSessionInfoData)
-		sm.servers[i].LiveStandingChan = make(chan model.LiveStandingData)
-		sm.servers[i].LiveStandingHistoryChan = make(chan model.LiveStandingHistoryData)
-		sm.servers[i].ThumbnailChan = make(chan resources.Resource)
-		sm.servers[i].ServerStartedChan = make(chan model.ServerStarted)
-		sm.servers[i].ServerStoppedChan = make(chan string)
-		sm.servers[i].FirstDriverEnteredChan = make(chan model.ServerStarted)
-		sm.servers[i].SelectedSessionDataChan = make(chan model.SelectedSessionData)
-		sm.servers[i].CarsPositionChan = make(chan []model.CarPosition)
-		sm.servers[i].LiveMapPath = fmt.Sprintf("/servers/%d", i)
-		sm.servers[i].LiveMap = livemap.NewLiveMap(ws.GetRouter(sm.servers[i].ID, sm.servers[i].LiveMapPath), sm.servers[i].ID, sm.servers[i].LiveMapPath, sm.loc)
-
-		go func(idx int) {
-			for liveSessionInfo := range sm.servers[idx].LiveSessionInfoDataChan {
-				pubsub.LiveSessionInfoDataPubSub.Publish(pubsub.PubSubSessionInfoPreffix+sm.servers[idx].ID, liveSessionInfo)
-			}
-		}(i)
+// Servers returns a copy of the configured servers.
+func (sm *Manager) Servers() []Server {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
 
-		go func(idx int) {
-			for liveTiming := range sm.servers[idx].LiveStandingChan {
-				pubsub.LiveStandingDataPubSub.Publish(pubsub.PubSubDriversSessionPreffix+sm.servers[idx].ID, liveTiming)
-			}
-		}(i)
+	ss := []Server{}
+	for _, s := range sm.servers {
+		ss = append(ss, *s)
+	}
+	return ss
+}
 
-		go func(idx int) {
-			for liveStanding := range sm.servers[idx].LiveStandingHistoryChan {
-				pubsub.LiveStandingHistoryPubSub.Publish(pubsub.PubSubStintDataPreffix+sm.servers[idx].ID, liveStanding)
+// Apply updates the servers to match the config. New servers are created,
+// removed servers are disconnected and servers whose config changed are
+// stopped, updated and reconnected.
+// The connections of the rest of servers are kept.
+func (sm *Manager) Apply(scs []config.ServerConfig, domain, recordDir string) {
+	sm.mu.Lock()
+	servers := []*Server{}
+	active := map[string]bool{}
+	for _, sc := range scs {
+		active[sc.ID] = true
+		s, found := sm.known[sc.ID]
+		if !found {
+			ns := NewServerFromConfig(sc, domain, recordDir)
+			s = &ns
+			sm.initializeServer(s)
+			log.Printf("Server %s added\n", s.ID)
+		} else {
+			reconnect := s.URL != sc.URL || s.LiveMapDomain != domain || !sm.isActive(s.ID) ||
+				s.RecordDir != recordDir || s.ReplayFile != sc.Replay || s.ReplaySpeed != sc.ReplaySpeed
+			changed := reconnect || s.DisplayName != sc.Name || s.DataTimeout != sc.DataTimeout.Duration ||
+				s.LiveMapEnabled != sc.LiveMapEnabled() || !maps.Equal(s.ClassColors, sc.ClassColors) ||
+				s.MembersOnly != sc.MembersOnly()
+			if changed {
+				// the goroutines of the server read its fields, so they are
+				// stopped before changing them
+				s.stop()
+				s.URL = sc.URL
+				s.RecordDir = recordDir
+				s.ReplayFile = sc.Replay
+				s.ReplaySpeed = sc.ReplaySpeed
+				s.LiveMapDomain = domain
+				s.DisplayName = sc.Name
+				s.DataTimeout = sc.DataTimeout.Duration
+				s.LiveMapEnabled = sc.LiveMapEnabled()
+				s.ClassColors = sc.ClassColors
+				s.MembersOnly = sc.MembersOnly()
+				sm.initializeLiveMap(s)
+				if s.LiveMap != nil {
+					s.LiveMap.SetClassColors(s.ClassColors)
+				}
+				s.Name = s.ID
+				if s.DisplayName != "" {
+					s.Name = s.DisplayName
+				}
+				s.start(sm.ctx)
+				log.Printf("Server %s updated\n", s.ID)
 			}
-		}(i)
+		}
+		servers = append(servers, s)
+	}
+	for _, s := range sm.servers {
+		if !active[s.ID] {
+			s.stop()
+			log.Printf("Server %s removed\n", s.ID)
+		}
+	}
+	sm.servers = servers
+	sm.mu.Unlock()
 
-		go func(idx int) {
-			for thumbnail := range sm.servers[idx].ThumbnailChan {
-				pubsub.TrackThumbnailPubSub.Publish(pubsub.PubSubThumbnailPreffix+sm.servers[idx].ID, thumbnail)
-			}
-		}(i)
+	pubsub.ServersChangedPubSub.Publish(pubsub.PubSubServersChangedPreffix, sm.Definitions())
+	sm.checkServersOnline()
+}
 
-		go func(idx int) {
-			for serverStarted := range sm.servers[idx].ServerStartedChan {
-				pubsub.SessionStartedPubSub.Publish(pubsub.PubSubSessionStartedPreffix, serverStarted)
-			}
-		}(i)
+// Definitions returns the configured servers as published when they change.
+func (sm *Manager) Definitions() []model.ServerDefinition {
+	definitions := []model.ServerDefinition{}
+	for _, s := range sm.Servers() {
+		definitions = append(definitions, model.ServerDefinition{ID: s.ID, URL: s.URL, Name: s.Name, MembersOnly: s.MembersOnly})
+	}
+	return definitions
+}
 
-		go func(idx int) {
-			for serverStopped := range sm.servers[idx].ServerStoppedChan {
-				pubsub.SessionStoppedPubSub.Publish(pubsub.PubSubSessionStoppedPreffix, serverStopped)
-			}
-		}(i)
+func (sm *Manager) isActive(serverID string) bool {
+	for _, s := range sm.servers {
+		if s.ID == serverID {
+			return true
+		}
+	}
+	return false
+}
 
-		go func(idx int) {
-			for firstDriverEnteredInSession := range sm.servers[idx].FirstDriverEnteredChan {
-				pubsub.FirstDriverEnteredPubSub.Publish(pubsub.PubSubFirstDriverEnteredPreffix, firstDriverEnteredInSession)
-			}
-		}(i)
+func (sm *Manager) initializeServers() error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
 
-		go func(idx int) {
-			for selectedSessionData := range sm.servers[idx].SelectedSessionDataChan {
-				pubsub.SelectedSessionDataPubSub.Publish(pubsub.PubSubSelectedSessionDataPreffix+sm.servers[idx].ID, selectedSessionData)
-			}
-		}(i)
+	for _, s := range sm.servers {
+		sm.initializeServer(s)
+	}
+	return nil
+}
 
-		go func(idx int) {
-			for carsPosition := range sm.servers[idx].CarsPositionChan {
-				pubsub.CarsPositionPubSub.Publish(pubsub.PubSubCarsPositionPreffix+sm.servers[idx].ID, carsPosition)
-			}
-		}(i)
+func (sm *Manager) initializeServer(s *Server) {
+	s.Name = s.ID
+	if s.DisplayName != "" {
+		s.Name = s.DisplayName
+	}
+	s.BestSectorsForDriver = make(map[string]Sectors)
+	s.BestLapForDriver = make(map[string]int)
+	s.TopSpeedForDriver = make(map[string]map[int]float64)
+	s.LiveSessionInfoDataChan = make(chan model.LiveSessionInfoData)
+	s.LiveStandingChan = make(chan model.LiveStandingData)
+	s.LiveStandingHistoryChan = make(chan model.LiveStandingHistoryData)
+	s.ThumbnailChan = make(chan resources.Resource)
+	s.ServerStartedChan = make(chan model.ServerStarted)
+	s.ServerStoppedChan = make(chan string)
+	s.FirstDriverEnteredChan = make(chan model.ServerStarted)
+	s.SelectedSessionDataChan = make(chan model.SelectedSessionData)
+	s.CarsPositionChan = make(chan []model.CarPosition)
+	s.SessionFinishedChan = make(chan model.SessionFinished)
+	sm.initializeLiveMap(s)
+	s.start(sm.ctx)
+	sm.known[s.ID] = s
+
+	// set up the goroutine to publish live data
+	go func() {
+		for liveSessionInfo := range s.LiveSessionInfoDataChan {
+			pubsub.LiveSessionInfoDataPubSub.Publish(pubsub.PubSubSessionInfoPreffix+s.ID, liveSessionInfo)
+		}
+	}()
 
-		// run update goroutine
-		go func(idx int) {
-			sm.servers[idx].eventHandler()
-		}(i)
+	go func() {
+		for liveTiming := range s.LiveStandingChan {
+			pubsub.LiveStandingDataPubSub.Publish(pubsub.PubSubDriversSessionPreffix+s.ID, liveTiming)
+		}
+	}()
 
-	}
+	go func() {
+		for liveStanding := range s.LiveStandingHistoryChan {
+			pubsub.LiveStandingHistoryPubSub.Publish(pubsub.PubSubStintDataPreffix+s.ID, liveStanding)
+		}
+	}()
 
-	return nil
+	go func() {
+		for thumbnail := range s.ThumbnailChan {
+			pubsub.TrackThumbnailPubSub.Publish(pubsub.PubSubThumbnailPreffix+s.ID, thumbnail)
+		}
+	}()
+
+	go func() {
+		for serverStarted := range s.ServerStartedChan {
+			pubsub.SessionStartedPubSub.Publish(pubsub.PubSubSessionStartedPreffix, serverStarted)
+		}
+	}()
+
+	go func() {
+		for serverStopped := range s.ServerStoppedChan {
+			pubsub.SessionStoppedPubSub.Publish(pubsub.PubSubSessionStoppedPreffix, serverStopped)
+		}
+	}()
+
+	go func() {
+		for firstDriverEnteredInSession := range s.FirstDriverEnteredChan {
+			pubsub.FirstDriverEnteredPubSub.Publish(pubsub.PubSubFirstDriverEnteredPreffix, firstDriverEnteredInSession)
+		}
+	}()
+
+	go func() {
+		for selectedSessionData := range s.SelectedSessionDataChan {
+			pubsub.SelectedSessionDataPubSub.Publish(pubsub.PubSubSelectedSessionDataPreffix+s.ID, selectedSessionData)
+		}
+	}()
+
+	go func() {
+		for carsPosition := range s.CarsPositionChan {
+			pubsub.CarsPositionPubSub.Publish(pubsub.PubSubCarsPositionPreffix+s.ID, carsPosition)
+		}
+	}()
+
+	go func() {
+		for sessionFinished := range s.SessionFinishedChan {
+			pubsub.SessionFinishedPubSub.Publish(pubsub.PubSubSessionFinishedPreffix, sessionFinished)
+		}
+	}()
+}
+
+// initializeLiveMap serves the livemap of the server the first time it is
+// enabled. Disabling it only hides its link. The livemaps of the members only
+// servers get a random path so it can not be guessed from the ones of the
+// public servers, and the path changes with the visibility of the server, so
+// the links shared before stop working.
+func (sm *Manager) initializeLiveMap(s *Server) {
+	if s.LiveMap == nil && !s.LiveMapEnabled {
+		return
+	}
+	if s.LiveMap != nil && s.liveMapMembersOnly == s.MembersOnly {
+		return
+	}
+	path := fmt.Sprintf("%s/%d", webserver.ServersPath, sm.liveMapCount)
+	if s.MembersOnly {
+		token := make([]byte, liveMapTokenBytes)
+		_, err := rand.Read(token)
+		if err != nil {
+			log.Printf("Error creating the livemap path of server %s: %s\n", s.ID, err.Error())
+			return
+		}
+		path = fmt.Sprintf("%s/%s", webserver.ServersPath, hex.EncodeToString(token))
+	}
+	s.LiveMapPath = path
+	s.liveMapMembersOnly = s.MembersOnly
+	sm.liveMapCount++
+	r := webserver.NewRouter(s.LiveMapPath)
+	if s.LiveMap == nil {
+		s.LiveMap = livemap.NewLiveMap(r, s.ID, s.LiveMapPath, sm.loc)
+		s.LiveMap.SetClassColors(s.ClassColors)
+	} else {
+		s.LiveMap.Move(r, s.LiveMapPath)
+	}
+	// the router of the old path, if any, is replaced
+	sm.ws.SetRouter(s.ID, s.LiveMapPath, r)
 }
 
 func (sm *Manager) checkServersOnline() {
-	wg := sync.WaitGroup{}
-	for i := range sm.servers {
-		wg.Add(1)
-		go func(idx int) {
-			defer wg.Done()
-			if !sm.servers[idx].WebSocketRunning {
-				// set up the ws client
-				go func() {
-					// fmt.Printf("Starting websocket reader for server %s\n", sm.servers[idx].ID)
-					err := sm.servers[idx].WebSocketReader(sm.ctx)
-					if err != nil {
-						log.Printf("Error reading websocket: %s", err.Error())
-					}
-				}()
-			}
-		}(i)
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	for _, s := range sm.servers {
+		if !s.WebSocketRunning {
+			// set up the ws client
+			s, ctx := s, s.ctx
+			s.run(func() {
+				// fmt.Printf("Starting websocket reader for server %s\n", s.ID)
+				err := s.WebSocketReader(ctx)
+				if err != nil {
+					log.Printf("Error reading websocket: %s", err.Error())
+				}
+			})
+		}
 	}
-	wg.Wait()
 }
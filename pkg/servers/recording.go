@@ -0,0 +1,267 @@
+package servers
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// mtSelectedSession is not sent by rFactor2. It stores the selected
+	// session data in the recordings so the livemap can be replayed.
+	mtSelectedSession = "selectedSession"
+
+	recordingFileSuffix = ".jsonl.gz"
+)
+
+var fileNameReplacer = strings.NewReplacer("/", "_", "\\", "_", " ", "_", ":", "_")
+
+// RecordedMessage is a line of a recording.
+type RecordedMessage struct {
+	Time    time.Time `json:"time"`
+	Message Message   `json:"message"`
+}
+
+// messageSource provides the messages of a server, either from its websocket
+// or from a recording.
+type messageSource interface {
+	ReadMessage() (Message, error)
+	Close() error
+	String() string
+}
+
+type websocketSource struct {
+	conn *websocket.Conn
+	url  string
+}
+
+func dialWebSocket(ctx context.Context, serverURL string) (*websocketSource, error) {
+	urlString := strings.TrimPrefix(strings.TrimPrefix(serverURL, "https://"), "http://")
+	u := url.URL{Scheme: "ws", Host: urlString, Path: "/websocket/controlpanel"}
+
+	// log.Printf("trying to connect to %s", u.String())
+	dealer := &websocket.Dialer{
+		HandshakeTimeout:  10 * time.Second,
+		EnableCompression: true,
+	}
+	c, _, err := dealer.DialContext(ctx, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to %s: %w", u.String(), err)
+	}
+	return &websocketSource{conn: c, url: u.String()}, nil
+}
+
+func (ws *websocketSource) ReadMessage() (Message, error) {
+	var m Message
+	err := ws.conn.ReadJSON(&m)
+	return m, err
+}
+
+func (ws *websocketSource) Close() error {
+	return ws.conn.Close()
+}
+
+func (ws *websocketSource) String() string {
+	return ws.url
+}
+
+// replaySource reads the messages of a recording keeping the time between
+// them, divided by the speed.
+type replaySource struct {
+	path     string
+	file     *os.File
+	gz       *gzip.Reader
+	decoder  *json.Decoder
+	speed    float64
+	lastTime time.Time
+	done     chan struct{}
+	once     sync.Once
+}
+
+func openReplay(path string, speed float64) (*replaySource, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("invalid recording %s: %w", path, err)
+	}
+	if speed <= 0.0 {
+		speed = 1.0
+	}
+	return &replaySource{
+		path:    path,
+		file:    f,
+		gz:      gz,
+		decoder: json.NewDecoder(gz),
+		speed:   speed,
+		done:    make(chan struct{}),
+	}, nil
+}
+
+// ReadMessage returns io.EOF at the end of the recording.
+func (rs *replaySource) ReadMessage() (Message, error) {
+	var rm RecordedMessage
+	err := rs.decoder.Decode(&rm)
+	if err != nil {
+		return Message{}, err
+	}
+	if !rs.lastTime.IsZero() && rm.Time.After(rs.lastTime) {
+		wait := time.NewTimer(time.Duration(float64(rm.Time.Sub(rs.lastTime)) / rs.speed))
+		select {
+		case <-rs.done:
+			wait.Stop()
+			return Message{}, fmt.Errorf("replay of %s closed", rs.path)
+		case <-wait.C:
+		}
+	}
+	rs.lastTime = rm.Time
+	return rm.Message, nil
+}
+
+func (rs *replaySource) Close() error {
+	rs.once.Do(func() {
+		close(rs.done)
+		rs.gz.Close()
+		rs.file.Close()
+	})
+	return nil
+}
+
+func (rs *replaySource) String() string {
+	return fmt.Sprintf("replay %s (x%.1f)", rs.path, rs.speed)
+}
+
+// recorder writes the messages of a server to a compressed file per session.
+// The file is created when the first session info is received, so messages
+// received before are not recorded.
+type recorder struct {
+	dir      string
+	serverID string
+	session  string
+	track    string
+	file     *os.File
+	gz       *gzip.Writer
+	encoder  *json.Encoder
+	mu       sync.Mutex
+}
+
+func newRecorder(dir, serverID string) *recorder {
+	return &recorder{
+		dir:      dir,
+		serverID: serverID,
+	}
+}
+
+// Record writes the message. Errors are logged and the message is dropped so
+// a failing recording never stops the live data.
+func (r *recorder) Record(m Message) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if m.MessageType == mtSessionInfo {
+		session, track := sessionAndTrack(m.Body)
+		if r.file == nil || session != r.session || track != r.track {
+			r.close()
+			err := r.open(session)
+			if err != nil {
+				log.Printf("Error creating recording for server %s: %s\n", r.serverID, err.Error())
+				return
+			}
+			r.session = session
+			r.track = track
+		}
+	}
+	if r.encoder == nil {
+		return
+	}
+	err := r.encoder.Encode(RecordedMessage{Time: time.Now(), Message: m})
+	if err != nil {
+		log.Printf("Error recording message for server %s: %s\n", r.serverID, err.Error())
+	}
+}
+
+// RecordSession writes the message only if the current file is the one of the
+// session and track. Messages that are not read from the server, like the
+// selected session data, may arrive once the session has changed.
+func (r *recorder) RecordSession(session, track string, m Message) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.encoder == nil || session != r.session || track != r.track {
+		return
+	}
+	err := r.encoder.Encode(RecordedMessage{Time: time.Now(), Message: m})
+	if err != nil {
+		log.Printf("Error recording message for server %s: %s\n", r.serverID, err.Error())
+	}
+}
+
+func (r *recorder) Close() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.close()
+}
+
+func (r *recorder) open(session string) error {
+	err := os.MkdirAll(r.dir, 0755)
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s_%s_%s%s", r.serverID, time.Now().Format("20060102-150405"), session, recordingFileSuffix)
+	path := filepath.Join(r.dir, fileNameReplacer.Replace(name))
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	log.Printf("Recording server %s to %s\n", r.serverID, path)
+	r.file = f
+	r.gz = gzip.NewWriter(f)
+	r.encoder = json.NewEncoder(r.gz)
+	return nil
+}
+
+func (r *recorder) close() {
+	if r.file == nil {
+		return
+	}
+	err := r.gz.Close()
+	if err != nil {
+		log.Printf("Error closing recording for server %s: %s\n", r.serverID, err.Error())
+	}
+	r.file.Close()
+	r.file = nil
+	r.gz = nil
+	r.encoder = nil
+}
+
+func sessionAndTrack(body any) (string, string) {
+	info, ok := body.(map[string]any)
+	if !ok {
+		return "", ""
+	}
+	session, _ := info["session"].(string)
+	track, _ := info["trackName"].(string)
+	return session, track
+}
@@ -0,0 +1,103 @@
+package servers
+
+import (
+	"io"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestRecordSession(t *testing.T) {
+	sessionInfo := func(session string) Message {
+		return Message{MessageType: mtSessionInfo, Body: map[string]any{"session": session, "trackName": "Track"}}
+	}
+	selectedSession := Message{MessageType: mtSelectedSession, Body: map[string]any{}}
+
+	tests := []struct {
+		name    string
+		session string
+		track   string
+		// the messages of every recording file, sorted by session
+		want [][]string
+	}{
+		{
+			name:    "current session",
+			session: "QUALIFY1",
+			track:   "Track",
+			want:    [][]string{{mtSessionInfo}, {mtSessionInfo, mtSelectedSession}},
+		},
+		{
+			name:    "previous session",
+			session: "PRACTICE1",
+			track:   "Track",
+			want:    [][]string{{mtSessionInfo}, {mtSessionInfo}},
+		},
+		{
+			name:    "other track",
+			session: "QUALIFY1",
+			track:   "Other",
+			want:    [][]string{{mtSessionInfo}, {mtSessionInfo}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			rec := newRecorder(dir, "server1")
+			rec.Record(sessionInfo("PRACTICE1"))
+			rec.Record(sessionInfo("QUALIFY1"))
+			rec.RecordSession(tt.session, tt.track, selectedSession)
+			rec.Close()
+
+			files, err := filepath.Glob(filepath.Join(dir, "*"+recordingFileSuffix))
+			if err != nil {
+				t.Fatal(err)
+			}
+			// PRACTICE1 goes before QUALIFY1
+			sort.Strings(files)
+			if len(files) != len(tt.want) {
+				t.Fatalf("got %d recordings, want %d", len(files), len(tt.want))
+			}
+			for i, file := range files {
+				got := recordedTypes(t, file)
+				if len(got) != len(tt.want[i]) {
+					t.Errorf("got messages %v in %s, want %v", got, filepath.Base(file), tt.want[i])
+					continue
+				}
+				for j := range got {
+					if got[j] != tt.want[i][j] {
+						t.Errorf("got messages %v in %s, want %v", got, filepath.Base(file), tt.want[i])
+						break
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestRecordSessionWithoutRecorder(t *testing.T) {
+	var rec *recorder
+	// servers that are not recorded have no recorder
+	rec.RecordSession("RACE1", "Track", Message{MessageType: mtSelectedSession})
+}
+
+func recordedTypes(t *testing.T, path string) []string {
+	t.Helper()
+	rs, err := openReplay(path, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Close()
+
+	types := []string{}
+	for {
+		m, err := rs.ReadMessage()
+		if err == io.EOF {
+			return types
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		types = append(types, m.MessageType)
+	}
+}
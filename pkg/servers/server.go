@@ -1,11 +1,17 @@
 package servers
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/config"
 	"github.com/oscar-martin/rfactor2telegrambot/pkg/livemap"
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/metrics"
 	"github.com/oscar-martin/rfactor2telegrambot/pkg/model"
 	"github.com/oscar-martin/rfactor2telegrambot/pkg/pubsub"
 	"github.com/oscar-martin/rfactor2telegrambot/pkg/resources"
@@ -17,6 +23,9 @@ const (
 	ServerStatusOnline           = "🟢"
 	ServerStatusOnlineButNotData = "🟡"
 	ServerPrefixCommand          = "Server"
+
+	gamePhaseSessionOver = 8
+	finishStatusFinished = "FSTAT_FINISHED"
 )
 
 type Sectors struct {
@@ -37,6 +46,14 @@ type Server struct {
 	ID                              string `json:"id"`
 	URL                             string `json:"url"`
 	Name                            string
+	DisplayName                     string
+	DataTimeout                     time.Duration
+	LiveMapEnabled                  bool
+	RecordDir                       string
+	ReplayFile                      string
+	ReplaySpeed                     float64
+	ClassColors                     map[string]string
+	MembersOnly                     bool
 	WebSocketRunning                bool
 	ReceivingData                   bool
 	StartSessionPendingNotification bool
@@ -54,15 +71,29 @@ type Server struct {
 	FirstDriverEnteredChan          chan model.ServerStarted           `json:"-"`
 	SelectedSessionDataChan         chan model.SelectedSessionData     `json:"-"`
 	CarsPositionChan                chan []model.CarPosition           `json:"-"`
+	SessionFinishedChan             chan model.SessionFinished         `json:"-"`
 	cancelDownloadingChan           chan bool                          `json:"-"`
 	LiveMap                         *livemap.LiveMap                   `json:"-"`
 	LiveMapPath                     string                             `json:"liveMapPath"`
 	LiveMapDomain                   string                             `json:"liveMapDomain"`
+	lastSessionInfo                 model.SessionInfo
+	lastLiveStandingData            model.LiveStandingData
+	raceFinishedNotified            bool
+	// whether LiveMapPath was chosen for a members only server
+	liveMapMembersOnly bool
+	// the goroutines reading the server are stopped when the server is removed
+	// or its config changes
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     *sync.WaitGroup
+	// recorder of the current connection, if it is being recorded
+	rec *atomic.Pointer[recorder]
 }
 
 func NewServer(id, url, domain string) Server {
 	return Server{
 		mu:                   &sync.Mutex{},
+		wg:                   &sync.WaitGroup{},
 		ID:                   id,
 		URL:                  url,
 		LiveMapDomain:        domain,
@@ -72,28 +103,67 @@ func NewServer(id, url, domain string) Server {
 		DriverToCarId:        make(map[string]string),
 		BestLapForDriver:     make(map[string]int),
 		TopSpeedForDriver:    make(map[string]map[int]float64),
+		DataTimeout:          config.DefaultDataTimeout,
+		LiveMapEnabled:       true,
+		rec:                  &atomic.Pointer[recorder]{},
 	}
 }
 
-func (s *Server) eventHandler() {
-	startedChan := pubsub.SessionStartedPubSub.Subscribe(pubsub.PubSubSessionStartedPreffix)
-	stoppedChan := pubsub.SessionStoppedPubSub.Subscribe(pubsub.PubSubSessionStoppedPreffix)
-	selectedSessionData := pubsub.SelectedSessionDataPubSub.Subscribe(pubsub.PubSubSelectedSessionDataPreffix + s.ID)
+// NewServerFromConfig creates a server with the display name, data timeout,
+// livemap, replay and visibility settings of the config. Its data is recorded in
+// recordDir unless it is empty.
+func NewServerFromConfig(sc config.ServerConfig, domain, recordDir string) Server {
+	s := NewServer(sc.ID, sc.URL, domain)
+	s.DisplayName = sc.Name
+	s.DataTimeout = sc.DataTimeout.Duration
+	s.LiveMapEnabled = sc.LiveMapEnabled()
+	s.RecordDir = recordDir
+	s.ReplayFile = sc.Replay
+	s.ReplaySpeed = sc.ReplaySpeed
+	s.ClassColors = sc.ClassColors
+	s.MembersOnly = sc.MembersOnly()
+	return s
+}
+
+func (s *Server) eventHandler(ctx context.Context,
+	startedChan <-chan model.ServerStarted,
+	stoppedChan <-chan string,
+	selectedSessionData <-chan model.SelectedSessionData) {
+	defer func() {
+		// stop any pending download and the session of the livemap, as the
+		// stop event of the server is published once this is done
+		if s.cancelDownloadingChan != nil {
+			close(s.cancelDownloadingChan)
+			s.cancelDownloadingChan = nil
+		}
+		if s.LiveMap != nil {
+			s.LiveMap.StopSession()
+		}
+	}()
 	for {
 		select {
+		case <-ctx.Done():
+			return
 		case ss := <-startedChan:
 			if ss.ServerID == s.ID {
 				s.SessionStarted = ss
+				// replays read the selected session data from the recording
+				if s.ReplayFile != "" {
+					continue
+				}
 
+				url := s.URL
 				s.cancelDownloadingChan = make(chan bool)
 				// fetch session data and send it to the channel
 				go retryWithCancel(func() error {
-					ssd, err := getSelectedSessionData(s.URL)
+					ssd, err := getSelectedSessionData(url)
 					if err != nil {
 						log.Printf("Error getting selected session data: %s. It will be retried soon\n", err)
 						return err
 					}
 					log.Printf("Selected session data received for Server %s\n", s.ID)
+					// the recording may have moved to another session meanwhile
+					s.rec.Load().RecordSession(ss.SessionType, ss.TrackName, Message{MessageType: mtSelectedSession, Body: ssd})
 					s.SelectedSessionDataChan <- ssd
 					return nil
 				}, s.cancelDownloadingChan)
@@ -105,13 +175,17 @@ func (s *Server) eventHandler() {
 					close(s.cancelDownloadingChan)
 					s.cancelDownloadingChan = nil
 				}
-				s.LiveMap.StopSession()
+				if s.LiveMap != nil {
+					s.LiveMap.StopSession()
+				}
 			}
 		case ssd := <-selectedSessionData:
+			url := s.URL
+			liveMap := s.LiveMap
 			s.cancelDownloadingChan = make(chan bool)
 			// fetch track thumbnail and send it to the channel
 			go retryWithCancel(func() error {
-				t, err := buildTrackThumbnail(s.URL, ssd)
+				t, err := buildTrackThumbnail(url, ssd)
 				if err != nil {
 					log.Printf("Error getting track thumbnail data: %s. It will be retried soon\n", err)
 					return err
@@ -123,19 +197,51 @@ func (s *Server) eventHandler() {
 
 			// fetch track svg
 			go retryWithCancel(func() error {
-				svgTrackResource, err := buildTrackSvg(s.URL, ssd)
+				svgTrackResource, err := buildTrackSvg(url, ssd)
 				if err != nil {
 					log.Printf("Error getting track svg data: %s. It will be retried soon\n", err)
 					return err
 				}
 				log.Printf("SVG Track received for Server %s\n", s.ID)
-				s.LiveMap.StartSession(ssd, svgTrackResource)
+				if liveMap != nil {
+					liveMap.StartSession(ssd, svgTrackResource)
+				}
 				return nil
 			}, s.cancelDownloadingChan)
 		}
 	}
 }
 
+// start creates the context the goroutines of the server run with and starts
+// its event handler. The websocket readers are started by the manager.
+func (s *Server) start(ctx context.Context) {
+	s.ctx, s.cancel = context.WithCancel(ctx)
+	startedChan := pubsub.SessionStartedPubSub.SubscribeContext(s.ctx, pubsub.PubSubSessionStartedPreffix)
+	stoppedChan := pubsub.SessionStoppedPubSub.SubscribeContext(s.ctx, pubsub.PubSubSessionStoppedPreffix)
+	selectedSessionData := pubsub.SelectedSessionDataPubSub.SubscribeContext(s.ctx, pubsub.PubSubSelectedSessionDataPreffix+s.ID)
+	s.run(func() {
+		s.eventHandler(s.ctx, startedChan, stoppedChan, selectedSessionData)
+	})
+}
+
+// run runs f in a goroutine that stop waits for.
+func (s *Server) run(f func()) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		f()
+	}()
+}
+
+// stop closes the websocket connection of the server, if any, and waits until
+// its goroutines are done, so its fields can be changed safely.
+func (s *Server) stop() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.wg.Wait()
+}
+
 func (s Server) Status() string {
 	status := ServerStatusOffline
 	if s.WebSocketRunning {
@@ -152,10 +258,41 @@ func (s Server) StatusAndName() string {
 	return fmt.Sprintf("%s %s", s.Status(), s.Name)
 }
 
+func isRaceSession(session string) bool {
+	return strings.HasPrefix(strings.ToLower(session), "race")
+}
+
+// checkRaceFinished signals the end of a race session once, either when the
+// server reports the session is over or when the session is stopped after the
+// leader has taken the chequered flag.
+func (s *Server) checkRaceFinished(sessionStopped bool) {
+	if s.raceFinishedNotified || !isRaceSession(s.lastSessionInfo.Session) || len(s.lastLiveStandingData.Drivers) == 0 {
+		return
+	}
+	if s.lastSessionInfo.GamePhase != gamePhaseSessionOver &&
+		!(sessionStopped && s.lastLiveStandingData.Drivers[0].FinishStatus == finishStatusFinished) {
+		return
+	}
+	s.raceFinishedNotified = true
+	log.Printf("Signaling race finished in server %s. Session: %s\n", s.Name, s.lastSessionInfo.Session)
+	s.SessionFinishedChan <- model.SessionFinished{
+		ServerName:  s.Name,
+		ServerID:    s.ID,
+		SessionType: s.lastSessionInfo.Session,
+		TrackName:   s.lastSessionInfo.TrackName,
+		Standing:    s.lastLiveStandingData,
+	}
+}
+
 func (s *Server) reset() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	s.checkRaceFinished(true)
+	s.lastSessionInfo = model.SessionInfo{}
+	s.lastLiveStandingData = model.LiveStandingData{}
+	s.raceFinishedNotified = false
 	s.ReceivingData = false
+	metrics.ReceivingData.WithLabelValues(s.ID).Set(0)
 	s.StartSessionPendingNotification = false
 	s.BestSectorsForDriver = make(map[string]Sectors)
 	s.DriverToCarId = make(map[string]string)
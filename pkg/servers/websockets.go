@@ -5,16 +5,13 @@ import (
 	"encoding/json"
 	"log"
 	"math"
-	"net/url"
 	"slices"
 	"sort"
-	"strings"
 	"time"
 
 	"github.com/oscar-martin/rfactor2telegrambot/pkg/helper"
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/metrics"
 	"github.com/oscar-martin/rfactor2telegrambot/pkg/model"
-
-	"github.com/gorilla/websocket"
 )
 
 const (
@@ -41,48 +38,79 @@ func (s *Server) WebSocketReader(ctx context.Context) error {
 	// init channels
 	s.reset()
 
-	urlString := strings.TrimPrefix(strings.TrimPrefix(s.URL, "https://"), "http://")
-	u := url.URL{Scheme: "ws", Host: urlString, Path: "/websocket/controlpanel"}
-
-	// log.Printf("trying to connect to %s", u.String())
-	dealer := &websocket.Dialer{
-		HandshakeTimeout:  10 * time.Second,
-		EnableCompression: true,
+	var source messageSource
+	var err error
+	if s.ReplayFile != "" {
+		source, err = openReplay(s.ReplayFile, s.ReplaySpeed)
+	} else {
+		source, err = dialWebSocket(ctx, s.URL)
 	}
-	c, _, err := dealer.Dial(u.String(), nil)
 	if err != nil {
-		log.Printf("Error connecting to %s: %s", u.String(), err.Error())
+		metrics.WebSocketConnections.WithLabelValues(s.ID, "error").Inc()
+		log.Printf("Error connecting to server %s: %s", s.ID, err.Error())
 		return err
 	}
+	metrics.WebSocketConnections.WithLabelValues(s.ID, "success").Inc()
 
 	s.WebSocketRunning = true
-	log.Printf("connected to %s", u.String())
+	metrics.WebSocketRunning.WithLabelValues(s.ID).Set(1)
+	defer metrics.WebSocketRunning.WithLabelValues(s.ID).Set(0)
+	log.Printf("connected to %s", source)
 	s.LiveSessionInfoDataChan <- s.fromMessageToLiveSessionInfoData(s.Name, s.ID, &model.SessionInfo{})
 
-	defer c.Close()
+	defer source.Close()
+
+	// replays are not recorded again
+	if s.RecordDir != "" && s.ReplayFile == "" {
+		rec := newRecorder(s.RecordDir, s.ID)
+		s.rec.Store(rec)
+		defer func() {
+			s.rec.Store(nil)
+			rec.Close()
+		}()
+	}
+
 	doneErr := make(chan error)
 
 	messageChan := make(chan Message)
-	go s.dispatchMessage(ctx, messageChan, doneErr)
+	dispatched := make(chan struct{})
+	go func() {
+		defer close(dispatched)
+		s.dispatchMessage(ctx, messageChan, doneErr)
+	}()
+	// the dispatcher reads the fields of the server, so it is done before
+	// the reader returns
+	defer func() {
+		<-dispatched
+	}()
 
 	go func() {
 		defer close(doneErr)
 		for {
-			var m Message
-			err = c.ReadJSON(&m)
+			m, err := source.ReadMessage()
 			if err != nil {
 				log.Println("read error:", err)
 				doneErr <- err
 				return
 			}
+			s.rec.Load().Record(m)
 			messageChan <- m
 		}
 	}()
-	return <-doneErr
+
+	select {
+	case err := <-doneErr:
+		return err
+	case <-ctx.Done():
+		log.Printf("disconnecting from %s", source)
+		// closing the source makes the reader goroutine stop
+		source.Close()
+		return nil
+	}
 }
 
 func (s *Server) dispatchMessage(ctx context.Context, messageChan <-chan Message, doneChan <-chan error) {
-	timeoutTime := 5 * time.Second
+	timeoutTime := s.DataTimeout
 	timeout := time.After(timeoutTime)
 
 	for {
@@ -95,8 +123,10 @@ func (s *Server) dispatchMessage(ctx context.Context, messageChan <-chan Message
 			timeout = time.After(timeoutTime)
 		case m := <-messageChan:
 			timeout = time.After(timeoutTime)
+			metrics.MessagesReceived.WithLabelValues(s.ID, m.MessageType).Inc()
 			if !s.ReceivingData {
 				s.StartSessionPendingNotification = true
+				metrics.ReceivingData.WithLabelValues(s.ID).Set(1)
 			}
 			s.ReceivingData = true
 			if m.MessageType == mtStandingHistory {
@@ -135,6 +165,9 @@ func (s *Server) dispatchMessage(ctx context.Context, messageChan <-chan Message
 				}
 
 				lsd, cp := s.fromMessageToLiveStandingData(s.Name, s.ID, sdd)
+				if len(lsd.Drivers) > 0 {
+					s.lastLiveStandingData = lsd
+				}
 				s.LiveStandingChan <- lsd
 				s.CarsPositionChan <- cp
 
@@ -162,7 +195,23 @@ func (s *Server) dispatchMessage(ctx context.Context, messageChan <-chan Message
 					s.ServerStartedChan <- ss
 				}
 
+				s.lastSessionInfo = si
+				s.checkRaceFinished(false)
+
 				s.LiveSessionInfoDataChan <- s.fromMessageToLiveSessionInfoData(s.Name, s.ID, &si)
+			} else if m.MessageType == mtSelectedSession {
+				ssd := model.SelectedSessionData{}
+				jsonData, err := json.Marshal(m.Body)
+				if err != nil {
+					log.Printf("Error marshalling selectedSession: %s\n", err.Error())
+					continue
+				}
+				err = json.Unmarshal(jsonData, &ssd)
+				if err != nil {
+					log.Printf("Error unmarshalling selectedSession: %s\n", err.Error())
+					continue
+				}
+				s.SelectedSessionDataChan <- ssd
 			}
 		}
 	}
@@ -296,6 +345,8 @@ func (s *Server) fromMessageToLiveStandingData(serverName, serverID string, data
 		{
 			cp := data[i].CarPosition
 			cp.DriverShortName = helper.GetDriverCodeName(data[i].DriverName)
+			cp.CarClass = data[i].CarClass
+			cp.CarNumber = data[i].CarNumber
 			carsPosition = append(carsPosition, cp)
 		}
 		// update topSpeed
@@ -359,9 +410,15 @@ func (s *Server) fromMessageToLiveSessionInfoData(serverName, serverID string, d
 	data.ReceivingData = s.ReceivingData
 	data.LiveMapPath = s.LiveMapPath
 	data.LiveMapDomain = s.LiveMapDomain
+	if !s.LiveMapEnabled {
+		data.LiveMapPath = ""
+	}
 	if data.ServerName == "-none-" {
 		data.ServerName = serverID
 	}
+	if s.DisplayName != "" && data.ServerName != "" {
+		data.ServerName = s.DisplayName
+	}
 
 	return model.LiveSessionInfoData{
 		ServerName:  serverName,
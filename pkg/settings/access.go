@@ -0,0 +1,196 @@
+package settings
+
+import (
+	"database/sql"
+	"log"
+	"sort"
+)
+
+const (
+	// the user asked to join and waits for an admin
+	AccessPending = "pending"
+	// the user is a member and sees the members only servers
+	AccessAllowed = "allowed"
+	// the user can not use the bot
+	AccessDenied = "denied"
+)
+
+// SetAdmins sets the users that administer the bot. Admins are members and
+// approve or deny the rest of the users.
+func (m *Manager) SetAdmins(userIDs []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.admins = map[string]bool{}
+	for _, userID := range userIDs {
+		m.admins[userID] = true
+	}
+}
+
+// Admins returns the IDs of the admins, sorted.
+func (m *Manager) Admins() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	admins := []string{}
+	for userID := range m.admins {
+		admins = append(admins, userID)
+	}
+	sort.Strings(admins)
+	return admins
+}
+
+func (m *Manager) IsAdmin(userID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.admins[userID]
+}
+
+// SetServerVisibility sets whether the server is only shown to the members.
+func (m *Manager) SetServerVisibility(serverID string, membersOnly bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.membersOnly[serverID] = membersOnly
+}
+
+func (m *Manager) IsMembersOnly(serverID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.membersOnly[serverID]
+}
+
+// Access returns the access status of the user or an empty string if the user
+// never asked to join nor was approved or denied.
+func (m *Manager) Access(userID string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.userAccess(userID)
+}
+
+// IsDenied returns whether the user was denied the use of the bot. Admins are
+// never denied.
+func (m *Manager) IsDenied(userID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.isDenied(userID)
+}
+
+// IsMember returns whether the user is an admin or was approved by one.
+func (m *Manager) IsMember(userID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.isMember(userID)
+}
+
+// CanSeeServer returns whether the user can see the server. Public servers are
+// seen by everyone that is not denied and members only servers by the members.
+func (m *Manager) CanSeeServer(userID, serverID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.membersOnly[serverID] {
+		return !m.isDenied(userID)
+	}
+	return m.isMember(userID)
+}
+
+// RequestAccess stores a join request for the user unless it already has an
+// access status. It returns the status of the user and whether the request was
+// created, so the admins are only asked once.
+func (m *Manager) RequestAccess(user TelegramUser) (string, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.admins[user.ID] {
+		return AccessAllowed, false, nil
+	}
+	status, err := m.userAccess(user.ID)
+	if err != nil || status != "" {
+		return status, false, err
+	}
+	err = m.storeAccess(user, AccessPending)
+	if err != nil {
+		return status, false, err
+	}
+	return AccessPending, true, nil
+}
+
+// SetAccess changes the access status of the user and returns the user as it
+// was stored when it asked to join. Users that never asked are stored with
+// their ID, so admins can allow or deny them beforehand.
+func (m *Manager) SetAccess(userID, status string) (TelegramUser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user := TelegramUser{ID: userID, Name: userID, ChatID: userID}
+	err := m.db.QueryRow(buildSelectAccessUserCommand(), userID).Scan(&user.ID, &user.Name, &user.ChatID)
+	if err != nil && err != sql.ErrNoRows {
+		return user, err
+	}
+	return user, m.storeAccess(user, status)
+}
+
+// ListAccess returns the users with the access status, sorted by name.
+func (m *Manager) ListAccess(status string) ([]TelegramUser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	users := []TelegramUser{}
+	sql, read := buildSelectAccessUsersCommand()
+	rows, err := m.db.Query(sql, status)
+	if err != nil {
+		return users, err
+	}
+	return read(rows)
+}
+
+func (m *Manager) isDenied(userID string) bool {
+	if m.admins[userID] {
+		return false
+	}
+	status, err := m.userAccess(userID)
+	if err != nil {
+		log.Printf("Error reading the access of user %s: %s\n", userID, err.Error())
+	}
+	return status == AccessDenied
+}
+
+func (m *Manager) isMember(userID string) bool {
+	if m.admins[userID] {
+		return true
+	}
+	status, err := m.userAccess(userID)
+	if err != nil {
+		log.Printf("Error reading the access of user %s: %s\n", userID, err.Error())
+	}
+	return status == AccessAllowed
+}
+
+func (m *Manager) userAccess(userID string) (string, error) {
+	if status, found := m.access[userID]; found {
+		return status, nil
+	}
+	status := ""
+	err := m.db.QueryRow(buildSelectAccessCommand(), userID).Scan(&status)
+	if err != nil && err != sql.ErrNoRows {
+		return status, err
+	}
+	m.access[userID] = status
+	return status, nil
+}
+
+func (m *Manager) storeAccess(user TelegramUser, status string) error {
+	_, err := m.db.Exec(buildInsertAccessCommand(), user.ID, user.Name, user.ChatID, status)
+	if err != nil {
+		log.Printf("error updating database: %s\n", err)
+		return err
+	}
+	m.access[user.ID] = status
+	return nil
+}
@@ -0,0 +1,147 @@
+package settings
+
+import (
+	"testing"
+)
+
+func TestCanSeeServer(t *testing.T) {
+	tests := []struct {
+		name        string
+		userID      string
+		membersOnly bool
+		want        bool
+	}{
+		{"unknown user on public server", "unknown", false, true},
+		{"unknown user on members only server", "unknown", true, false},
+		{"pending user on public server", "pending", false, true},
+		{"pending user on members only server", "pending", true, false},
+		{"member on public server", "member", false, true},
+		{"member on members only server", "member", true, true},
+		{"denied user on public server", "denied", false, false},
+		{"denied user on members only server", "denied", true, false},
+		{"admin on members only server", "admin", true, true},
+		{"denied admin on public server", "deniedadmin", false, true},
+	}
+
+	m := newTestManager(t)
+	m.SetAdmins([]string{"admin", "deniedadmin"})
+	for userID, status := range map[string]string{
+		"pending":     AccessPending,
+		"member":      AccessAllowed,
+		"denied":      AccessDenied,
+		"deniedadmin": AccessDenied,
+	} {
+		_, err := m.SetAccess(userID, status)
+		if err != nil {
+			t.Fatalf("error setting the access of %s: %s", userID, err)
+		}
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m.SetServerVisibility("server1", tt.membersOnly)
+			got := m.CanSeeServer(tt.userID, "server1")
+			if got != tt.want {
+				t.Errorf("got %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestAccess(t *testing.T) {
+	tests := []struct {
+		name        string
+		userID      string
+		status      string
+		wantStatus  string
+		wantCreated bool
+	}{
+		{
+			name:        "new user",
+			userID:      "new",
+			wantStatus:  AccessPending,
+			wantCreated: true,
+		},
+		{
+			name:        "pending user is not asked again",
+			userID:      "pending",
+			status:      AccessPending,
+			wantStatus:  AccessPending,
+			wantCreated: false,
+		},
+		{
+			name:        "member",
+			userID:      "member",
+			status:      AccessAllowed,
+			wantStatus:  AccessAllowed,
+			wantCreated: false,
+		},
+		{
+			name:        "denied user",
+			userID:      "denied",
+			status:      AccessDenied,
+			wantStatus:  AccessDenied,
+			wantCreated: false,
+		},
+		{
+			name:        "admin",
+			userID:      "admin",
+			wantStatus:  AccessAllowed,
+			wantCreated: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestManager(t)
+			m.SetAdmins([]string{"admin"})
+			if tt.status != "" {
+				_, err := m.SetAccess(tt.userID, tt.status)
+				if err != nil {
+					t.Fatalf("error setting the access: %s", err)
+				}
+			}
+
+			status, created, err := m.RequestAccess(TelegramUser{ID: tt.userID, Name: tt.userID, ChatID: tt.userID})
+			if err != nil {
+				t.Fatalf("error requesting access: %s", err)
+			}
+			if status != tt.wantStatus || created != tt.wantCreated {
+				t.Errorf("got (%q, %t), want (%q, %t)", status, created, tt.wantStatus, tt.wantCreated)
+			}
+
+			// a second request never asks the admins again
+			_, created, err = m.RequestAccess(TelegramUser{ID: tt.userID, Name: tt.userID, ChatID: tt.userID})
+			if err != nil {
+				t.Fatalf("error requesting access: %s", err)
+			}
+			if created {
+				t.Error("the request was created twice")
+			}
+		})
+	}
+}
+
+func TestSetAccessKeepsRequestedUser(t *testing.T) {
+	m := newTestManager(t)
+	_, _, err := m.RequestAccess(TelegramUser{ID: "1", Name: "Driver", ChatID: "10"})
+	if err != nil {
+		t.Fatalf("error requesting access: %s", err)
+	}
+
+	user, err := m.SetAccess("1", AccessAllowed)
+	if err != nil {
+		t.Fatalf("error setting the access: %s", err)
+	}
+	if user.Name != "Driver" || user.ChatID != "10" {
+		t.Errorf("got user %v, want the one that asked to join", user)
+	}
+
+	users, err := m.ListAccess(AccessAllowed)
+	if err != nil {
+		t.Fatalf("error listing the access: %s", err)
+	}
+	if len(users) != 1 || users[0].ID != "1" {
+		t.Errorf("got members %v, want only user 1", users)
+	}
+}
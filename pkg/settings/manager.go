@@ -2,6 +2,7 @@ package settings
 
 import (
 	"database/sql"
+	"fmt"
 	"log"
 	"sync"
 
@@ -16,6 +17,8 @@ const (
 	Qual     = "Qual"
 	Warmup   = "Warmup"
 	Race     = "Race"
+
+	RaceFinished = "RaceFinished"
 )
 
 type TelegramUser struct {
@@ -33,6 +36,8 @@ func AllEnabled() Notifications {
 		Qual:     true,
 		Warmup:   true,
 		Race:     true,
+
+		RaceFinished: true,
 	}
 }
 
@@ -43,9 +48,18 @@ func AllDisabled() Notifications {
 		Qual:     false,
 		Warmup:   false,
 		Race:     false,
+
+		RaceFinished: false,
 	}
 }
 
+// IsSessionType returns whether notifications can be enabled for the session
+// type.
+func IsSessionType(sessionType string) bool {
+	_, found := AllDisabled()[sessionType]
+	return found
+}
+
 func (n Notifications) TestDaySymbol() string {
 	return symbolStatus(n[TestDay])
 }
@@ -66,6 +80,10 @@ func (n Notifications) RaceSymbol() string {
 	return symbolStatus(n[Race])
 }
 
+func (n Notifications) RaceFinishedSymbol() string {
+	return symbolStatus(n[RaceFinished])
+}
+
 func (n Notifications) TestDayEnabledInt() int {
 	if n[TestDay] {
 		return 1
@@ -101,6 +119,23 @@ func (n Notifications) RaceEnabledInt() int {
 	return 0
 }
 
+func (n Notifications) RaceFinishedEnabledInt() int {
+	if n[RaceFinished] {
+		return 1
+	}
+	return 0
+}
+
+// Symbol returns the enabled symbol when any notification is enabled.
+func (n Notifications) Symbol() string {
+	for _, enabled := range n {
+		if enabled {
+			return symbolStatus(true)
+		}
+	}
+	return symbolStatus(false)
+}
+
 func symbolStatus(enabled bool) string {
 	if enabled {
 		return "🔔"
@@ -114,30 +149,103 @@ func (n *Notifications) setSessionTypeEnabledFlag(sessionType string, enabled bo
 
 type Manager struct {
 	db *sql.DB
-	mu sync.Mutex
+	// notifications enabled by default per server for the users that did not
+	// configure it yet
+	defaults map[string]Notifications
+	// languages of the users read from the database
+	languages map[string]userLanguage
+	// IDs of the users that administer the bot, from the config
+	admins map[string]bool
+	// servers only shown to the members, the admins and the approved users
+	membersOnly map[string]bool
+	// access status of the users read from the database
+	access map[string]string
+	mu     sync.Mutex
+}
+
+type userLanguage struct {
+	language string
+	// whether the user chose the language or it was the one of its client
+	chosen bool
+}
+
+// NewManager opens the bot database and creates the notification tables. The
+// notification settings stored before they were per server are copied to
+// every server in serverIDs the first time the per server table is created.
+func NewManager(serverIDs []string) (*Manager, error) {
+	return openManager(DbName, serverIDs)
 }
 
-func NewManager() (*Manager, error) {
-	db, err := sql.Open("sqlite", DbName)
+func openManager(dbName string, serverIDs []string) (*Manager, error) {
+	db, err := sql.Open("sqlite", dbName)
 	if err != nil {
 		log.Printf("error opening database: %s\n", err)
 		return nil, err
 	}
 
-	initTableStmt := buildCreateNotificationsTable()
+	for _, initTableStmt := range []string{buildCreateNotificationsTable(), buildCreateServerNotificationsTable(), buildCreateFollowedDriversTable(), buildCreateLanguagesTable(), buildCreateAccessTable()} {
+		_, err = db.Exec(initTableStmt)
+		if err != nil {
+			log.Printf("error init database: %s\n", err)
+			return nil, err
+		}
+	}
+
+	err = migrateNotificationsTable(db)
+	if err != nil {
+		log.Printf("error migrating database: %s\n", err)
+		return nil, err
+	}
+
+	err = migrateServerNotificationsTable(db, serverIDs)
+	if err != nil {
+		log.Printf("error migrating database: %s\n", err)
+		return nil, err
+	}
 
-	_, err = db.Exec(initTableStmt)
+	// groups used to store the language of the member that wrote last
+	_, err = db.Exec(buildDeleteDetectedGroupLanguagesCommand())
 	if err != nil {
-		log.Printf("error init database: %s\n", err)
+		log.Printf("error migrating database: %s\n", err)
 		return nil, err
 	}
 
 	return &Manager{
-		db: db,
-		mu: sync.Mutex{},
+		db:          db,
+		defaults:    map[string]Notifications{},
+		languages:   map[string]userLanguage{},
+		admins:      map[string]bool{},
+		membersOnly: map[string]bool{},
+		access:      map[string]string{},
+		mu:          sync.Mutex{},
 	}, nil
 }
 
+// SetServerDefaults sets the notifications enabled by default for the server.
+// Session types not in n are disabled.
+func (m *Manager) SetServerDefaults(serverID string, n map[string]bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	defaults := AllDisabled()
+	for sessionType, enabled := range n {
+		if _, found := defaults[sessionType]; !found {
+			log.Printf("Unknown session type %q in the notification defaults of server %s\n", sessionType, serverID)
+			continue
+		}
+		defaults.setSessionTypeEnabledFlag(sessionType, enabled)
+	}
+	m.defaults[serverID] = defaults
+}
+
+func (m *Manager) serverDefaults(serverID string) Notifications {
+	n := AllDisabled()
+	for sessionType, enabled := range m.defaults[serverID] {
+		n.setSessionTypeEnabledFlag(sessionType, enabled)
+	}
+	return n
+}
+
 func (m *Manager) Close() error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -145,17 +253,22 @@ func (m *Manager) Close() error {
 	return m.db.Close()
 }
 
-func (m *Manager) ToggleNotificationForSessionStarted(userID, chatID, sessionType string) error {
+func (m *Manager) ToggleNotificationForSessionStarted(userID, chatID, serverID, sessionType string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	n, err := m.listNotificationsForSessionStarted(userID)
+	if !IsSessionType(sessionType) {
+		return fmt.Errorf("unknown session type %q", sessionType)
+	}
+
+	n, err := m.listNotificationsForSessionStarted(userID, serverID)
 	if err != nil {
 		return err
 	}
 
 	n.setSessionTypeEnabledFlag(sessionType, !n[sessionType])
-	_, err = m.db.Exec(buildUpdateUserCommand(userID, chatID, n))
+	stmt, args := buildUpdateUserCommand(userID, chatID, serverID, n)
+	_, err = m.db.Exec(stmt, args...)
 	if err != nil {
 		log.Printf("error updating database: %s\n", err)
 		return err
@@ -163,33 +276,241 @@ func (m *Manager) ToggleNotificationForSessionStarted(userID, chatID, sessionTyp
 	return nil
 }
 
-func (m *Manager) ListNotifications(userID string) (Notifications, error) {
+func (m *Manager) ListNotifications(userID, serverID string) (Notifications, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	return m.listNotificationsForSessionStarted(userID)
+	return m.listNotificationsForSessionStarted(userID, serverID)
 }
 
-func (m *Manager) ListUsersForSessionStarted(sessionType string) ([]TelegramUser, error) {
+// ListServerNotifications returns the notification settings of the user for
+// every server it has configured, keyed by server ID.
+func (m *Manager) ListServerNotifications(userID string) (map[string]Notifications, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sql, read := buildSelectUserServersCommand()
+	rows, err := m.db.Query(sql, userID)
+	if err != nil {
+		return map[string]Notifications{}, err
+	}
+	ns, err := read(rows)
+	if err != nil {
+		return ns, err
+	}
+	for serverID := range m.defaults {
+		if _, found := ns[serverID]; !found {
+			ns[serverID] = m.serverDefaults(serverID)
+		}
+	}
+	return ns, nil
+}
+
+func (m *Manager) ListUsersForSessionStarted(serverID, sessionType string) ([]TelegramUser, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	users := []TelegramUser{}
-	sql, read := buildSelectSessionStartedCommand(sessionType)
-	rows, err := m.db.Query(sql)
+	if !IsSessionType(sessionType) {
+		return users, fmt.Errorf("unknown session type %q", sessionType)
+	}
+	sql, read := buildSelectSessionStartedCommand(sessionType, m.serverDefaults(serverID)[sessionType])
+	rows, err := m.db.Query(sql, serverID)
 	if err != nil {
 		return users, err
 	}
 	return read(rows)
 }
 
-func (m *Manager) listNotificationsForSessionStarted(userID string) (Notifications, error) {
-	n := AllDisabled()
+func (m *Manager) ListUsersForRaceFinished(serverID string) ([]TelegramUser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-	sql, read := buildSelectUserCommand(userID)
-	rows, err := m.db.Query(sql)
+	users := []TelegramUser{}
+	sql, read := buildSelectSessionStartedCommand(RaceFinished, m.serverDefaults(serverID)[RaceFinished])
+	rows, err := m.db.Query(sql, serverID)
 	if err != nil {
-		return n, err
+		return users, err
+	}
+	return read(rows)
+}
+
+// ToggleFollowedDriver follows the driver when the user is not following it
+// yet and unfollows it otherwise. It returns whether the driver is followed.
+func (m *Manager) ToggleFollowedDriver(userID, chatID, driverName string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	count := 0
+	err := m.db.QueryRow(buildSelectFollowedDriverCommand(), userID, driverName).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+
+	if count > 0 {
+		_, err = m.db.Exec(buildDeleteFollowedDriverCommand(), userID, driverName)
+	} else {
+		_, err = m.db.Exec(buildInsertFollowedDriverCommand(), userID, userID, chatID, driverName)
+	}
+	if err != nil {
+		log.Printf("error updating database: %s\n", err)
+		return false, err
+	}
+	return count == 0, nil
+}
+
+// ListFollowedDrivers returns the names of the drivers followed by the user.
+func (m *Manager) ListFollowedDrivers(userID string) (map[string]bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sql, read := buildSelectFollowedDriversCommand()
+	rows, err := m.db.Query(sql, userID)
+	if err != nil {
+		return map[string]bool{}, err
 	}
 	return read(rows)
 }
+
+func (m *Manager) ListUsersFollowingDriver(driverName string) ([]TelegramUser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	users := []TelegramUser{}
+	sql, read := buildSelectDriverFollowersCommand()
+	rows, err := m.db.Query(sql, driverName)
+	if err != nil {
+		return users, err
+	}
+	return read(rows)
+}
+
+// Language returns the language chosen by the user. Users that did not
+// choose one get the detected language, the one of their Telegram client,
+// which is stored so the notifications sent to them use it too.
+func (m *Manager) Language(userID, detected string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, err := m.userLanguage(userID)
+	if err != nil {
+		return detected, err
+	}
+	if stored.chosen || stored.language == detected || detected == "" {
+		return stored.language, nil
+	}
+	return detected, m.storeLanguage(userID, userLanguage{language: detected})
+}
+
+// ChosenLanguage returns the language chosen for the group or def if none was
+// chosen. Members of a group may use different languages, so unlike Language
+// the language of the client is not stored.
+func (m *Manager) ChosenLanguage(groupID, def string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, err := m.userLanguage(groupID)
+	if err != nil || !stored.chosen {
+		return def, err
+	}
+	return stored.language, nil
+}
+
+// SetLanguage stores the language chosen by the user.
+func (m *Manager) SetLanguage(userID, language string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.storeLanguage(userID, userLanguage{language: language, chosen: true})
+}
+
+// StoredLanguage returns the language stored for the user or an empty string
+// if the bot did not hear from the user since languages are stored.
+func (m *Manager) StoredLanguage(userID string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, err := m.userLanguage(userID)
+	return stored.language, err
+}
+
+func (m *Manager) userLanguage(userID string) (userLanguage, error) {
+	if ul, found := m.languages[userID]; found {
+		return ul, nil
+	}
+	ul := userLanguage{}
+	err := m.db.QueryRow(buildSelectLanguageCommand(), userID).Scan(&ul.language, &ul.chosen)
+	if err != nil && err != sql.ErrNoRows {
+		return ul, err
+	}
+	m.languages[userID] = ul
+	return ul, nil
+}
+
+func (m *Manager) storeLanguage(userID string, ul userLanguage) error {
+	_, err := m.db.Exec(buildInsertLanguageCommand(), userID, ul.language, ul.chosen)
+	if err != nil {
+		log.Printf("error updating database: %s\n", err)
+		return err
+	}
+	m.languages[userID] = ul
+	return nil
+}
+
+func (m *Manager) listNotificationsForSessionStarted(userID, serverID string) (Notifications, error) {
+	n := m.serverDefaults(serverID)
+
+	sql, read := buildSelectUserCommand()
+	rows, err := m.db.Query(sql, userID, serverID)
+	if err != nil {
+		return n, err
+	}
+	stored, err := read(rows)
+	if err != nil || stored == nil {
+		return n, err
+	}
+	return stored, nil
+}
+
+// migrateNotificationsTable adds the columns that were introduced after the
+// notifications table was first created.
+func migrateNotificationsTable(db *sql.DB) error {
+	sql, read := buildSelectNotificationsColumnsCommand()
+	rows, err := db.Query(sql)
+	if err != nil {
+		return err
+	}
+	columns, err := read(rows)
+	if err != nil {
+		return err
+	}
+	for _, column := range []string{"racefinished"} {
+		if !columns[column] {
+			_, err = db.Exec(buildAddNotificationsColumnCommand(column))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// migrateServerNotificationsTable copies the notification settings from the
+// notifications table to every server when server_notifications is empty.
+func migrateServerNotificationsTable(db *sql.DB, serverIDs []string) error {
+	count := 0
+	err := db.QueryRow(buildCountServerNotificationsCommand()).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	for _, serverID := range serverIDs {
+		_, err = db.Exec(buildCopyNotificationsCommand(), serverID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package settings
 import (
 	"database/sql"
 	"fmt"
+	"strings"
 )
 
 func buildCreateNotificationsTable() string {
@@ -14,18 +15,74 @@ func buildCreateNotificationsTable() string {
 		practice INTEGER,
 		qual INTEGER,
 		warnup INTEGER,
-		race INTEGER);`
+		race INTEGER,
+		racefinished INTEGER DEFAULT 0);`
 }
 
-func buildSelectUserCommand(userID string) (string, func(*sql.Rows) (Notifications, error)) {
-	fields := "testday, practice, qual, warnup, race"
-	return fmt.Sprintf(`SELECT %s FROM notifications WHERE userid = '%s'`, fields, userID), processSelectUserRows
+func buildSelectNotificationsColumnsCommand() (string, func(*sql.Rows) (map[string]bool, error)) {
+	return `SELECT name FROM pragma_table_info('notifications')`, processSelectNamesRows
 }
 
+func processSelectNamesRows(rows *sql.Rows) (map[string]bool, error) {
+	defer rows.Close()
+
+	names := map[string]bool{}
+	for rows.Next() {
+		var name string
+		err := rows.Scan(&name)
+		if err != nil {
+			return names, err
+		}
+		names[name] = true
+	}
+	return names, rows.Err()
+}
+
+func buildAddNotificationsColumnCommand(column string) string {
+	return fmt.Sprintf(`ALTER TABLE notifications ADD COLUMN %s INTEGER DEFAULT 0`, column)
+}
+
+func buildCreateServerNotificationsTable() string {
+	return `CREATE TABLE IF NOT EXISTS server_notifications (
+		userid TEXT NOT NULL,
+		name TEXT NOT NULL,
+		chatid TEXT NOT NULL,
+		serverid TEXT NOT NULL,
+		testday INTEGER DEFAULT 0,
+		practice INTEGER DEFAULT 0,
+		qual INTEGER DEFAULT 0,
+		warnup INTEGER DEFAULT 0,
+		race INTEGER DEFAULT 0,
+		racefinished INTEGER DEFAULT 0,
+		PRIMARY KEY (userid, serverid));`
+}
+
+func buildCountServerNotificationsCommand() string {
+	return `SELECT COUNT(*) FROM server_notifications`
+}
+
+// buildCopyNotificationsCommand copies the settings stored before they were
+// per server so they keep applying to the server given as argument.
+func buildCopyNotificationsCommand() string {
+	fields := "userid, name, chatid, serverid, testday, practice, qual, warnup, race, racefinished"
+	values := "userid, name, chatid, ?, testday, practice, qual, warnup, race, racefinished"
+	return fmt.Sprintf(`INSERT OR IGNORE INTO server_notifications (%s) SELECT %s FROM notifications`, fields, values)
+}
+
+// the server IDs come from the callback data, which can be forged, so the
+// notifications statements use placeholders instead of formatting the values
+// into the query.
+func buildSelectUserCommand() (string, func(*sql.Rows) (Notifications, error)) {
+	fields := "testday, practice, qual, warnup, race, racefinished"
+	return fmt.Sprintf(`SELECT %s FROM server_notifications WHERE userid = ? AND serverid = ?`, fields), processSelectUserRows
+}
+
+// processSelectUserRows returns nil notifications when the user did not
+// configure the server yet.
 func processSelectUserRows(rows *sql.Rows) (Notifications, error) {
 	defer rows.Close()
 
-	n := AllDisabled()
+	var n Notifications
 	// only can be one row
 	if rows.Next() {
 		var testday int
@@ -33,15 +90,18 @@ func processSelectUserRows(rows *sql.Rows) (Notifications, error) {
 		var qual int
 		var warnup int
 		var race int
-		err := rows.Scan(&testday, &practice, &qual, &warnup, &race)
+		var racefinished sql.NullInt64
+		err := rows.Scan(&testday, &practice, &qual, &warnup, &race, &racefinished)
 		if err != nil {
 			return n, err
 		}
+		n = AllDisabled()
 		n.setSessionTypeEnabledFlag(TestDay, testday == 1)
 		n.setSessionTypeEnabledFlag(Practice, practice == 1)
 		n.setSessionTypeEnabledFlag(Qual, qual == 1)
 		n.setSessionTypeEnabledFlag(Warmup, warnup == 1)
 		n.setSessionTypeEnabledFlag(Race, race == 1)
+		n.setSessionTypeEnabledFlag(RaceFinished, racefinished.Int64 == 1)
 		return n, nil
 	}
 	err := rows.Err()
@@ -51,9 +111,60 @@ func processSelectUserRows(rows *sql.Rows) (Notifications, error) {
 	return n, err
 }
 
-func buildSelectSessionStartedCommand(sessionType string) (string, func(rows *sql.Rows) ([]TelegramUser, error)) {
+func buildSelectUserServersCommand() (string, func(*sql.Rows) (map[string]Notifications, error)) {
+	fields := "serverid, testday, practice, qual, warnup, race, racefinished"
+	return fmt.Sprintf(`SELECT %s FROM server_notifications WHERE userid = ?`, fields), processSelectUserServersRows
+}
+
+func processSelectUserServersRows(rows *sql.Rows) (map[string]Notifications, error) {
+	defer rows.Close()
+
+	ns := map[string]Notifications{}
+	for rows.Next() {
+		var serverid string
+		var testday int
+		var practice int
+		var qual int
+		var warnup int
+		var race int
+		var racefinished sql.NullInt64
+		err := rows.Scan(&serverid, &testday, &practice, &qual, &warnup, &race, &racefinished)
+		if err != nil {
+			return ns, err
+		}
+		n := AllDisabled()
+		n.setSessionTypeEnabledFlag(TestDay, testday == 1)
+		n.setSessionTypeEnabledFlag(Practice, practice == 1)
+		n.setSessionTypeEnabledFlag(Qual, qual == 1)
+		n.setSessionTypeEnabledFlag(Warmup, warnup == 1)
+		n.setSessionTypeEnabledFlag(Race, race == 1)
+		n.setSessionTypeEnabledFlag(RaceFinished, racefinished.Int64 == 1)
+		ns[serverid] = n
+	}
+	return ns, rows.Err()
+}
+
+// buildSelectSessionStartedCommand selects the users with the session type
+// enabled for the server given as argument. When it is enabled by default, the
+// users that did not configure the server yet are selected too. The session
+// type must be one of the known ones, as it is the name of a column.
+func buildSelectSessionStartedCommand(sessionType string, enabledByDefault bool) (string, func(rows *sql.Rows) ([]TelegramUser, error)) {
 	fields := "userid, name, chatid"
-	return fmt.Sprintf(`SELECT %s FROM notifications WHERE %s = 1`, fields, sessionType), processSelectSessionStartedRows
+	query := fmt.Sprintf(`SELECT %s FROM server_notifications WHERE serverid = ?1 AND %s = 1`, fields, sessionTypeColumn(sessionType))
+	if enabledByDefault {
+		query += ` UNION SELECT userid, MAX(name), MAX(chatid) FROM server_notifications
+			WHERE userid NOT IN (SELECT userid FROM server_notifications WHERE serverid = ?1) GROUP BY userid`
+	}
+	return query, processSelectSessionStartedRows
+}
+
+// sessionTypeColumn returns the column that stores the flag for the session
+// type. Warmup was stored as warnup since the table was first created.
+func sessionTypeColumn(sessionType string) string {
+	if sessionType == Warmup {
+		return "warnup"
+	}
+	return strings.ToLower(sessionType)
 }
 
 func processSelectSessionStartedRows(rows *sql.Rows) ([]TelegramUser, error) {
@@ -81,14 +192,85 @@ func processSelectSessionStartedRows(rows *sql.Rows) ([]TelegramUser, error) {
 	return users, err
 }
 
-func buildUpdateUserCommand(userID, chatID string, n Notifications) string {
-	testday := n.TestDayEnabledInt()
-	practice := n.PracticeEnabledInt()
-	qual := n.QualEnabledInt()
-	warnup := n.WarmupEnabledInt()
-	race := n.RaceEnabledInt()
+// buildUpdateUserCommand stores the notifications of the user for the server.
+// It returns the statement and its arguments.
+func buildUpdateUserCommand(userID, chatID, serverID string, n Notifications) (string, []any) {
+	fields := "userid, name, chatid, serverid, testday, practice, qual, warnup, race, racefinished"
+	return fmt.Sprintf(`INSERT OR REPLACE INTO server_notifications (%s) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, fields),
+		[]any{userID, userID, chatID, serverID, n.TestDayEnabledInt(), n.PracticeEnabledInt(), n.QualEnabledInt(), n.WarmupEnabledInt(), n.RaceEnabledInt(), n.RaceFinishedEnabledInt()}
+}
+
+func buildCreateFollowedDriversTable() string {
+	return `CREATE TABLE IF NOT EXISTS followed_drivers (
+		userid TEXT NOT NULL,
+		name TEXT NOT NULL,
+		chatid TEXT NOT NULL,
+		drivername TEXT NOT NULL,
+		PRIMARY KEY (userid, drivername));`
+}
+
+// driver names come from the game so the followed drivers statements use
+// placeholders instead of formatting the values into the query.
+func buildSelectFollowedDriverCommand() string {
+	return `SELECT COUNT(*) FROM followed_drivers WHERE userid = ? AND drivername = ?`
+}
+
+func buildInsertFollowedDriverCommand() string {
+	return `INSERT OR REPLACE INTO followed_drivers (userid, name, chatid, drivername) VALUES (?, ?, ?, ?)`
+}
+
+func buildDeleteFollowedDriverCommand() string {
+	return `DELETE FROM followed_drivers WHERE userid = ? AND drivername = ?`
+}
+
+func buildSelectFollowedDriversCommand() (string, func(*sql.Rows) (map[string]bool, error)) {
+	return `SELECT drivername FROM followed_drivers WHERE userid = ?`, processSelectNamesRows
+}
+
+func buildSelectDriverFollowersCommand() (string, func(rows *sql.Rows) ([]TelegramUser, error)) {
+	return `SELECT userid, name, chatid FROM followed_drivers WHERE drivername = ?`, processSelectSessionStartedRows
+}
+
+func buildCreateLanguagesTable() string {
+	return `CREATE TABLE IF NOT EXISTS languages (
+		userid TEXT PRIMARY KEY,
+		language TEXT NOT NULL,
+		chosen INTEGER DEFAULT 0);`
+}
+
+func buildSelectLanguageCommand() string {
+	return `SELECT language, chosen FROM languages WHERE userid = ?`
+}
+
+func buildInsertLanguageCommand() string {
+	return `INSERT OR REPLACE INTO languages (userid, language, chosen) VALUES (?, ?, ?)`
+}
+
+// the IDs of the Telegram groups are negative
+func buildDeleteDetectedGroupLanguagesCommand() string {
+	return `DELETE FROM languages WHERE chosen = 0 AND userid LIKE '-%'`
+}
+
+func buildCreateAccessTable() string {
+	return `CREATE TABLE IF NOT EXISTS access (
+		userid TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		chatid TEXT NOT NULL,
+		status TEXT NOT NULL);`
+}
+
+func buildSelectAccessCommand() string {
+	return `SELECT status FROM access WHERE userid = ?`
+}
+
+func buildSelectAccessUserCommand() string {
+	return `SELECT userid, name, chatid FROM access WHERE userid = ?`
+}
+
+func buildInsertAccessCommand() string {
+	return `INSERT OR REPLACE INTO access (userid, name, chatid, status) VALUES (?, ?, ?, ?)`
+}
 
-	fields := "userid, name, chatid, testday, practice, qual, warnup, race"
-	values := fmt.Sprintf(`'%s', '%s', '%s', %d, %d, %d, %d, %d`, userID, userID, chatID, testday, practice, qual, warnup, race)
-	return fmt.Sprintf(`INSERT OR REPLACE INTO notifications (%s) VALUES (%s)`, fields, values)
+func buildSelectAccessUsersCommand() (string, func(rows *sql.Rows) ([]TelegramUser, error)) {
+	return `SELECT userid, name, chatid FROM access WHERE status = ? ORDER BY name`, processSelectSessionStartedRows
 }
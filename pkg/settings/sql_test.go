@@ -0,0 +1,147 @@
+package settings
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestManager(t *testing.T) *Manager {
+	t.Helper()
+	m, err := openManager(filepath.Join(t.TempDir(), "test.db"), []string{})
+	if err != nil {
+		t.Fatalf("error opening the database: %s", err)
+	}
+	t.Cleanup(func() {
+		m.Close()
+	})
+	return m
+}
+
+func TestSessionTypeColumn(t *testing.T) {
+	tests := []struct {
+		sessionType string
+		want        string
+	}{
+		{TestDay, "testday"},
+		{Practice, "practice"},
+		{Qual, "qual"},
+		{Warmup, "warnup"},
+		{Race, "race"},
+		{RaceFinished, "racefinished"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sessionType, func(t *testing.T) {
+			got := sessionTypeColumn(tt.sessionType)
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildSelectSessionStartedCommand(t *testing.T) {
+	tests := []struct {
+		name             string
+		enabledByDefault bool
+		wantUnion        bool
+	}{
+		{
+			name:             "only the users that enabled it",
+			enabledByDefault: false,
+			wantUnion:        false,
+		},
+		{
+			name:             "also the users that did not configure the server",
+			enabledByDefault: true,
+			wantUnion:        true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, _ := buildSelectSessionStartedCommand(Race, tt.enabledByDefault)
+			if !strings.Contains(query, "serverid = ?1 AND race = 1") {
+				t.Errorf("the query does not filter by the server and session type: %s", query)
+			}
+			if strings.Contains(query, "UNION") != tt.wantUnion {
+				t.Errorf("got union %t, want %t: %s", !tt.wantUnion, tt.wantUnion, query)
+			}
+		})
+	}
+}
+
+func TestBuildUpdateUserCommand(t *testing.T) {
+	n := AllDisabled()
+	n.setSessionTypeEnabledFlag(Race, true)
+	stmt, args := buildUpdateUserCommand("1", "2", "server'1", n)
+	if strings.Contains(stmt, "server'1") {
+		t.Errorf("the server ID is formatted into the statement: %s", stmt)
+	}
+	if got := strings.Count(stmt, "?"); got != len(args) {
+		t.Errorf("got %d placeholders for %d arguments", got, len(args))
+	}
+}
+
+func TestNotificationsWithForgedServerID(t *testing.T) {
+	tests := []struct {
+		name     string
+		serverID string
+	}{
+		{
+			name:     "plain server ID",
+			serverID: "server1",
+		},
+		{
+			name:     "quote",
+			serverID: "server1' OR '1'='1",
+		},
+		{
+			name:     "statement",
+			serverID: "x'; DROP TABLE server_notifications; --",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestManager(t)
+			err := m.ToggleNotificationForSessionStarted("1", "1", tt.serverID, Race)
+			if err != nil {
+				t.Fatalf("error toggling the notification: %s", err)
+			}
+			err = m.ToggleNotificationForSessionStarted("2", "2", "server2", Race)
+			if err != nil {
+				t.Fatalf("error toggling the notification: %s", err)
+			}
+
+			n, err := m.ListNotifications("1", tt.serverID)
+			if err != nil {
+				t.Fatalf("error listing the notifications: %s", err)
+			}
+			if !n[Race] {
+				t.Error("the notification is not enabled for the server")
+			}
+
+			users, err := m.ListUsersForSessionStarted(tt.serverID, Race)
+			if err != nil {
+				t.Fatalf("error listing the users: %s", err)
+			}
+			if len(users) != 1 || users[0].ID != "1" {
+				t.Errorf("got users %v, want only user 1", users)
+			}
+		})
+	}
+}
+
+func TestUnknownSessionType(t *testing.T) {
+	m := newTestManager(t)
+	err := m.ToggleNotificationForSessionStarted("1", "1", "server1", "race = 1 OR 1")
+	if err == nil {
+		t.Error("toggling an unknown session type did not fail")
+	}
+	_, err = m.ListUsersForSessionStarted("server1", "race = 1 OR 1")
+	if err == nil {
+		t.Error("listing the users of an unknown session type did not fail")
+	}
+}
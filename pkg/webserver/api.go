@@ -0,0 +1,232 @@
+package webserver
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/model"
+	"github.com/oscar-martin/rfactor2telegrambot/pkg/pubsub"
+
+	"github.com/gorilla/mux"
+)
+
+const apiPath = "/api"
+
+// apiServer is a server as listed by the API. The URL of the rFactor2 server
+// is not exposed.
+type apiServer struct {
+	ID               string `json:"id"`
+	Name             string `json:"name"`
+	WebSocketRunning bool   `json:"wsRunning"`
+	ReceivingData    bool   `json:"receivingData"`
+	Session          string `json:"session"`
+	TrackName        string `json:"trackName"`
+}
+
+// serverData is the latest data received from a server.
+type serverData struct {
+	definition  model.ServerDefinition
+	sessionInfo model.LiveSessionInfoData
+	standing    model.LiveStandingData
+	history     model.LiveStandingHistoryData
+	positions   []model.CarPosition
+	cancel      context.CancelFunc
+}
+
+type api struct {
+	ctx     context.Context
+	servers []*serverData
+	byID    map[string]*serverData
+	mu      sync.Mutex
+}
+
+// APIHandlers serves the latest data of the servers as JSON under /api. The
+// servers added or removed later are followed too.
+func (m *Manager) APIHandlers(ctx context.Context, definitions []model.ServerDefinition) {
+	a := &api{
+		ctx:  ctx,
+		byID: map[string]*serverData{},
+	}
+	a.setServers(definitions)
+	go a.serversUpdater(pubsub.ServersChangedPubSub.Subscribe(pubsub.PubSubServersChangedPreffix))
+
+	r := m.r.PathPrefix(apiPath).Subrouter()
+	r.Use(apiMiddleware)
+	r.HandleFunc("/servers", a.serversHandler()).Methods(http.MethodGet)
+	r.HandleFunc("/servers/{id}/session", a.sessionHandler()).Methods(http.MethodGet)
+	r.HandleFunc("/servers/{id}/standings", a.standingsHandler()).Methods(http.MethodGet)
+	r.HandleFunc("/servers/{id}/drivers/{name}/laps", a.lapsHandler()).Methods(http.MethodGet)
+	r.HandleFunc("/servers/{id}/positions", a.positionsHandler()).Methods(http.MethodGet)
+}
+
+// apiMiddleware lets the API be read from any website.
+func apiMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Content-Type", "application/json")
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a *api) serversUpdater(serversChan <-chan []model.ServerDefinition) {
+	for definitions := range serversChan {
+		a.setServers(definitions)
+	}
+}
+
+// setServers follows the new servers and stops following the removed ones.
+// The API is not authenticated, so the members only servers are not served.
+func (a *api) setServers(definitions []model.ServerDefinition) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	active := map[string]bool{}
+	servers := []*serverData{}
+	for _, definition := range definitions {
+		if definition.MembersOnly {
+			continue
+		}
+		active[definition.ID] = true
+		sd, found := a.byID[definition.ID]
+		if !found {
+			sd = &serverData{}
+			a.byID[definition.ID] = sd
+			a.follow(definition.ID, sd)
+		}
+		sd.definition = definition
+		servers = append(servers, sd)
+	}
+	for id, sd := range a.byID {
+		if !active[id] {
+			sd.cancel()
+			delete(a.byID, id)
+		}
+	}
+	a.servers = servers
+}
+
+func (a *api) follow(serverID string, sd *serverData) {
+	ctx, cancel := context.WithCancel(a.ctx)
+	sd.cancel = cancel
+	// only the last snapshot is served, so older ones are dropped
+	sessionInfoChan := pubsub.LiveSessionInfoDataPubSub.SubscribeContext(ctx, pubsub.PubSubSessionInfoPreffix+serverID, pubsub.WithBuffer(1))
+	standingChan := pubsub.LiveStandingDataPubSub.SubscribeContext(ctx, pubsub.PubSubDriversSessionPreffix+serverID, pubsub.WithBuffer(1))
+	historyChan := pubsub.LiveStandingHistoryPubSub.SubscribeContext(ctx, pubsub.PubSubStintDataPreffix+serverID, pubsub.WithBuffer(1))
+	positionsChan := pubsub.CarsPositionPubSub.SubscribeContext(ctx, pubsub.PubSubCarsPositionPreffix+serverID, pubsub.WithBuffer(1))
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case lsid := <-sessionInfoChan:
+				a.mu.Lock()
+				sd.sessionInfo = lsid
+				a.mu.Unlock()
+			case lsd := <-standingChan:
+				a.mu.Lock()
+				sd.standing = lsd
+				a.mu.Unlock()
+			case lshd := <-historyChan:
+				a.mu.Lock()
+				sd.history = lshd
+				a.mu.Unlock()
+			case cps := <-positionsChan:
+				a.mu.Lock()
+				sd.positions = cps
+				a.mu.Unlock()
+			}
+		}
+	}()
+}
+
+func (a *api) serversHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		a.mu.Lock()
+		servers := []apiServer{}
+		for _, sd := range a.servers {
+			servers = append(servers, apiServer{
+				ID:               sd.definition.ID,
+				Name:             sd.definition.Name,
+				WebSocketRunning: sd.sessionInfo.SessionInfo.WebSocketRunning,
+				ReceivingData:    sd.sessionInfo.SessionInfo.ReceivingData,
+				Session:          sd.sessionInfo.SessionInfo.Session,
+				TrackName:        sd.sessionInfo.SessionInfo.TrackName,
+			})
+		}
+		a.mu.Unlock()
+		writeJSON(w, servers)
+	}
+}
+
+func (a *api) sessionHandler() func(w http.ResponseWriter, r *http.Request) {
+	return a.serverHandler(func(sd *serverData) any {
+		return sd.sessionInfo
+	})
+}
+
+func (a *api) standingsHandler() func(w http.ResponseWriter, r *http.Request) {
+	return a.serverHandler(func(sd *serverData) any {
+		return sd.standing
+	})
+}
+
+func (a *api) positionsHandler() func(w http.ResponseWriter, r *http.Request) {
+	return a.serverHandler(func(sd *serverData) any {
+		if sd.positions == nil {
+			return []model.CarPosition{}
+		}
+		return sd.positions
+	})
+}
+
+func (a *api) lapsHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		a.mu.Lock()
+		sd, found := a.byID[vars["id"]]
+		var laps []model.StandingHistoryDriverData
+		if found {
+			laps, found = sd.history.DriversData[vars["name"]]
+		}
+		a.mu.Unlock()
+		if !found {
+			writeError(w, http.StatusNotFound, "driver not found")
+			return
+		}
+		writeJSON(w, laps)
+	}
+}
+
+// serverHandler writes the data of the server returned by get.
+func (a *api) serverHandler(get func(sd *serverData) any) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		a.mu.Lock()
+		sd, found := a.byID[mux.Vars(r)["id"]]
+		var data any
+		if found {
+			data = get(sd)
+		}
+		a.mu.Unlock()
+		if !found {
+			writeError(w, http.StatusNotFound, "server not found")
+			return
+		}
+		writeJSON(w, data)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		log.Printf("Error writing API response: %s\n", err.Error())
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.WriteHeader(status)
+	writeJSON(w, map[string]string{"error": message})
+}
@@ -8,25 +8,38 @@ import (
 	"os"
 	"os/signal"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/oscar-martin/rfactor2telegrambot/pkg/resources"
 
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
+// ServersPath is the path the routers of the servers are served under.
+const ServersPath = "/servers"
+
 var upgrader = websocket.Upgrader{} // use default options
 
+type serverRouter struct {
+	prefix string
+	router *mux.Router
+}
+
 type Manager struct {
-	r                *mux.Router
-	serverIdToRouter map[string]*mux.Router
+	r *mux.Router
+	// the routers of the servers change while the webserver is serving, so
+	// they are dispatched by hand instead of being added to r
+	serverIdToRouter map[string]serverRouter
+	mu               sync.RWMutex
 }
 
 func NewManager() *Manager {
 	m := &Manager{
 		r:                mux.NewRouter(),
-		serverIdToRouter: make(map[string]*mux.Router),
+		serverIdToRouter: make(map[string]serverRouter),
 	}
 
 	m.rootHandlers()
@@ -37,13 +50,37 @@ func (m *Manager) router() *mux.Router {
 	return m.r
 }
 
-func (m *Manager) GetRouter(serverId, serverIdPrefix string) *mux.Router {
-	r := m.r.NewRoute().PathPrefix(serverIdPrefix)
-	sr := r.Subrouter()
+// NewRouter returns a router for the paths under serverIdPrefix, which must be
+// under ServersPath. It is not served until it is set with SetRouter.
+func NewRouter(serverIdPrefix string) *mux.Router {
+	return mux.NewRouter().PathPrefix(serverIdPrefix).Subrouter()
+}
 
-	m.serverIdToRouter[serverId] = sr
+// SetRouter serves the router of the server under serverIdPrefix. The router
+// previously set for the server, if any, is not served anymore.
+func (m *Manager) SetRouter(serverId, serverIdPrefix string, r *mux.Router) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.serverIdToRouter[serverId] = serverRouter{prefix: serverIdPrefix, router: r}
+}
 
-	return sr
+func (m *Manager) serversHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var router *mux.Router
+		m.mu.RLock()
+		for _, sr := range m.serverIdToRouter {
+			if r.URL.Path == sr.prefix || strings.HasPrefix(r.URL.Path, sr.prefix+"/") {
+				router = sr.router
+				break
+			}
+		}
+		m.mu.RUnlock()
+		if router == nil {
+			http.NotFound(w, r)
+			return
+		}
+		router.ServeHTTP(w, r)
+	}
 }
 
 func (m *Manager) rootHandlers() {
@@ -51,6 +88,8 @@ func (m *Manager) rootHandlers() {
 	resStr := "/resources/"
 
 	m.r.PathPrefix(resStr).Handler(http.StripPrefix(resStr, fs))
+	m.r.Handle("/metrics", promhttp.Handler())
+	m.r.PathPrefix(ServersPath + "/").HandlerFunc(m.serversHandler())
 }
 
 func (m *Manager) Debug() {